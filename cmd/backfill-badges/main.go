@@ -0,0 +1,45 @@
+// Command backfill-badges awards every user the milestone badges they have
+// reached but do not hold, such as ones a failed award missed. Run it after
+// the daily stats backfill, as badges are evaluated from the rollups:
+//
+//	go run ./cmd/backfill-badges
+package main
+
+import (
+	"context"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/db"
+	"idea-training-version-go/internals/services"
+	"log"
+	"os"
+	// the production image has no zoneinfo for user time zones
+	_ "time/tzdata"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	ctx := context.TODO()
+	if os.Getenv("STAGE") != "production" {
+		if err := godotenv.Load(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	db.ConnectDB(os.Getenv("MONGO_URI"))
+	defer db.MongoDB.Disconnect(ctx)
+
+	database := db.MongoDB.Database("60s-idea-trainings")
+	usercontroller := controllers.NewUserController(database.Collection("users"), ctx)
+	statscontroller := controllers.NewDailyStatsController(database.Collection("daily_stats"), ctx)
+	badgecontroller := controllers.NewBadgeController(database.Collection("badges"), ctx)
+	categorycontroller := controllers.NewCategoryController(database.Collection("categories"), database.Collection("idearecords"), database.Collection("syncsequences"), database.Collection("daily_stats"), ctx)
+	if err := badgecontroller.CreateIndexes(); err != nil {
+		log.Fatalln(err)
+	}
+
+	checked, err := services.NewAchievementService(usercontroller, statscontroller, badgecontroller, categorycontroller).Backfill()
+	if err != nil {
+		log.Fatalf("Checked badges of %v users before failing: %v\n", checked, err)
+	}
+	log.Printf("Checked badges of %v users\n", checked)
+}
@@ -0,0 +1,44 @@
+// Command backfill-daily-stats rebuilds the daily stats rollups of every
+// user from the idea records. Run it after deploying the rollups and
+// whenever they may have drifted:
+//
+//	go run ./cmd/backfill-daily-stats
+package main
+
+import (
+	"context"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/db"
+	"idea-training-version-go/internals/services"
+	"log"
+	"os"
+	// the production image has no zoneinfo for user time zones
+	_ "time/tzdata"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	ctx := context.TODO()
+	if os.Getenv("STAGE") != "production" {
+		if err := godotenv.Load(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	db.ConnectDB(os.Getenv("MONGO_URI"))
+	defer db.MongoDB.Disconnect(ctx)
+
+	database := db.MongoDB.Database("60s-idea-trainings")
+	usercontroller := controllers.NewUserController(database.Collection("users"), ctx)
+	ideacontroller := controllers.NewIdeaController(database.Collection("idearecords"), database.Collection("tombstones"), database.Collection("syncsequences"), database.Collection("daily_stats"), ctx)
+	statscontroller := controllers.NewDailyStatsController(database.Collection("daily_stats"), ctx)
+	if err := statscontroller.CreateIndexes(); err != nil {
+		log.Fatalln(err)
+	}
+
+	rebuilt, err := services.NewDailyStatsService(usercontroller, ideacontroller).Backfill()
+	if err != nil {
+		log.Fatalf("Rebuilt daily stats of %v users before failing: %v\n", rebuilt, err)
+	}
+	log.Printf("Rebuilt daily stats of %v users\n", rebuilt)
+}
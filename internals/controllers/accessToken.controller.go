@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AccessTokenController struct {
+	accesstokencollection *mongo.Collection
+	ctx                   context.Context
+}
+
+type IAccessTokenController interface {
+	CreateIndexes() error
+	CreateAccessToken(token *models.AccessToken) (*models.AccessToken, error)
+	GetAccessTokens(userID primitive.ObjectID) ([]*models.AccessToken, error)
+	GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error)
+	TouchAccessToken(tokenID primitive.ObjectID) error
+	DeleteAccessToken(tokenID primitive.ObjectID, userID primitive.ObjectID) error
+	DeleteAccessTokensOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewAccessTokenController(accesstokencollection *mongo.Collection, ctx context.Context) IAccessTokenController {
+	return &AccessTokenController{
+		accesstokencollection: accesstokencollection,
+		ctx:                   ctx,
+	}
+}
+
+func (ac *AccessTokenController) CreateIndexes() error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{bson.E{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{bson.E{Key: "createdBy", Value: 1}},
+		},
+	}
+	if _, err := ac.accesstokencollection.Indexes().CreateMany(ac.ctx, indexes); err != nil {
+		return errors.Wrap(err, "Error in creating access token indexes")
+	}
+	return nil
+}
+
+func (ac *AccessTokenController) CreateAccessToken(token *models.AccessToken) (*models.AccessToken, error) {
+	token.CreatedAt = time.Now()
+	if token.Scopes == nil {
+		token.Scopes = []guard.Scope{}
+	}
+
+	result, err := ac.accesstokencollection.InsertOne(ac.ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in InsertOne")
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("failed to fetch inserted access token _id")
+	}
+	token.ID = oid
+	return token, nil
+}
+
+func (ac *AccessTokenController) GetAccessTokens(userID primitive.ObjectID) ([]*models.AccessToken, error) {
+	tokens := []*models.AccessToken{}
+
+	query := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "createdAt", Value: -1}})
+
+	cursor, err := ac.accesstokencollection.Find(ac.ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ac.ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (ac *AccessTokenController) GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	var token models.AccessToken
+	filter := bson.D{
+		bson.E{
+			Key:   "tokenHash",
+			Value: tokenHash,
+		},
+	}
+	if err := ac.accesstokencollection.FindOne(ac.ctx, filter).Decode(&token); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return &token, nil
+}
+
+func (ac *AccessTokenController) TouchAccessToken(tokenID primitive.ObjectID) error {
+	_, err := ac.accesstokencollection.UpdateByID(ac.ctx, tokenID, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}})
+	return err
+}
+
+func (ac *AccessTokenController) DeleteAccessToken(tokenID primitive.ObjectID, userID primitive.ObjectID) error {
+	filter := bson.D{
+		bson.E{
+			Key:   "_id",
+			Value: tokenID,
+		},
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+
+	result, err := ac.accesstokencollection.DeleteOne(ac.ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ac *AccessTokenController) DeleteAccessTokensOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+
+	result, err := ac.accesstokencollection.DeleteMany(ac.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
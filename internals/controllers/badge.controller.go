@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BadgeController struct {
+	badgecollection *mongo.Collection
+	ctx             context.Context
+}
+
+type IBadgeController interface {
+	CreateIndexes() error
+	AwardBadge(badge *models.Badge) (bool, error)
+	GetBadges(userID primitive.ObjectID) ([]*models.Badge, error)
+	DeleteBadgesOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewBadgeController(badgecollection *mongo.Collection, ctx context.Context) IBadgeController {
+	return &BadgeController{
+		badgecollection: badgecollection,
+		ctx:             ctx,
+	}
+}
+
+func (bc *BadgeController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "kind", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := bc.badgecollection.Indexes().CreateOne(bc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating badges index")
+	}
+	return nil
+}
+
+// AwardBadge stores badge and reports whether it is new. A badge the user
+// already holds is left untouched.
+func (bc *BadgeController) AwardBadge(badge *models.Badge) (bool, error) {
+	badge.AwardedAt = time.Now()
+
+	result, err := bc.badgecollection.InsertOne(bc.ctx, badge)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Error in InsertOne")
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return false, errors.New("failed to fetch inserted badge _id")
+	}
+	badge.ID = oid
+	return true, nil
+}
+
+func (bc *BadgeController) GetBadges(userID primitive.ObjectID) ([]*models.Badge, error) {
+	badges := []*models.Badge{}
+
+	query := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "awardedAt", Value: 1}})
+
+	cursor, err := bc.badgecollection.Find(bc.ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(bc.ctx, &badges); err != nil {
+		return nil, err
+	}
+	return badges, nil
+}
+
+func (bc *BadgeController) DeleteBadgesOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+
+	result, err := bc.badgecollection.DeleteMany(bc.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
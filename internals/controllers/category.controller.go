@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// category names are compared regardless of case
+var categoryCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// CategoryController manages the category catalogues. Renames and deletions
+// migrate the ideas of the category and their daily rollups in the same
+// transaction, so it writes to the idea records and rollups too, drawing a
+// number of the sync sequence of the user for them.
+type CategoryController struct {
+	categorycollection *mongo.Collection
+	ideacollection     *mongo.Collection
+	sequence           syncSequence
+	rollups            dailyRollups
+	ctx                context.Context
+}
+
+type ICategoryController interface {
+	CreateIndexes() error
+	CreateCategory(category *models.Category) (*models.Category, error)
+	SeedCategories(userID primitive.ObjectID, names []string) error
+	GetCategories(userID primitive.ObjectID) ([]*models.Category, error)
+	GetCategory(categoryID primitive.ObjectID, userID primitive.ObjectID) (*models.Category, error)
+	UpdateCategory(category *models.Category, previousName string) (int64, error)
+	DeleteCategory(category *models.Category, fallback string) (int64, error)
+	DeleteCategoriesOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewCategoryController(categorycollection *mongo.Collection, ideacollection *mongo.Collection, sequencecollection *mongo.Collection, statscollection *mongo.Collection, ctx context.Context) ICategoryController {
+	return &CategoryController{
+		categorycollection: categorycollection,
+		ideacollection:     ideacollection,
+		sequence:           syncSequence{collection: sequencecollection},
+		rollups:            dailyRollups{collection: statscollection},
+		ctx:                ctx,
+	}
+}
+
+func (cc *CategoryController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(categoryCollation),
+	}
+	if _, err := cc.categorycollection.Indexes().CreateOne(cc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating categories index")
+	}
+	return nil
+}
+
+// CreateCategory stores category. A name the user already has fails with a
+// duplicate key error.
+func (cc *CategoryController) CreateCategory(category *models.Category) (*models.Category, error) {
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+
+	result, err := cc.categorycollection.InsertOne(cc.ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("failed to fetch inserted category _id")
+	}
+	category.ID = oid
+	return category, nil
+}
+
+// SeedCategories adds the names to the catalogue of the user, skipping the
+// ones already in it.
+func (cc *CategoryController) SeedCategories(userID primitive.ObjectID, names []string) error {
+	now := time.Now()
+	categories := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		categories = append(categories, models.Category{Name: name, CreatedBy: userID, CreatedAt: now, UpdatedAt: now})
+	}
+	if len(categories) == 0 {
+		return nil
+	}
+
+	_, err := cc.categorycollection.InsertMany(cc.ctx, categories, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return errors.Wrap(err, "Error in InsertMany")
+	}
+	return nil
+}
+
+func (cc *CategoryController) GetCategories(userID primitive.ObjectID) ([]*models.Category, error) {
+	categories := []*models.Category{}
+
+	query := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "name", Value: 1}}).SetCollation(categoryCollation)
+
+	cursor, err := cc.categorycollection.Find(cc.ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(cc.ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (cc *CategoryController) GetCategory(categoryID primitive.ObjectID, userID primitive.ObjectID) (*models.Category, error) {
+	var category *models.Category
+
+	query := bson.D{
+		bson.E{Key: "_id", Value: categoryID},
+		bson.E{Key: "createdBy", Value: userID},
+	}
+	if err := cc.categorycollection.FindOne(cc.ctx, query).Decode(&category); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return category, nil
+}
+
+// moveIdeas moves the ideas of the user and their rollups from one category
+// to another and returns how many ideas were moved. Like the catalogue, from
+// matches regardless of case so ideas filed before the catalogue existed
+// move along.
+func (cc *CategoryController) moveIdeas(sc mongo.SessionContext, userID primitive.ObjectID, from string, to string) (int64, error) {
+	filter := bson.D{
+		bson.E{Key: "createdBy", Value: userID},
+		bson.E{Key: "category", Value: from},
+	}
+	// syncing clients pick the moved ideas up by their shared number
+	seq, err := cc.sequence.next(sc, userID)
+	if err != nil {
+		return 0, err
+	}
+	update := bson.D{
+		bson.E{Key: "$set", Value: bson.D{
+			bson.E{Key: "category", Value: to},
+			bson.E{Key: "updatedAt", Value: time.Now()},
+			bson.E{Key: "syncSeq", Value: seq},
+		}},
+	}
+
+	opts := options.Update().SetCollation(categoryCollation)
+	result, err := cc.ideacollection.UpdateMany(sc, filter, update, opts)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error in moving ideas")
+	}
+	if err := cc.rollups.move(sc, userID, from, to); err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// UpdateCategory writes the name, colour and icon of category. When the
+// name changed, the ideas filed under previousName are renamed with it.
+// It returns the number of renamed ideas.
+func (cc *CategoryController) UpdateCategory(category *models.Category, previousName string) (int64, error) {
+	category.UpdatedAt = time.Now()
+	filter := bson.D{
+		bson.E{Key: "_id", Value: category.ID},
+		bson.E{Key: "createdBy", Value: category.CreatedBy},
+	}
+	update := bson.D{
+		bson.E{Key: "$set", Value: bson.D{
+			bson.E{Key: "name", Value: category.Name},
+			bson.E{Key: "color", Value: category.Color},
+			bson.E{Key: "icon", Value: category.Icon},
+			bson.E{Key: "updatedAt", Value: category.UpdatedAt},
+		}},
+	}
+
+	moved, err := withTransaction(cc.ctx, cc.categorycollection, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := cc.categorycollection.UpdateOne(sc, filter, update)
+		if err != nil {
+			return int64(0), err
+		}
+		if result.MatchedCount == 0 {
+			return int64(0), mongo.ErrNoDocuments
+		}
+		if category.Name == previousName {
+			return int64(0), nil
+		}
+		return cc.moveIdeas(sc, category.CreatedBy, previousName, category.Name)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved.(int64), nil
+}
+
+// DeleteCategory deletes category and files its ideas under fallback. It
+// returns the number of moved ideas.
+func (cc *CategoryController) DeleteCategory(category *models.Category, fallback string) (int64, error) {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: category.ID},
+		bson.E{Key: "createdBy", Value: category.CreatedBy},
+	}
+
+	moved, err := withTransaction(cc.ctx, cc.categorycollection, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := cc.categorycollection.DeleteOne(sc, filter)
+		if err != nil {
+			return int64(0), err
+		}
+		if result.DeletedCount == 0 {
+			return int64(0), mongo.ErrNoDocuments
+		}
+		return cc.moveIdeas(sc, category.CreatedBy, category.Name, fallback)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved.(int64), nil
+}
+
+func (cc *CategoryController) DeleteCategoriesOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+
+	result, err := cc.categorycollection.DeleteMany(cc.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dailyRollups writes the rollups DailyStatsController answers from, in
+// the transaction of the idea write or category move given by its session
+// context.
+type dailyRollups struct {
+	collection *mongo.Collection
+}
+
+func rollupFilter(stats models.DailyStats) bson.D {
+	return bson.D{
+		bson.E{Key: "createdBy", Value: stats.UserID},
+		bson.E{Key: "day", Value: stats.Day},
+		bson.E{Key: "category", Value: stats.Category},
+	}
+}
+
+func (r dailyRollups) increment(ctx context.Context, stats models.DailyStats, sign int) error {
+	update := bson.D{
+		bson.E{
+			Key: "$inc",
+			Value: bson.D{
+				bson.E{Key: "sessions", Value: sign * stats.Sessions},
+				bson.E{Key: "ideas", Value: sign * stats.Ideas},
+				bson.E{Key: "liked", Value: sign * stats.Liked},
+				bson.E{Key: "timedSessions", Value: sign * stats.TimedSessions},
+				bson.E{Key: "timedIdeas", Value: sign * stats.TimedIdeas},
+				bson.E{Key: "seconds", Value: float64(sign) * stats.Seconds},
+			},
+		},
+		bson.E{Key: "$set", Value: bson.D{bson.E{Key: "timezone", Value: stats.Timezone}}},
+	}
+	_, err := r.collection.UpdateOne(ctx, rollupFilter(stats), update, options.Update().SetUpsert(true))
+	return err
+}
+
+// add counts idea in the rollup of its day in loc.
+func (r dailyRollups) add(ctx context.Context, idea *models.Idea, loc *time.Location) error {
+	if err := r.increment(ctx, IdeaDailyStats(idea, loc), 1); err != nil {
+		return errors.Wrap(err, "Error in adding idea to daily stats")
+	}
+	return nil
+}
+
+// remove takes idea back out of its rollup and deletes the rollup once no
+// session is left in it.
+func (r dailyRollups) remove(ctx context.Context, idea *models.Idea, loc *time.Location) error {
+	stats := IdeaDailyStats(idea, loc)
+	if err := r.increment(ctx, stats, -1); err != nil {
+		return errors.Wrap(err, "Error in removing idea from daily stats")
+	}
+
+	filter := append(rollupFilter(stats), bson.E{Key: "sessions", Value: bson.D{bson.E{Key: "$lte", Value: 0}}})
+	if _, err := r.collection.DeleteOne(ctx, filter); err != nil {
+		return errors.Wrap(err, "Error in deleting empty daily stats")
+	}
+	return nil
+}
+
+// replace drops the rollups of the user and inserts stats instead.
+func (r dailyRollups) replace(ctx context.Context, userID primitive.ObjectID, stats []models.DailyStats) error {
+	filter := bson.D{bson.E{Key: "createdBy", Value: userID}}
+	if _, err := r.collection.DeleteMany(ctx, filter); err != nil {
+		return errors.Wrap(err, "Error in deleting daily stats")
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	documents := make([]interface{}, 0, len(stats))
+	for _, rollup := range stats {
+		documents = append(documents, rollup)
+	}
+	if _, err := r.collection.InsertMany(ctx, documents); err != nil {
+		return errors.Wrap(err, "Error in inserting daily stats")
+	}
+	return nil
+}
+
+// move files the rollups of the user in category from, matched regardless of
+// case like the ideas moved with them, under category to.
+func (r dailyRollups) move(ctx context.Context, userID primitive.ObjectID, from string, to string) error {
+	filter := bson.D{
+		bson.E{Key: "createdBy", Value: userID},
+		bson.E{Key: "category", Value: from},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetCollation(categoryCollation))
+	if err != nil {
+		return errors.Wrap(err, "Error in finding daily stats to move")
+	}
+	var rollups []models.DailyStats
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return err
+	}
+
+	for _, rollup := range rollups {
+		if rollup.Category == to {
+			continue
+		}
+		moved := rollup
+		moved.Category = to
+		if err := r.increment(ctx, moved, 1); err != nil {
+			return errors.Wrap(err, "Error in moving daily stats")
+		}
+		if _, err := r.collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: rollup.ID}}); err != nil {
+			return errors.Wrap(err, "Error in deleting moved daily stats")
+		}
+	}
+	return nil
+}
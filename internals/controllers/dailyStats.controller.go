@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DailyStatsController answers from one rollup per user, day and category
+// so the dashboard statistics do not have to scan the idea records.
+// IdeaController writes the rollups along with the ideas. The days are cut
+// in the time zone of the user; the rollups of a user are rebuilt when it
+// changes, see IdeaController.RebuildDailyStats.
+type DailyStatsController struct {
+	statscollection *mongo.Collection
+	ctx             context.Context
+	now             func() time.Time
+}
+
+type IDailyStatsController interface {
+	IIdeaStatsController
+	CreateIndexes() error
+	DeleteStatsOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewDailyStatsController(statscollection *mongo.Collection, ctx context.Context) IDailyStatsController {
+	return &DailyStatsController{
+		statscollection: statscollection,
+		ctx:             ctx,
+		now:             time.Now,
+	}
+}
+
+// SetClock replaces the clock telling the current day, so tests can pin it.
+func (dc *DailyStatsController) SetClock(now func() time.Time) {
+	dc.now = now
+}
+
+func (dc *DailyStatsController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "createdBy", Value: 1},
+			bson.E{Key: "day", Value: 1},
+			bson.E{Key: "category", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := dc.statscollection.Indexes().CreateOne(dc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating daily stats index")
+	}
+	return nil
+}
+
+// IdeaDailyStats returns what idea adds to the rollup of its day in loc.
+func IdeaDailyStats(idea *models.Idea, loc *time.Location) models.DailyStats {
+	stats := models.DailyStats{
+		UserID:   idea.CreatedBy,
+		Day:      utils.StartOfDay(idea.CreatedAt, loc),
+		Timezone: loc.String(),
+		Category: idea.Category,
+		Sessions: 1,
+	}
+	if idea.Ideas != nil {
+		stats.Ideas = len(*idea.Ideas)
+	}
+	if idea.IsLiked != nil && *idea.IsLiked {
+		stats.Liked = 1
+	}
+	if idea.Duration != nil && *idea.Duration > 0 {
+		stats.TimedSessions = 1
+		stats.TimedIdeas = stats.Ideas
+		stats.Seconds = *idea.Duration
+	}
+	return stats
+}
+
+func (dc *DailyStatsController) DeleteStatsOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{bson.E{Key: "createdBy", Value: userID}}
+
+	result, err := dc.statscollection.DeleteMany(dc.ctx, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error in deleting daily stats")
+	}
+	return result.DeletedCount, nil
+}
+
+// activeRollups matches the rollups of the user with at least one session,
+// optionally restricted to the days between from (inclusive) and to
+// (exclusive). Zero times leave the range open.
+func activeRollups(userID primitive.ObjectID, from time.Time, to time.Time) bson.D {
+	match := bson.D{
+		bson.E{Key: "createdBy", Value: userID},
+		bson.E{Key: "sessions", Value: bson.D{bson.E{Key: "$gt", Value: 0}}},
+	}
+	day := bson.D{}
+	if !from.IsZero() {
+		day = append(day, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		day = append(day, bson.E{Key: "$lt", Value: to})
+	}
+	if len(day) > 0 {
+		match = append(match, bson.E{Key: "day", Value: day})
+	}
+	return bson.D{bson.E{Key: "$match", Value: match}}
+}
+
+// localDay formats the day of a rollup in loc.
+func localDay(format string, loc *time.Location) bson.D {
+	return bson.D{
+		bson.E{
+			Key: "$dateToString",
+			Value: bson.D{
+				bson.E{Key: "format", Value: format},
+				bson.E{Key: "date", Value: "$day"},
+				bson.E{Key: "timezone", Value: loc.String()},
+			},
+		},
+	}
+}
+
+// totalsStage sums up the sessions and ideas of the rollups grouped by id.
+func totalsStage(id interface{}) bson.D {
+	return bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: id},
+				bson.E{Key: "totalIdeas", Value: bson.D{bson.E{Key: "$sum", Value: "$ideas"}}},
+				bson.E{Key: "totalSessions", Value: bson.D{bson.E{Key: "$sum", Value: "$sessions"}}},
+			},
+		},
+	}
+}
+
+func (dc *DailyStatsController) aggregate(pipeline mongo.Pipeline, results interface{}) error {
+	cursor, err := dc.statscollection.Aggregate(dc.ctx, pipeline)
+	if err != nil {
+		return errors.Wrap(err, "Error in aggregating daily stats")
+	}
+	return cursor.All(dc.ctx, results)
+}
+
+// GetTotalIdeasOfToday counts the ideas and sessions since midnight in loc.
+func (dc *DailyStatsController) GetTotalIdeasOfToday(userID primitive.ObjectID, loc *time.Location) ([]bson.M, error) {
+	today := utils.StartOfDay(dc.now(), loc)
+
+	var results []bson.M
+	err := dc.aggregate(mongo.Pipeline{activeRollups(userID, today, time.Time{}), totalsStage(nil)}, &results)
+	return results, err
+}
+
+func (dc *DailyStatsController) GetTotalIdeasOfAllTime(userID primitive.ObjectID) ([]bson.M, error) {
+	var results []bson.M
+	err := dc.aggregate(mongo.Pipeline{activeRollups(userID, time.Time{}, time.Time{}), totalsStage(nil)}, &results)
+	return results, err
+}
+
+// GetStreaks computes the streaks from the distinct days with a rollup.
+func (dc *DailyStatsController) GetStreaks(userID primitive.ObjectID, loc *time.Location, freezes int) (*models.Streaks, error) {
+	groupStage := bson.D{bson.E{Key: "$group", Value: bson.D{bson.E{Key: "_id", Value: localDay("%Y-%m-%d", loc)}}}}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	var results []struct {
+		Day string `bson:"_id"`
+	}
+	if err := dc.aggregate(mongo.Pipeline{activeRollups(userID, time.Time{}, time.Time{}), groupStage, sortStage}, &results); err != nil {
+		return nil, err
+	}
+
+	days := make([]string, 0, len(results))
+	for _, result := range results {
+		days = append(days, result.Day)
+	}
+	return computeStreaks(days, utils.StartOfDay(dc.now(), loc).Format("2006-01-02"), freezes)
+}
+
+// GetDailyCounts returns the sessions and ideas of every active day in loc
+// between from (inclusive) and to (exclusive), oldest first.
+func (dc *DailyStatsController) GetDailyCounts(userID primitive.ObjectID, from time.Time, to time.Time, loc *time.Location) ([]models.DailyCount, error) {
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	counts := []models.DailyCount{}
+	err := dc.aggregate(mongo.Pipeline{activeRollups(userID, from, to), totalsStage(localDay("%Y-%m-%d", loc)), sortStage}, &counts)
+	return counts, err
+}
+
+// GetCategoryCounts sums up sessions, ideas and liked sessions per category
+// for the days between from (inclusive) and to (exclusive).
+func (dc *DailyStatsController) GetCategoryCounts(userID primitive.ObjectID, from time.Time, to time.Time) ([]models.CategoryCounts, error) {
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: "$category"},
+				bson.E{Key: "sessions", Value: bson.D{bson.E{Key: "$sum", Value: "$sessions"}}},
+				bson.E{Key: "ideas", Value: bson.D{bson.E{Key: "$sum", Value: "$ideas"}}},
+				bson.E{Key: "liked", Value: bson.D{bson.E{Key: "$sum", Value: "$liked"}}},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "sessions", Value: -1}, bson.E{Key: "_id", Value: 1}}}}
+
+	counts := []models.CategoryCounts{}
+	err := dc.aggregate(mongo.Pipeline{activeRollups(userID, from, to), groupStage, sortStage}, &counts)
+	return counts, err
+}
+
+// GetWeeklyIdeas groups the ideas since Monday by day, both in loc.
+func (dc *DailyStatsController) GetWeeklyIdeas(userID primitive.ObjectID, loc *time.Location) ([]bson.M, time.Time, error) {
+	lastMonday := utils.StartOfWeek(dc.now(), loc)
+
+	var results []bson.M
+	err := dc.aggregate(mongo.Pipeline{activeRollups(userID, lastMonday, time.Time{}), totalsStage(localDay("%Y-%m-%d", loc))}, &results)
+	return results, lastMonday, err
+}
+
+// GetIdeasPerMinute groups the timed sessions by interval in loc and
+// returns the ideas per minute of every period, oldest first.
+func (dc *DailyStatsController) GetIdeasPerMinute(userID primitive.ObjectID, interval string, loc *time.Location) ([]bson.M, error) {
+	format, ok := IdeaPaceIntervals[interval]
+	if !ok {
+		return nil, errors.Errorf("invalid interval %v", interval)
+	}
+
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "timedSessions", Value: bson.D{bson.E{Key: "$gt", Value: 0}}},
+			},
+		},
+	}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: localDay(format, loc)},
+				bson.E{Key: "totalIdeas", Value: bson.D{bson.E{Key: "$sum", Value: "$timedIdeas"}}},
+				bson.E{Key: "totalSeconds", Value: bson.D{bson.E{Key: "$sum", Value: "$seconds"}}},
+				bson.E{Key: "totalSessions", Value: bson.D{bson.E{Key: "$sum", Value: "$timedSessions"}}},
+			},
+		},
+	}
+	projectStage := bson.D{
+		bson.E{
+			Key: "$project",
+			Value: bson.D{
+				bson.E{Key: "totalIdeas", Value: 1},
+				bson.E{Key: "totalSeconds", Value: 1},
+				bson.E{Key: "totalSessions", Value: 1},
+				bson.E{
+					Key: "ideasPerMinute",
+					Value: bson.D{
+						bson.E{
+							Key:   "$divide",
+							Value: bson.A{"$totalIdeas", bson.D{bson.E{Key: "$divide", Value: bson.A{"$totalSeconds", 60}}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	results := []bson.M{}
+	err := dc.aggregate(mongo.Pipeline{matchStage, groupStage, projectStage, sortStage}, &results)
+	return results, err
+}
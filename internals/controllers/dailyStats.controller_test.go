@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"idea-training-version-go/internals/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIdeaDailyStats(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatalf("TestIdeaDailyStats: %v", err)
+	}
+	userID := primitive.NewObjectID()
+	liked := true
+	duration := 45.5
+	entries := []models.IdeaEntry{{Text: "idea_1"}, {Text: "idea_2"}}
+	// 20:00 UTC is already the next day in Kolkata
+	createdAt := time.Date(2023, 3, 10, 20, 0, 0, 0, time.UTC)
+
+	untimed := IdeaDailyStats(&models.Idea{CreatedBy: userID, Category: "work", Ideas: &entries, CreatedAt: createdAt}, kolkata)
+	want := models.DailyStats{
+		UserID:   userID,
+		Day:      time.Date(2023, 3, 11, 0, 0, 0, 0, kolkata),
+		Timezone: "Asia/Kolkata",
+		Category: "work",
+		Sessions: 1,
+		Ideas:    2,
+	}
+	if untimed != want {
+		t.Errorf("TestIdeaDailyStats: expected %+v, got %+v", want, untimed)
+	}
+
+	timed := IdeaDailyStats(&models.Idea{CreatedBy: userID, Category: "work", Ideas: &entries, IsLiked: &liked, Duration: &duration, CreatedAt: createdAt}, kolkata)
+	want.Liked, want.TimedSessions, want.TimedIdeas, want.Seconds = 1, 1, 2, 45.5
+	if timed != want {
+		t.Errorf("TestIdeaDailyStats: expected %+v, got %+v", want, timed)
+	}
+
+	empty := IdeaDailyStats(&models.Idea{CreatedBy: userID, CreatedAt: createdAt}, time.UTC)
+	if empty.Sessions != 1 || empty.Ideas != 0 || !empty.Day.Equal(time.Date(2023, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("TestIdeaDailyStats: expected one empty session on the UTC day, got %+v", empty)
+	}
+}
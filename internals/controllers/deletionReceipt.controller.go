@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeletionReceiptController struct {
+	receiptcollection *mongo.Collection
+	ctx               context.Context
+}
+
+type IDeletionReceiptController interface {
+	CreateIndexes() error
+	CreateDeletionReceipt(receipt *models.DeletionReceipt) (*models.DeletionReceipt, error)
+	GetDeletionReceipt(userID primitive.ObjectID) (*models.DeletionReceipt, error)
+	CompleteDeletionStep(receiptID primitive.ObjectID, step string, deleted int64) error
+	FailDeletionStep(receiptID primitive.ObjectID, step string, cause error) error
+	CompleteDeletion(receiptID primitive.ObjectID) error
+}
+
+func NewDeletionReceiptController(receiptcollection *mongo.Collection, ctx context.Context) IDeletionReceiptController {
+	return &DeletionReceiptController{
+		receiptcollection: receiptcollection,
+		ctx:               ctx,
+	}
+}
+
+// CreateIndexes allows one receipt per user, so concurrent deletion requests
+// share the same receipt.
+func (rc *DeletionReceiptController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := rc.receiptcollection.Indexes().CreateOne(rc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating deletion receipts index")
+	}
+	return nil
+}
+
+func (rc *DeletionReceiptController) CreateDeletionReceipt(receipt *models.DeletionReceipt) (*models.DeletionReceipt, error) {
+	receipt.CreatedAt = time.Now()
+	receipt.Status = models.DELETION_PENDING
+	if receipt.CompletedSteps == nil {
+		receipt.CompletedSteps = []string{}
+	}
+	if receipt.Deleted == nil {
+		receipt.Deleted = map[string]int64{}
+	}
+
+	result, err := rc.receiptcollection.InsertOne(rc.ctx, receipt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in InsertOne")
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("failed to fetch inserted deletion receipt _id")
+	}
+	receipt.ID = oid
+	return receipt, nil
+}
+
+func (rc *DeletionReceiptController) GetDeletionReceipt(userID primitive.ObjectID) (*models.DeletionReceipt, error) {
+	var receipt models.DeletionReceipt
+	filter := bson.D{
+		bson.E{
+			Key:   "userId",
+			Value: userID,
+		},
+	}
+	if err := rc.receiptcollection.FindOne(rc.ctx, filter).Decode(&receipt); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return &receipt, nil
+}
+
+// CompleteDeletionStep records step as succeeded and adds deleted to its
+// count, as a resumed deletion runs every step again.
+func (rc *DeletionReceiptController) CompleteDeletionStep(receiptID primitive.ObjectID, step string, deleted int64) error {
+	update := bson.M{
+		"$addToSet": bson.M{"completedSteps": step},
+		"$inc":      bson.M{"deleted." + step: deleted},
+		"$set":      bson.M{"updatedAt": time.Now()},
+		"$unset":    bson.M{"lastError": ""},
+	}
+	_, err := rc.receiptcollection.UpdateByID(rc.ctx, receiptID, update)
+	return err
+}
+
+func (rc *DeletionReceiptController) FailDeletionStep(receiptID primitive.ObjectID, step string, cause error) error {
+	update := bson.M{
+		"$set": bson.M{"lastError": step + ": " + cause.Error(), "updatedAt": time.Now()},
+	}
+	_, err := rc.receiptcollection.UpdateByID(rc.ctx, receiptID, update)
+	return err
+}
+
+// CompleteDeletion marks the receipt completed and drops the identifiers
+// that were only kept to resume the deletion.
+func (rc *DeletionReceiptController) CompleteDeletion(receiptID primitive.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"status": models.DELETION_COMPLETED, "completedAt": time.Now(), "updatedAt": time.Now()},
+		"$unset": bson.M{"firebaseUid": "", "imagePublicIds": ""},
+	}
+	_, err := rc.receiptcollection.UpdateByID(rc.ctx, receiptID, update)
+	return err
+}
@@ -3,7 +3,9 @@ package controllers
 import (
 	"context"
 	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
 	"log"
+	"regexp"
 	"time"
 
 	paginate "github.com/gobeam/mongo-go-pagination"
@@ -14,34 +16,160 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// IdeaController manages the idea records. Deleting an idea leaves a
+// tombstone for syncing clients in the same transaction, so it writes to
+// the tombstones too. Every write draws a number of the sync sequence of
+// the owner and moves the idea in the daily rollups in its transaction,
+// with the days cut in the time zone of the owner given to it.
 type IdeaController struct {
-	ideacollection *mongo.Collection
-	ctx            context.Context
+	ideacollection      *mongo.Collection
+	tombstonecollection *mongo.Collection
+	sequence            syncSequence
+	rollups             dailyRollups
+	ctx                 context.Context
+	now                 func() time.Time
+}
+
+// IIdeaStatsController answers the dashboard statistics. IdeaController
+// aggregates them from the idea records, DailyStatsController from the
+// daily rollups; both give the same results.
+type IIdeaStatsController interface {
+	GetTotalIdeasOfToday(userID primitive.ObjectID, loc *time.Location) ([]bson.M, error)
+	GetTotalIdeasOfAllTime(userID primitive.ObjectID) ([]bson.M, error)
+	GetStreaks(userID primitive.ObjectID, loc *time.Location, freezes int) (*models.Streaks, error)
+	GetDailyCounts(userID primitive.ObjectID, from time.Time, to time.Time, loc *time.Location) ([]models.DailyCount, error)
+	GetCategoryCounts(userID primitive.ObjectID, from time.Time, to time.Time) ([]models.CategoryCounts, error)
+	GetWeeklyIdeas(userID primitive.ObjectID, loc *time.Location) ([]bson.M, time.Time, error)
+	GetIdeasPerMinute(userID primitive.ObjectID, interval string, loc *time.Location) ([]bson.M, error)
 }
 
 type IIdeaController interface {
-	CreateIdea(idea *models.Idea) (*models.Idea, error)
+	IIdeaStatsController
+	CreateIndexes() error
+	CreateIdea(idea *models.Idea, loc *time.Location) (*models.Idea, error)
 	GetAllIdeas(userID primitive.ObjectID) ([]*models.Idea, error)
-	GetIdeaByID(ideaID primitive.ObjectID) (*models.Idea, error)
-	UpdateIdea(idea *models.Idea) error
-	DeleteIdea(ideaID primitive.ObjectID) error
-	GetTotalIdeasOfToday(userID primitive.ObjectID) ([]bson.M, error)
-	GetTotalIdeasOfAllTime(userID primitive.ObjectID) ([]bson.M, error)
-	GetTotalConsecutiveDays(userID primitive.ObjectID) (int, error)
+	EachIdea(userID primitive.ObjectID, fn func(idea *models.Idea) error) error
+	GetIdeaByID(ideaID primitive.ObjectID, scope IdeaScope) (*models.Idea, error)
+	UpdateIdea(idea *models.Idea, scope IdeaScope, loc *time.Location) error
+	UpdateIdeaIfUnchanged(idea *models.Idea, scope IdeaScope, updatedAt time.Time, loc *time.Location) error
+	DeleteIdea(ideaID primitive.ObjectID, scope IdeaScope, loc *time.Location) error
+	DeleteIdeaIfUnchanged(ideaID primitive.ObjectID, scope IdeaScope, updatedAt time.Time, loc *time.Location) error
+	DeleteIdeasOfUser(userID primitive.ObjectID) (int64, error)
+	GetSyncSequence(userID primitive.ObjectID) (int64, error)
+	GetChangedIdeas(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Idea, bool, error)
+	GetTombstones(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Tombstone, bool, error)
+	DeleteTombstonesOfUser(userID primitive.ObjectID) (int64, error)
+	GetCategories(userID primitive.ObjectID) ([]string, error)
+	GetTags(userID primitive.ObjectID, prefix string, limit int) ([]models.TagCount, error)
+	GetDailyStats(userID primitive.ObjectID, loc *time.Location) ([]models.DailyStats, error)
+	RebuildDailyStats(userID primitive.ObjectID, loc *time.Location) error
+	GetRevisitedTopics(userID primitive.ObjectID, limit int) ([]models.TopicHistory, error)
 	GetRecentIdeas(userID primitive.ObjectID) ([]*models.Idea, error)
-	GetWeeklyIdeas(userID primitive.ObjectID) ([]bson.M, time.Time, error)
+	GetTimesToFirstIdea(userID primitive.ObjectID) ([]int64, error)
 	Search(filter bson.M, sort int, page int, limit int) ([]models.Idea, *paginate.PaginatedData, error)
+	FindPage(filter bson.M, field string, order int, cursor *models.Cursor, limit int) ([]models.Idea, *models.CursorPage, error)
+	SearchByRelevance(filter bson.M, search string, page int, limit int) ([]models.IdeaSearchResult, *paginate.PaginatedData, error)
 }
 
-func NewIdeaController(ideacollection *mongo.Collection, ctx context.Context) IIdeaController {
+// ErrTextIndexMissing is returned by SearchByRelevance while the text index
+// of the ideas is not built.
+var ErrTextIndexMissing = errors.New("ideas text index is missing")
+
+// MongoDB error codes of queries needing a missing index and of indexes
+// created with other keys than an existing one of the same name
+const (
+	indexNotFoundCode         = 27
+	indexKeySpecsConflictCode = 86
+)
+
+func NewIdeaController(ideacollection *mongo.Collection, tombstonecollection *mongo.Collection, sequencecollection *mongo.Collection, statscollection *mongo.Collection, ctx context.Context) IIdeaController {
 	return &IdeaController{
-		ideacollection: ideacollection,
-		ctx:            ctx,
+		ideacollection:      ideacollection,
+		tombstonecollection: tombstonecollection,
+		sequence:            syncSequence{collection: sequencecollection},
+		rollups:             dailyRollups{collection: statscollection},
+		ctx:                 ctx,
+		now:                 time.Now,
+	}
+}
+
+// SetClock replaces the clock telling the current day, so tests can pin it.
+func (ic *IdeaController) SetClock(now func() time.Time) {
+	ic.now = now
+}
+
+// CreateIndexes adds a multikey index for the tag filters and listings and
+// the text index for relevance search. The text index covers the fields of
+// query.TextFilter, with both legacy string entries and structured ones; it
+// does not stem, as ideas are written in many languages.
+func (ic *IdeaController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "tags", Value: 1}},
+	}
+	if _, err := ic.ideacollection.Indexes().CreateOne(ic.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating idea tags index")
+	}
+
+	// cursor pages of the listings and searches
+	pageIndexes := []mongo.IndexModel{
+		{Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "createdAt", Value: 1}, bson.E{Key: "_id", Value: 1}}},
+		{Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "updatedAt", Value: 1}, bson.E{Key: "_id", Value: 1}}},
+		{Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "syncSeq", Value: 1}, bson.E{Key: "_id", Value: 1}}},
 	}
+	if _, err := ic.ideacollection.Indexes().CreateMany(ic.ctx, pageIndexes); err != nil {
+		return errors.Wrap(err, "Error in creating idea page indexes")
+	}
+
+	textIndex := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "topicTitle", Value: "text"},
+			bson.E{Key: "ideas", Value: "text"},
+			bson.E{Key: "ideas.text", Value: "text"},
+			bson.E{Key: "comment", Value: "text"},
+			bson.E{Key: "category", Value: "text"},
+			bson.E{Key: "tags", Value: "text"},
+		},
+		Options: options.Index().SetName("ideas_text").SetDefaultLanguage("none").SetWeights(bson.D{
+			bson.E{Key: "topicTitle", Value: 10},
+			bson.E{Key: "ideas", Value: 5},
+			bson.E{Key: "ideas.text", Value: 5},
+			bson.E{Key: "tags", Value: 3},
+			bson.E{Key: "category", Value: 2},
+			bson.E{Key: "comment", Value: 1},
+		}),
+	}
+	_, err := ic.ideacollection.Indexes().CreateOne(ic.ctx, textIndex)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && (serverErr.HasErrorCode(indexOptionsConflictCode) || serverErr.HasErrorCode(indexKeySpecsConflictCode)) {
+		// the text index used not to cover comments
+		if _, err = ic.ideacollection.Indexes().DropOne(ic.ctx, "ideas_text"); err == nil {
+			_, err = ic.ideacollection.Indexes().CreateOne(ic.ctx, textIndex)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error in creating idea text index")
+	}
+
+	tombstoneIndexes := []mongo.IndexModel{
+		{Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "syncSeq", Value: 1}, bson.E{Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{bson.E{Key: "deletedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(models.TOMBSTONE_RETENTION.Seconds())),
+		},
+	}
+	if _, err := ic.tombstonecollection.Indexes().CreateMany(ic.ctx, tombstoneIndexes); err != nil {
+		return errors.Wrap(err, "Error in creating tombstone indexes")
+	}
+	return nil
 }
 
-func (ic *IdeaController) CreateIdea(idea *models.Idea) (*models.Idea, error) {
-	idea.CreatedAt = time.Now()
+// CreateIdea stores idea, created now unless CreatedAt is set, and counts
+// it in the rollup of its day in loc. An idea with a given _id that is
+// already stored fails with a duplicate key error.
+func (ic *IdeaController) CreateIdea(idea *models.Idea, loc *time.Location) (*models.Idea, error) {
+	if idea.CreatedAt.IsZero() {
+		idea.CreatedAt = time.Now()
+	}
 	// deal with default topic title
 	if idea.TopicTitle == "" {
 		idea.TopicTitle = "Untitled"
@@ -49,7 +177,7 @@ func (ic *IdeaController) CreateIdea(idea *models.Idea) (*models.Idea, error) {
 
 	// deal with default category
 	if idea.Category == "" {
-		idea.Category = "Other"
+		idea.Category = models.DEFAULT_CATEGORY
 	}
 	// deal with default viewed
 	if idea.Viewed == nil {
@@ -63,7 +191,12 @@ func (ic *IdeaController) CreateIdea(idea *models.Idea) (*models.Idea, error) {
 
 	// deal with default ideas
 	if idea.Ideas == nil {
-		idea.Ideas = &[]string{}
+		idea.Ideas = &[]models.IdeaEntry{}
+	}
+
+	// deal with default tags
+	if idea.Tags == nil {
+		idea.Tags = &[]string{}
 	}
 
 	// deal with default comment
@@ -71,11 +204,25 @@ func (ic *IdeaController) CreateIdea(idea *models.Idea) (*models.Idea, error) {
 		idea.Comment = &[]string{""}[0]
 	}
 
-	result, err := ic.ideacollection.InsertOne(ic.ctx, idea)
+	result, err := withTransaction(ic.ctx, ic.ideacollection, func(sc mongo.SessionContext) (interface{}, error) {
+		seq, err := ic.sequence.next(sc, idea.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		idea.SyncSeq = seq
+		result, err := ic.ideacollection.InsertOne(sc, idea)
+		if err != nil {
+			return nil, err
+		}
+		if err := ic.rollups.add(sc, idea, loc); err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	oid, ok := result.InsertedID.(primitive.ObjectID)
+	oid, ok := result.(*mongo.InsertOneResult).InsertedID.(primitive.ObjectID)
 	if !ok {
 		return nil, errors.New("failed to fetch inserted Idea _id")
 	}
@@ -110,15 +257,81 @@ func (ic *IdeaController) GetAllIdeas(userID primitive.ObjectID) ([]*models.Idea
 	return ideas, nil
 }
 
-func (ic *IdeaController) GetIdeaByID(ideaID primitive.ObjectID) (*models.Idea, error) {
-	var idea models.Idea
-
+// EachIdea calls fn for every idea of the user, oldest first, decoding one
+// document at a time from the cursor instead of loading all of them.
+func (ic *IdeaController) EachIdea(userID primitive.ObjectID, fn func(idea *models.Idea) error) error {
 	query := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "createdAt", Value: 1}, bson.E{Key: "_id", Value: 1}})
+
+	cursor, err := ic.ideacollection.Find(ic.ctx, query, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ic.ctx)
+
+	for cursor.Next(ic.ctx) {
+		var idea models.Idea
+		if err := cursor.Decode(&idea); err != nil {
+			return err
+		}
+		if err := fn(&idea); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// IdeaScope limits the single-idea operations to the ideas of one owner,
+// or to the ideas of every user for AnyIdeaOwner. The zero IdeaScope has
+// no owner and matches no idea, so a missing owner can never widen a query.
+type IdeaScope struct {
+	ownerID  primitive.ObjectID
+	anyOwner bool
+}
+
+// OwnedBy scopes to the ideas created by ownerID.
+func OwnedBy(ownerID primitive.ObjectID) IdeaScope {
+	return IdeaScope{ownerID: ownerID}
+}
+
+// AnyIdeaOwner scopes to the ideas of every user, for admins.
+func AnyIdeaOwner() IdeaScope {
+	return IdeaScope{anyOwner: true}
+}
+
+// Includes reports whether ideas created by ownerID are in the scope.
+func (s IdeaScope) Includes(ownerID primitive.ObjectID) bool {
+	return s.anyOwner || (!s.ownerID.IsZero() && s.ownerID == ownerID)
+}
+
+// ownedIdeaFilter matches the idea with ideaID within scope, so records of
+// other users behave as if they did not exist.
+func ownedIdeaFilter(ideaID primitive.ObjectID, scope IdeaScope) bson.D {
+	filter := bson.D{
 		bson.E{
 			Key:   "_id",
 			Value: ideaID,
 		},
 	}
+	if !scope.anyOwner {
+		// every idea has a creator, a zero owner matches none
+		filter = append(filter, bson.E{
+			Key:   "createdBy",
+			Value: scope.ownerID,
+		})
+	}
+	return filter
+}
+
+func (ic *IdeaController) GetIdeaByID(ideaID primitive.ObjectID, scope IdeaScope) (*models.Idea, error) {
+	var idea models.Idea
+
+	query := ownedIdeaFilter(ideaID, scope)
 
 	err := ic.ideacollection.FindOne(ic.ctx, query).Decode(&idea)
 	if err != nil {
@@ -128,34 +341,189 @@ func (ic *IdeaController) GetIdeaByID(ideaID primitive.ObjectID) (*models.Idea,
 	return &idea, nil
 }
 
-func (ic *IdeaController) UpdateIdea(idea *models.Idea) error {
+// updateIdea sets the fields of idea on the idea matching filter and moves
+// it from its stored state to the updated one in the rollups.
+func (ic *IdeaController) updateIdea(filter bson.D, idea *models.Idea, loc *time.Location) error {
+	_, err := withTransaction(ic.ctx, ic.ideacollection, func(sc mongo.SessionContext) (interface{}, error) {
+		// the owner is only known from the stored idea for admins
+		var recorded models.Idea
+		if err := ic.ideacollection.FindOne(sc, filter).Decode(&recorded); err != nil {
+			return nil, err
+		}
+		seq, err := ic.sequence.next(sc, recorded.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		idea.SyncSeq = seq
+		var updated models.Idea
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := ic.ideacollection.FindOneAndUpdate(sc, filter, bson.M{"$set": idea}, opts).Decode(&updated); err != nil {
+			return nil, err
+		}
+		if IdeaDailyStats(&recorded, loc) == IdeaDailyStats(&updated, loc) {
+			return nil, nil
+		}
+		if err := ic.rollups.remove(sc, &recorded, loc); err != nil {
+			return nil, err
+		}
+		return nil, ic.rollups.add(sc, &updated, loc)
+	})
+	return err
+}
+
+func (ic *IdeaController) UpdateIdea(idea *models.Idea, scope IdeaScope, loc *time.Location) error {
+	return ic.updateIdea(ownedIdeaFilter(idea.ID, scope), idea, loc)
+}
+
+// UpdateIdeaIfUnchanged updates idea like UpdateIdea, as long as it was
+// last updated at updatedAt.
+func (ic *IdeaController) UpdateIdeaIfUnchanged(idea *models.Idea, scope IdeaScope, updatedAt time.Time, loc *time.Location) error {
+	return ic.updateIdea(append(ownedIdeaFilter(idea.ID, scope), bson.E{Key: "updatedAt", Value: updatedAt}), idea, loc)
+}
+
+// deleteIdea deletes the idea matching filter, takes it out of its rollup
+// and leaves a tombstone.
+func (ic *IdeaController) deleteIdea(filter bson.D, loc *time.Location) error {
+	_, err := withTransaction(ic.ctx, ic.ideacollection, func(sc mongo.SessionContext) (interface{}, error) {
+		var idea models.Idea
+		if err := ic.ideacollection.FindOneAndDelete(sc, filter).Decode(&idea); err != nil {
+			return nil, err
+		}
+		if err := ic.rollups.remove(sc, &idea, loc); err != nil {
+			return nil, err
+		}
+		seq, err := ic.sequence.next(sc, idea.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		tombstone := models.Tombstone{IdeaID: idea.ID, CreatedBy: idea.CreatedBy, DeletedAt: time.Now(), SyncSeq: seq}
+		if _, err := ic.tombstonecollection.InsertOne(sc, tombstone); err != nil {
+			return nil, errors.Wrap(err, "Error in recording deletion")
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (ic *IdeaController) DeleteIdea(ideaID primitive.ObjectID, scope IdeaScope, loc *time.Location) error {
+	return ic.deleteIdea(ownedIdeaFilter(ideaID, scope), loc)
+}
+
+// DeleteIdeaIfUnchanged deletes an idea like DeleteIdea, as long as it was
+// last updated at updatedAt.
+func (ic *IdeaController) DeleteIdeaIfUnchanged(ideaID primitive.ObjectID, scope IdeaScope, updatedAt time.Time, loc *time.Location) error {
+	return ic.deleteIdea(append(ownedIdeaFilter(ideaID, scope), bson.E{Key: "updatedAt", Value: updatedAt}), loc)
+}
+
+// GetSyncSequence returns the last number of the sync sequence of the user.
+// Every write up to it is committed.
+func (ic *IdeaController) GetSyncSequence(userID primitive.ObjectID) (int64, error) {
+	return ic.sequence.current(ic.ctx, userID)
+}
+
+// syncPositionFilter matches the records of the user after the position of
+// after, if given, up to number until of the sync sequence. Records written
+// before the sequence existed count as number 0.
+func syncPositionFilter(userID primitive.ObjectID, after *models.SyncPosition, until int64) bson.M {
+	seq := func(n int64) interface{} {
+		if n == 0 {
+			return bson.M{"$in": bson.A{nil, int64(0)}}
+		}
+		return n
+	}
+	clauses := []bson.M{{"$or": []bson.M{{"syncSeq": bson.M{"$lte": until}}, {"syncSeq": nil}}}}
+	if after != nil && after.ID.IsZero() {
+		clauses = append(clauses, bson.M{"syncSeq": bson.M{"$gt": after.Seq}})
+	} else if after != nil {
+		clauses = append(clauses, bson.M{"$or": []bson.M{
+			{"syncSeq": bson.M{"$gt": after.Seq}},
+			{"syncSeq": seq(after.Seq), "_id": bson.M{"$gt": after.ID}},
+		}})
+	}
+	return bson.M{"createdBy": userID, "$and": clauses}
+}
+
+// syncOrder sorts by sync sequence number and then _id.
+var syncOrder = bson.D{bson.E{Key: "syncSeq", Value: 1}, bson.E{Key: "_id", Value: 1}}
+
+// GetChangedIdeas returns up to limit ideas of the user written after the
+// position of after, if given, up to number until of the sync sequence, in
+// the order they were written. It reports whether there are more.
+func (ic *IdeaController) GetChangedIdeas(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Idea, bool, error) {
+	opts := options.Find().SetSort(syncOrder).SetLimit(int64(limit + 1))
+
+	ideas := []models.Idea{}
+	cursor, err := ic.ideacollection.Find(ic.ctx, syncPositionFilter(userID, after, until), opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = cursor.All(ic.ctx, &ideas); err != nil {
+		return nil, false, err
+	}
+	if len(ideas) > limit {
+		return ideas[:limit], true, nil
+	}
+	return ideas, false, nil
+}
+
+// GetTombstones returns up to limit deletions of the user after the
+// position of after, if given, up to number until of the sync sequence,
+// oldest first. It reports whether there are more.
+func (ic *IdeaController) GetTombstones(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Tombstone, bool, error) {
+	opts := options.Find().SetSort(syncOrder).SetLimit(int64(limit + 1))
+
+	tombstones := []models.Tombstone{}
+	cursor, err := ic.tombstonecollection.Find(ic.ctx, syncPositionFilter(userID, after, until), opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = cursor.All(ic.ctx, &tombstones); err != nil {
+		return nil, false, err
+	}
+	if len(tombstones) > limit {
+		return tombstones[:limit], true, nil
+	}
+	return tombstones, false, nil
+}
+
+// DeleteTombstonesOfUser deletes the sync state of the user, its
+// tombstones and its sync sequence.
+func (ic *IdeaController) DeleteTombstonesOfUser(userID primitive.ObjectID) (int64, error) {
 	filter := bson.D{
 		bson.E{
-			Key:   "_id",
-			Value: idea.ID,
+			Key:   "createdBy",
+			Value: userID,
 		},
 	}
 
-	_, err := ic.ideacollection.UpdateOne(ic.ctx, filter, bson.M{"$set": idea})
-	return err
+	result, err := ic.tombstonecollection.DeleteMany(ic.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if err := ic.sequence.delete(ic.ctx, userID); err != nil {
+		return result.DeletedCount, err
+	}
+	return result.DeletedCount, nil
 }
 
-func (ic *IdeaController) DeleteIdea(ideaID primitive.ObjectID) error {
+func (ic *IdeaController) DeleteIdeasOfUser(userID primitive.ObjectID) (int64, error) {
 	filter := bson.D{
 		bson.E{
-			Key:   "_id",
-			Value: ideaID,
+			Key:   "createdBy",
+			Value: userID,
 		},
 	}
 
-	_, err := ic.ideacollection.DeleteOne(ic.ctx, filter)
-	return err
+	result, err := ic.ideacollection.DeleteMany(ic.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
 }
 
-func (ic *IdeaController) GetTotalIdeasOfToday(userID primitive.ObjectID) ([]bson.M, error) {
-	now := time.Now()
-	year, month, day := now.UTC().Date()
-	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+// GetTotalIdeasOfToday counts the ideas and sessions since midnight in loc.
+func (ic *IdeaController) GetTotalIdeasOfToday(userID primitive.ObjectID, loc *time.Location) ([]bson.M, error) {
+	today := utils.StartOfDay(ic.now(), loc)
 
 	matchStage := bson.D{
 		bson.E{
@@ -289,56 +657,498 @@ func (ic *IdeaController) GetTotalIdeasOfAllTime(userID primitive.ObjectID) ([]b
 	return results, nil
 }
 
-func (ic *IdeaController) GetTotalConsecutiveDays(userID primitive.ObjectID) (int, error) {
-	now := time.Now()
-	year, month, day := now.UTC().Date()
-	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+// createdBetween matches the ideas of the user created between from
+// (inclusive) and to (exclusive). Zero times leave the range open, like
+// they do for the rollups, see activeRollups.
+func createdBetween(userID primitive.ObjectID, from time.Time, to time.Time) bson.D {
+	match := bson.D{bson.E{Key: "createdBy", Value: userID}}
+	createdAt := bson.D{}
+	if !from.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: to})
+	}
+	if len(createdAt) > 0 {
+		match = append(match, bson.E{Key: "createdAt", Value: createdAt})
+	}
+	return bson.D{bson.E{Key: "$match", Value: match}}
+}
+
+// GetDailyCounts returns the sessions and ideas of every active day in loc
+// between from (inclusive) and to (exclusive), oldest first.
+func (ic *IdeaController) GetDailyCounts(userID primitive.ObjectID, from time.Time, to time.Time, loc *time.Location) ([]models.DailyCount, error) {
+	matchStage := createdBetween(userID, from, to)
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{
+					Key: "_id",
+					Value: bson.D{
+						bson.E{
+							Key: "$dateToString",
+							Value: bson.D{
+								bson.E{Key: "format", Value: "%Y-%m-%d"},
+								bson.E{Key: "date", Value: "$createdAt"},
+								bson.E{Key: "timezone", Value: loc.String()},
+							},
+						},
+					},
+				},
+				bson.E{
+					Key: "totalIdeas",
+					Value: bson.D{
+						bson.E{
+							Key: "$sum",
+							Value: bson.D{
+								bson.E{Key: "$size", Value: bson.D{bson.E{Key: "$ifNull", Value: bson.A{"$ideas", bson.A{}}}}},
+							},
+						},
+					},
+				},
+				bson.E{Key: "totalSessions", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, groupStage, sortStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating daily counts")
+	}
+
+	counts := []models.DailyCount{}
+	if err = cursor.All(ic.ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
 
-	var consecutiveDays int = 0
-	var isConsecutive bool = true
+// GetCategories returns the distinct categories the user has sessions in.
+func (ic *IdeaController) GetCategories(userID primitive.ObjectID) ([]string, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
 
-	for {
-		dateFrom := today.AddDate(0, 0, (-1)*consecutiveDays-1)
-		dateTo := today.AddDate(0, 0, (-1)*consecutiveDays)
+	values, err := ic.ideacollection.Distinct(ic.ctx, "category", filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in getting distinct categories")
+	}
+	categories := make([]string, 0, len(values))
+	for _, value := range values {
+		if category, ok := value.(string); ok {
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
 
-		filter := bson.D{
-			{
-				Key:   "createdBy",
-				Value: userID,
+// GetTags counts the sessions of the user per tag, most used first. A
+// non-empty prefix restricts the tags to those starting with it.
+func (ic *IdeaController) GetTags(userID primitive.ObjectID, prefix string, limit int) ([]models.TagCount, error) {
+	tagFilter := bson.D{bson.E{Key: "$exists", Value: true}}
+	if prefix != "" {
+		tagFilter = bson.D{bson.E{Key: "$regex", Value: "^" + regexp.QuoteMeta(prefix)}}
+	}
+
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "tags", Value: tagFilter},
 			},
-			{
-				Key: "createdAt",
-				Value: bson.D{
-					{
-						Key:   "$gte",
-						Value: dateFrom,
+		},
+	}
+	unwindStage := bson.D{bson.E{Key: "$unwind", Value: "$tags"}}
+	// the other tags of matching sessions are unwound as well
+	matchTagStage := bson.D{bson.E{Key: "$match", Value: bson.D{bson.E{Key: "tags", Value: tagFilter}}}}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: "$tags"},
+				bson.E{Key: "count", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "count", Value: -1}, bson.E{Key: "_id", Value: 1}}}}
+	limitStage := bson.D{bson.E{Key: "$limit", Value: limit}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, unwindStage, matchTagStage, groupStage, sortStage, limitStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating tags")
+	}
+
+	tags := []models.TagCount{}
+	if err = cursor.All(ic.ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetDailyStats aggregates the rollups of the user from the idea records,
+// with the days cut in loc. See DailyStatsController.
+func (ic *IdeaController) GetDailyStats(userID primitive.ObjectID, loc *time.Location) ([]models.DailyStats, error) {
+	return ic.dailyStats(ic.ctx, userID, loc)
+}
+
+// RebuildDailyStats replaces the rollups of the user with ones aggregated
+// from the idea records, with the days cut in loc. The aggregation and the
+// swap run in one transaction: a concurrent idea write changing a rollup
+// the swap replaces conflicts with it, and the rebuild is retried.
+func (ic *IdeaController) RebuildDailyStats(userID primitive.ObjectID, loc *time.Location) error {
+	_, err := withTransaction(ic.ctx, ic.ideacollection, func(sc mongo.SessionContext) (interface{}, error) {
+		stats, err := ic.dailyStats(sc, userID, loc)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ic.rollups.replace(sc, userID, stats)
+	})
+	return err
+}
+
+func (ic *IdeaController) dailyStats(ctx context.Context, userID primitive.ObjectID, loc *time.Location) ([]models.DailyStats, error) {
+	ideaCount := bson.D{bson.E{Key: "$size", Value: bson.D{bson.E{Key: "$ifNull", Value: bson.A{"$ideas", bson.A{}}}}}}
+	timed := bson.D{bson.E{Key: "$gt", Value: bson.A{"$duration", 0}}}
+
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "createdAt", Value: bson.D{bson.E{Key: "$type", Value: "date"}}},
+			},
+		},
+	}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{
+					Key: "_id",
+					Value: bson.D{
+						bson.E{
+							Key: "day",
+							Value: bson.D{
+								bson.E{
+									Key: "$dateFromString",
+									Value: bson.D{
+										bson.E{
+											Key: "dateString",
+											Value: bson.D{
+												bson.E{
+													Key: "$dateToString",
+													Value: bson.D{
+														bson.E{Key: "format", Value: "%Y-%m-%d"},
+														bson.E{Key: "date", Value: "$createdAt"},
+														bson.E{Key: "timezone", Value: loc.String()},
+													},
+												},
+											},
+										},
+										bson.E{Key: "format", Value: "%Y-%m-%d"},
+										bson.E{Key: "timezone", Value: loc.String()},
+									},
+								},
+							},
+						},
+						bson.E{Key: "category", Value: "$category"},
 					},
-					{
-						Key:   "$lt",
-						Value: dateTo,
+				},
+				bson.E{Key: "sessions", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+				bson.E{Key: "ideas", Value: bson.D{bson.E{Key: "$sum", Value: ideaCount}}},
+				bson.E{
+					Key: "liked",
+					Value: bson.D{
+						bson.E{
+							Key:   "$sum",
+							Value: bson.D{bson.E{Key: "$cond", Value: bson.A{bson.D{bson.E{Key: "$eq", Value: bson.A{"$isLiked", true}}}, 1, 0}}},
+						},
 					},
 				},
+				bson.E{Key: "timedSessions", Value: bson.D{bson.E{Key: "$sum", Value: bson.D{bson.E{Key: "$cond", Value: bson.A{timed, 1, 0}}}}}},
+				bson.E{Key: "timedIdeas", Value: bson.D{bson.E{Key: "$sum", Value: bson.D{bson.E{Key: "$cond", Value: bson.A{timed, ideaCount, 0}}}}}},
+				bson.E{Key: "seconds", Value: bson.D{bson.E{Key: "$sum", Value: bson.D{bson.E{Key: "$cond", Value: bson.A{timed, "$duration", 0}}}}}},
 			},
-		}
+		},
+	}
 
-		numOfDoc, err := ic.ideacollection.CountDocuments(ic.ctx, filter)
+	cursor, err := ic.ideacollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating daily stats")
+	}
+
+	var results []struct {
+		Key struct {
+			Day      time.Time `bson:"day"`
+			Category string    `bson:"category"`
+		} `bson:"_id"`
+		Sessions      int     `bson:"sessions"`
+		Ideas         int     `bson:"ideas"`
+		Liked         int     `bson:"liked"`
+		TimedSessions int     `bson:"timedSessions"`
+		TimedIdeas    int     `bson:"timedIdeas"`
+		Seconds       float64 `bson:"seconds"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	stats := make([]models.DailyStats, 0, len(results))
+	for _, result := range results {
+		stats = append(stats, models.DailyStats{
+			UserID:        userID,
+			Day:           result.Key.Day.In(loc),
+			Timezone:      loc.String(),
+			Category:      result.Key.Category,
+			Sessions:      result.Sessions,
+			Ideas:         result.Ideas,
+			Liked:         result.Liked,
+			TimedSessions: result.TimedSessions,
+			TimedIdeas:    result.TimedIdeas,
+			Seconds:       result.Seconds,
+		})
+	}
+	return stats, nil
+}
+
+// GetCategoryCounts sums up sessions, ideas and liked sessions per category
+// for the sessions created between from (inclusive) and to (exclusive).
+func (ic *IdeaController) GetCategoryCounts(userID primitive.ObjectID, from time.Time, to time.Time) ([]models.CategoryCounts, error) {
+	matchStage := createdBetween(userID, from, to)
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: "$category"},
+				bson.E{Key: "sessions", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+				bson.E{
+					Key: "ideas",
+					Value: bson.D{
+						bson.E{
+							Key: "$sum",
+							Value: bson.D{
+								bson.E{Key: "$size", Value: bson.D{bson.E{Key: "$ifNull", Value: bson.A{"$ideas", bson.A{}}}}},
+							},
+						},
+					},
+				},
+				bson.E{
+					Key: "liked",
+					Value: bson.D{
+						bson.E{
+							Key:   "$sum",
+							Value: bson.D{bson.E{Key: "$cond", Value: bson.A{bson.D{bson.E{Key: "$eq", Value: bson.A{"$isLiked", true}}}, 1, 0}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "sessions", Value: -1}, bson.E{Key: "_id", Value: 1}}}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, groupStage, sortStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating categories")
+	}
+
+	counts := []models.CategoryCounts{}
+	if err = cursor.All(ic.ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetRevisitedTopics returns the topic titles with more than one session,
+// most revisited first. Untitled sessions are left out.
+func (ic *IdeaController) GetRevisitedTopics(userID primitive.ObjectID, limit int) ([]models.TopicHistory, error) {
+	normalizedTitle := bson.D{bson.E{Key: "$toLower", Value: bson.D{bson.E{Key: "$trim", Value: bson.D{bson.E{Key: "input", Value: "$topicTitle"}}}}}}
+
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "topicTitle", Value: bson.D{bson.E{Key: "$type", Value: "string"}}},
+			},
+		},
+	}
+	sortByDateStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "createdAt", Value: 1}}}}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: normalizedTitle},
+				bson.E{Key: "topicTitle", Value: bson.D{bson.E{Key: "$last", Value: "$topicTitle"}}},
+				bson.E{
+					Key: "attempts",
+					Value: bson.D{
+						bson.E{
+							Key: "$push",
+							Value: bson.D{
+								bson.E{Key: "ideaId", Value: "$_id"},
+								bson.E{Key: "createdAt", Value: "$createdAt"},
+								bson.E{Key: "ideas", Value: bson.D{bson.E{Key: "$size", Value: bson.D{bson.E{Key: "$ifNull", Value: bson.A{"$ideas", bson.A{}}}}}}},
+							},
+						},
+					},
+				},
+				bson.E{Key: "count", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+			},
+		},
+	}
+	revisitedStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$nin", Value: bson.A{"", "untitled"}}}},
+				bson.E{Key: "count", Value: bson.D{bson.E{Key: "$gt", Value: 1}}},
+			},
+		},
+	}
+	sortByCountStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "count", Value: -1}, bson.E{Key: "_id", Value: 1}}}}
+	limitStage := bson.D{bson.E{Key: "$limit", Value: limit}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, sortByDateStage, groupStage, revisitedStage, sortByCountStage, limitStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating topics")
+	}
+
+	topics := []models.TopicHistory{}
+	if err = cursor.All(ic.ctx, &topics); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// GetStreaks computes the current and the longest streak of active days in
+// loc from a single aggregation over the distinct days with a session.
+func (ic *IdeaController) GetStreaks(userID primitive.ObjectID, loc *time.Location, freezes int) (*models.Streaks, error) {
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "createdAt", Value: bson.D{bson.E{Key: "$type", Value: "date"}}},
+			},
+		},
+	}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{
+					Key: "_id",
+					Value: bson.D{
+						bson.E{
+							Key: "$dateToString",
+							Value: bson.D{
+								bson.E{Key: "format", Value: "%Y-%m-%d"},
+								bson.E{Key: "date", Value: "$createdAt"},
+								bson.E{Key: "timezone", Value: loc.String()},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, groupStage, sortStage})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in aggregating active days")
+	}
 
+	var results []struct {
+		Day string `bson:"_id"`
+	}
+	if err = cursor.All(ic.ctx, &results); err != nil {
+		return nil, err
+	}
+
+	days := make([]string, 0, len(results))
+	for _, result := range results {
+		days = append(days, result.Day)
+	}
+	return computeStreaks(days, utils.StartOfDay(ic.now(), loc).Format("2006-01-02"), freezes)
+}
+
+// computeStreaks derives the streaks from the sorted active days. A streak
+// may skip up to freezes days in total; the current streak ends today or,
+// while today has no session yet, yesterday.
+func computeStreaks(days []string, today string, freezes int) (*models.Streaks, error) {
+	streaks := &models.Streaks{Freezes: freezes}
+	if len(days) == 0 {
+		return streaks, nil
+	}
+
+	dayNumber := func(day string) (int, error) {
+		t, err := time.Parse("2006-01-02", day)
 		if err != nil {
-			return 0, errors.Wrap(err, "error while counting documents")
+			return 0, errors.Wrapf(err, "invalid day %v", day)
 		}
+		return int(t.Unix() / 86400), nil
+	}
 
-		if numOfDoc > 0 {
-			consecutiveDays++
-		} else {
-			isConsecutive = false
+	numbers := make([]int, len(days))
+	for i, day := range days {
+		n, err := dayNumber(day)
+		if err != nil {
+			return nil, err
 		}
+		numbers[i] = n
+	}
+	todayNumber, err := dayNumber(today)
+	if err != nil {
+		return nil, err
+	}
 
-		if !isConsecutive {
-			break
+	// missed days between an active day and the one before it
+	gap := func(i int) int {
+		return numbers[i] - numbers[i-1] - 1
+	}
+
+	// longest window of active days whose gaps fit into the freezes
+	first, missed := 0, 0
+	for last := range numbers {
+		if last > 0 {
+			missed += gap(last)
+		}
+		for missed > freezes {
+			first++
+			missed -= gap(first)
+		}
+		if length := last - first + 1; length >= streaks.LongestStreak {
+			streaks.LongestStreak = length
+			streaks.LongestStreakStart = days[first]
+			streaks.LongestStreakEnd = days[last]
 		}
 	}
 
-	return consecutiveDays, nil
+	last := len(numbers) - 1
+	streaks.ActiveToday = numbers[last] == todayNumber
+	used := 0
+	if numbers[last] < todayNumber-1 {
+		used = todayNumber - 1 - numbers[last]
+	}
+	if used > freezes {
+		return streaks, nil
+	}
+	first = last
+	for first > 0 && used+gap(first) <= freezes {
+		used += gap(first)
+		first--
+	}
+	streaks.CurrentStreak = last - first + 1
+	streaks.CurrentStreakStart = days[first]
+	streaks.FreezesUsed = used
+	return streaks, nil
 }
 
 func (ic *IdeaController) GetRecentIdeas(userID primitive.ObjectID) ([]*models.Idea, error) {
@@ -370,15 +1180,9 @@ func (ic *IdeaController) GetRecentIdeas(userID primitive.ObjectID) ([]*models.I
 	return ideas, nil
 }
 
-func (ic *IdeaController) GetWeeklyIdeas(userID primitive.ObjectID) ([]bson.M, time.Time, error) {
-	// get first day of week
-	weekday := time.Duration(time.Now().Weekday())
-	if weekday == 0 {
-		weekday = 7
-	}
-	year, month, day := time.Now().Date()
-	currentZeroDay := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
-	lastMonday := currentZeroDay.Add(-1 * (weekday - 1) * 24 * time.Hour)
+// GetWeeklyIdeas groups the ideas since Monday by day, both in loc.
+func (ic *IdeaController) GetWeeklyIdeas(userID primitive.ObjectID, loc *time.Location) ([]bson.M, time.Time, error) {
+	lastMonday := utils.StartOfWeek(ic.now(), loc)
 
 	matchStage := bson.D{
 		bson.E{
@@ -418,6 +1222,10 @@ func (ic *IdeaController) GetWeeklyIdeas(userID primitive.ObjectID) ([]bson.M, t
 									Key:   "date",
 									Value: "$createdAt",
 								},
+								bson.E{
+									Key:   "timezone",
+									Value: loc.String(),
+								},
 							},
 						},
 					},
@@ -464,6 +1272,130 @@ func (ic *IdeaController) GetWeeklyIdeas(userID primitive.ObjectID) ([]bson.M, t
 
 }
 
+// GetTimesToFirstIdea returns the offset of the first idea of every session
+// with recorded offsets in ascending order, in milliseconds.
+func (ic *IdeaController) GetTimesToFirstIdea(userID primitive.ObjectID) ([]int64, error) {
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "ideas.offset", Value: bson.D{bson.E{Key: "$exists", Value: true}}},
+			},
+		},
+	}
+	// legacy string entries have no offset and are skipped by $min
+	projectStage := bson.D{
+		bson.E{
+			Key: "$project",
+			Value: bson.D{
+				bson.E{Key: "_id", Value: 0},
+				bson.E{Key: "first", Value: bson.D{bson.E{Key: "$min", Value: "$ideas.offset"}}},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "first", Value: 1}}}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, projectStage, sortStage})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		First int64 `bson:"first"`
+	}
+	if err = cursor.All(ic.ctx, &results); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, 0, len(results))
+	for _, result := range results {
+		offsets = append(offsets, result.First)
+	}
+	return offsets, nil
+}
+
+// IdeaPaceIntervals maps the intervals of GetIdeasPerMinute to their
+// $dateToString formats.
+var IdeaPaceIntervals = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+// GetIdeasPerMinute groups the sessions with a recorded duration by interval
+// in loc and returns the ideas per minute of every period, oldest first.
+func (ic *IdeaController) GetIdeasPerMinute(userID primitive.ObjectID, interval string, loc *time.Location) ([]bson.M, error) {
+	format, ok := IdeaPaceIntervals[interval]
+	if !ok {
+		return nil, errors.Errorf("invalid interval %v", interval)
+	}
+
+	matchStage := bson.D{
+		bson.E{
+			Key: "$match",
+			Value: bson.D{
+				bson.E{Key: "createdBy", Value: userID},
+				bson.E{Key: "duration", Value: bson.D{bson.E{Key: "$gt", Value: 0}}},
+			},
+		},
+	}
+	groupStage := bson.D{
+		bson.E{
+			Key: "$group",
+			Value: bson.D{
+				bson.E{
+					Key: "_id",
+					Value: bson.D{
+						bson.E{
+							Key: "$dateToString",
+							Value: bson.D{
+								bson.E{Key: "format", Value: format},
+								bson.E{Key: "date", Value: "$createdAt"},
+								bson.E{Key: "timezone", Value: loc.String()},
+							},
+						},
+					},
+				},
+				bson.E{Key: "totalIdeas", Value: bson.D{bson.E{Key: "$sum", Value: bson.D{bson.E{Key: "$size", Value: "$ideas"}}}}},
+				bson.E{Key: "totalSeconds", Value: bson.D{bson.E{Key: "$sum", Value: "$duration"}}},
+				bson.E{Key: "totalSessions", Value: bson.D{bson.E{Key: "$sum", Value: 1}}},
+			},
+		},
+	}
+	projectStage := bson.D{
+		bson.E{
+			Key: "$project",
+			Value: bson.D{
+				bson.E{Key: "totalIdeas", Value: 1},
+				bson.E{Key: "totalSeconds", Value: 1},
+				bson.E{Key: "totalSessions", Value: 1},
+				bson.E{
+					Key: "ideasPerMinute",
+					Value: bson.D{
+						bson.E{
+							Key:   "$divide",
+							Value: bson.A{"$totalIdeas", bson.D{bson.E{Key: "$divide", Value: bson.A{"$totalSeconds", 60}}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	sortStage := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+
+	cursor, err := ic.ideacollection.Aggregate(ic.ctx, mongo.Pipeline{matchStage, groupStage, projectStage, sortStage})
+	if err != nil {
+		return nil, err
+	}
+
+	results := []bson.M{}
+	if err = cursor.All(ic.ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (ic *IdeaController) Search(filter bson.M, sort int, page int, limit int) ([]models.Idea, *paginate.PaginatedData, error) {
 
 	collation := options.Collation{
@@ -478,3 +1410,108 @@ func (ic *IdeaController) Search(filter bson.M, sort int, page int, limit int) (
 	}
 	return ideas, paginatedData, nil
 }
+
+// ideaTime returns the time field of idea that cursors page by.
+func ideaTime(idea *models.Idea, field string) time.Time {
+	if field == "updatedAt" {
+		return idea.UpdatedAt
+	}
+	return idea.CreatedAt
+}
+
+// FindPage lists limit ideas matching filter sorted by field, createdAt or
+// updatedAt, and then _id, both in order. The page starts after cursor, or
+// ends before it for backward cursors; a nil cursor starts at the top.
+// Unlike offset pages it stays stable while ideas are added or removed.
+func (ic *IdeaController) FindPage(filter bson.M, field string, order int, cursor *models.Cursor, limit int) ([]models.Idea, *models.CursorPage, error) {
+	backward := cursor != nil && cursor.Before
+	// backward pages are read in reverse and turned around
+	direction := order
+	if backward {
+		direction = -order
+	}
+
+	query := filter
+	if cursor != nil {
+		compare := "$gt"
+		if direction < 0 {
+			compare = "$lt"
+		}
+		query = bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+			{field: bson.M{compare: cursor.Time}},
+			{field: cursor.Time, "_id": bson.M{compare: cursor.ID}},
+		}}}}
+	}
+	collation := options.Collation{
+		Locale:   "en",
+		Strength: 1,
+	}
+	opts := options.Find().
+		SetCollation(&collation).
+		SetSort(bson.D{bson.E{Key: field, Value: direction}, bson.E{Key: "_id", Value: direction}}).
+		// one more tells whether there is a further page
+		SetLimit(int64(limit + 1))
+
+	ideas := []models.Idea{}
+	cursorResult, err := ic.ideacollection.Find(ic.ctx, query, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cursorResult.All(ic.ctx, &ideas); err != nil {
+		return nil, nil, err
+	}
+	more := len(ideas) > limit
+	if more {
+		ideas = ideas[:limit]
+	}
+	if backward {
+		for i, j := 0, len(ideas)-1; i < j; i, j = i+1, j-1 {
+			ideas[i], ideas[j] = ideas[j], ideas[i]
+		}
+	}
+
+	page := &models.CursorPage{Limit: limit}
+	if len(ideas) == 0 {
+		// an empty page still leads back to where it came from
+		if cursor != nil {
+			turned := *cursor
+			turned.Before = !cursor.Before
+			if backward {
+				page.Next = turned.Encode()
+			} else {
+				page.Prev = turned.Encode()
+			}
+		}
+		return ideas, page, nil
+	}
+	first, last := &ideas[0], &ideas[len(ideas)-1]
+	if (backward && more) || (!backward && cursor != nil) {
+		page.Prev = (&models.Cursor{Field: field, Order: order, Time: ideaTime(first, field), ID: first.ID, Before: true}).Encode()
+	}
+	if backward || more {
+		page.Next = (&models.Cursor{Field: field, Order: order, Time: ideaTime(last, field), ID: last.ID}).Encode()
+	}
+	return ideas, page, nil
+}
+
+// SearchByRelevance runs a text search of search within filter, best
+// matches first. It fails with ErrTextIndexMissing while the text index is
+// not built.
+func (ic *IdeaController) SearchByRelevance(filter bson.M, search string, page int, limit int) ([]models.IdeaSearchResult, *paginate.PaginatedData, error) {
+	textFilter := bson.M{"$text": bson.M{"$search": search}}
+	for key, value := range filter {
+		textFilter[key] = value
+	}
+	score := bson.M{"$meta": "textScore"}
+
+	results := []models.IdeaSearchResult{}
+	paginatedData, err := paginate.New(ic.ideacollection).Context(ic.ctx).Limit(int64(limit)).Page(int64(page)).Select(bson.M{"score": score}).Sort("score", score).Sort("updatedAt", -1).Filter(textFilter).Decode(&results).Find()
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(indexNotFoundCode) {
+		return nil, nil, errors.Wrap(ErrTextIndexMissing, err.Error())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, paginatedData, nil
+}
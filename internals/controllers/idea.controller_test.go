@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"idea-training-version-go/internals/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestComputeStreaks(t *testing.T) {
+	cases := []struct {
+		name    string
+		days    []string
+		today   string
+		freezes int
+		want    models.Streaks
+	}{
+		{
+			name:  "no sessions",
+			today: "2023-03-10",
+			want:  models.Streaks{},
+		},
+		{
+			name:  "active today",
+			days:  []string{"2023-03-01", "2023-03-02", "2023-03-08", "2023-03-09", "2023-03-10"},
+			today: "2023-03-10",
+			want: models.Streaks{
+				CurrentStreak: 3, CurrentStreakStart: "2023-03-08", ActiveToday: true,
+				LongestStreak: 3, LongestStreakStart: "2023-03-08", LongestStreakEnd: "2023-03-10",
+			},
+		},
+		{
+			name:  "today still open",
+			days:  []string{"2023-03-08", "2023-03-09"},
+			today: "2023-03-10",
+			want: models.Streaks{
+				CurrentStreak: 2, CurrentStreakStart: "2023-03-08",
+				LongestStreak: 2, LongestStreakStart: "2023-03-08", LongestStreakEnd: "2023-03-09",
+			},
+		},
+		{
+			name:  "broken streak",
+			days:  []string{"2023-02-01", "2023-02-02", "2023-02-03", "2023-03-07", "2023-03-08"},
+			today: "2023-03-10",
+			want: models.Streaks{
+				LongestStreak: 3, LongestStreakStart: "2023-02-01", LongestStreakEnd: "2023-02-03",
+			},
+		},
+		{
+			// the missed 9th counts against the freezes of the current streak
+			name:    "freezes bridge missed days",
+			days:    []string{"2023-03-01", "2023-03-02", "2023-03-04", "2023-03-05", "2023-03-08"},
+			today:   "2023-03-10",
+			freezes: 3,
+			want: models.Streaks{
+				CurrentStreak: 3, CurrentStreakStart: "2023-03-04", FreezesUsed: 3,
+				LongestStreak: 5, LongestStreakStart: "2023-03-01", LongestStreakEnd: "2023-03-08",
+				Freezes: 3,
+			},
+		},
+		{
+			name:    "longest streak with freezes",
+			days:    []string{"2023-01-01", "2023-01-03", "2023-01-04", "2023-01-06", "2023-01-07", "2023-01-08", "2023-03-10"},
+			today:   "2023-03-10",
+			freezes: 1,
+			want: models.Streaks{
+				CurrentStreak: 1, CurrentStreakStart: "2023-03-10", ActiveToday: true,
+				LongestStreak: 5, LongestStreakStart: "2023-01-03", LongestStreakEnd: "2023-01-08",
+				Freezes: 1,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := computeStreaks(c.days, c.today, c.freezes)
+		if err != nil {
+			t.Errorf("TestComputeStreaks %v: %v", c.name, err)
+			continue
+		}
+		if *got != c.want {
+			t.Errorf("TestComputeStreaks %v: expected %+v, got %+v", c.name, c.want, *got)
+		}
+	}
+
+	if _, err := computeStreaks([]string{"10/03/2023"}, "2023-03-10", 0); err == nil {
+		t.Errorf("TestComputeStreaks: expected invalid days to fail")
+	}
+}
+
+func TestIdeaScope(t *testing.T) {
+	ideaID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	cases := []struct {
+		name     string
+		scope    IdeaScope
+		filter   bson.D
+		includes bool
+	}{
+		{
+			name:     "owned",
+			scope:    OwnedBy(ownerID),
+			filter:   bson.D{{Key: "_id", Value: ideaID}, {Key: "createdBy", Value: ownerID}},
+			includes: true,
+		},
+		{
+			name:     "any owner",
+			scope:    AnyIdeaOwner(),
+			filter:   bson.D{{Key: "_id", Value: ideaID}},
+			includes: true,
+		},
+		{
+			// a failed user lookup must not reach the ideas of every user
+			name:   "missing owner",
+			scope:  OwnedBy(primitive.NilObjectID),
+			filter: bson.D{{Key: "_id", Value: ideaID}, {Key: "createdBy", Value: primitive.NilObjectID}},
+		},
+		{
+			name:   "zero scope",
+			filter: bson.D{{Key: "_id", Value: ideaID}, {Key: "createdBy", Value: primitive.NilObjectID}},
+		},
+	}
+
+	for _, c := range cases {
+		if got := ownedIdeaFilter(ideaID, c.scope); !reflect.DeepEqual(got, c.filter) {
+			t.Errorf("TestIdeaScope %v: expected filter %v, got %v", c.name, c.filter, got)
+		}
+		if got := c.scope.Includes(ownerID); got != c.includes {
+			t.Errorf("TestIdeaScope %v: expected includes %v, got %v", c.name, c.includes, got)
+		}
+	}
+	if OwnedBy(primitive.NilObjectID).Includes(primitive.NilObjectID) {
+		t.Errorf("TestIdeaScope: expected a missing owner to include no idea")
+	}
+}
+
+func TestCreatedBetween(t *testing.T) {
+	userID := primitive.NewObjectID()
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	// the idea records and the rollups are limited to the same range
+	rangeOf := func(match bson.D, field string) interface{} {
+		for _, e := range match[0].Value.(bson.D) {
+			if e.Key == field {
+				return e.Value
+			}
+		}
+		return nil
+	}
+	for _, c := range []struct {
+		name     string
+		from, to time.Time
+	}{
+		{"closed", from, to},
+		{"open start", time.Time{}, to},
+		{"open end", from, time.Time{}},
+		{"all time", time.Time{}, time.Time{}},
+	} {
+		ideas := rangeOf(createdBetween(userID, c.from, c.to), "createdAt")
+		rollups := rangeOf(activeRollups(userID, c.from, c.to), "day")
+		if !reflect.DeepEqual(ideas, rollups) {
+			t.Errorf("TestCreatedBetween %v: expected the range %v of the rollups, got %v", c.name, rollups, ideas)
+		}
+	}
+}
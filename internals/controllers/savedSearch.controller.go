@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// saved search names are compared regardless of case
+var savedSearchCollation = &options.Collation{Locale: "en", Strength: 2}
+
+type SavedSearchController struct {
+	savedsearchcollection *mongo.Collection
+	ctx                   context.Context
+}
+
+type ISavedSearchController interface {
+	CreateIndexes() error
+	CreateSavedSearch(search *models.SavedSearch) (*models.SavedSearch, error)
+	GetSavedSearches(userID primitive.ObjectID, pinnedOnly bool) ([]*models.SavedSearch, error)
+	GetSavedSearch(searchID primitive.ObjectID, userID primitive.ObjectID) (*models.SavedSearch, error)
+	UpdateSavedSearch(search *models.SavedSearch) error
+	DeleteSavedSearch(searchID primitive.ObjectID, userID primitive.ObjectID) error
+	DeleteSavedSearchesOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewSavedSearchController(savedsearchcollection *mongo.Collection, ctx context.Context) ISavedSearchController {
+	return &SavedSearchController{
+		savedsearchcollection: savedsearchcollection,
+		ctx:                   ctx,
+	}
+}
+
+func (sc *SavedSearchController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(savedSearchCollation),
+	}
+	if _, err := sc.savedsearchcollection.Indexes().CreateOne(sc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating saved searches index")
+	}
+	return nil
+}
+
+// CreateSavedSearch stores search. A name the user already has fails with
+// a duplicate key error.
+func (sc *SavedSearchController) CreateSavedSearch(search *models.SavedSearch) (*models.SavedSearch, error) {
+	search.CreatedAt = time.Now()
+	search.UpdatedAt = search.CreatedAt
+
+	result, err := sc.savedsearchcollection.InsertOne(sc.ctx, search)
+	if err != nil {
+		return nil, err
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("failed to fetch inserted saved search _id")
+	}
+	search.ID = oid
+	return search, nil
+}
+
+// GetSavedSearches returns the saved searches of the user by name, only the
+// pinned ones if pinnedOnly.
+func (sc *SavedSearchController) GetSavedSearches(userID primitive.ObjectID, pinnedOnly bool) ([]*models.SavedSearch, error) {
+	searches := []*models.SavedSearch{}
+
+	query := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	if pinnedOnly {
+		query = append(query, bson.E{Key: "pinned", Value: true})
+	}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "name", Value: 1}}).SetCollation(savedSearchCollation)
+
+	cursor, err := sc.savedsearchcollection.Find(sc.ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(sc.ctx, &searches); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (sc *SavedSearchController) GetSavedSearch(searchID primitive.ObjectID, userID primitive.ObjectID) (*models.SavedSearch, error) {
+	var search *models.SavedSearch
+
+	query := bson.D{
+		bson.E{Key: "_id", Value: searchID},
+		bson.E{Key: "createdBy", Value: userID},
+	}
+	if err := sc.savedsearchcollection.FindOne(sc.ctx, query).Decode(&search); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return search, nil
+}
+
+// UpdateSavedSearch writes the name, request and pin of search.
+func (sc *SavedSearchController) UpdateSavedSearch(search *models.SavedSearch) error {
+	search.UpdatedAt = time.Now()
+	filter := bson.D{
+		bson.E{Key: "_id", Value: search.ID},
+		bson.E{Key: "createdBy", Value: search.CreatedBy},
+	}
+	update := bson.D{
+		bson.E{Key: "$set", Value: bson.D{
+			bson.E{Key: "name", Value: search.Name},
+			bson.E{Key: "request", Value: search.Request},
+			bson.E{Key: "pinned", Value: search.Pinned},
+			bson.E{Key: "updatedAt", Value: search.UpdatedAt},
+		}},
+	}
+
+	result, err := sc.savedsearchcollection.UpdateOne(sc.ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (sc *SavedSearchController) DeleteSavedSearch(searchID primitive.ObjectID, userID primitive.ObjectID) error {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: searchID},
+		bson.E{Key: "createdBy", Value: userID},
+	}
+
+	result, err := sc.savedsearchcollection.DeleteOne(sc.ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (sc *SavedSearchController) DeleteSavedSearchesOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+
+	result, err := sc.savedsearchcollection.DeleteMany(sc.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"idea-training-version-go/internals/models"
+	"time"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionController struct {
+	sessioncollection *mongo.Collection
+	ctx               context.Context
+}
+
+type ISessionController interface {
+	CreateIndexes() error
+	CreateSession(session *models.Session) (*models.Session, error)
+	GetSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID) (*models.Session, error)
+	AddSessionEntry(sessionID primitive.ObjectID, ownerID primitive.ObjectID, entry models.SessionEntry) error
+	FinishSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID, ideaID primitive.ObjectID, finishedAt time.Time) (*models.Session, error)
+	DeleteSessionsOfUser(userID primitive.ObjectID) (int64, error)
+}
+
+func NewSessionController(sessioncollection *mongo.Collection, ctx context.Context) ISessionController {
+	return &SessionController{
+		sessioncollection: sessioncollection,
+		ctx:               ctx,
+	}
+}
+
+func (sc *SessionController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "createdBy", Value: 1}, bson.E{Key: "status", Value: 1}},
+	}
+	if _, err := sc.sessioncollection.Indexes().CreateOne(sc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating sessions index")
+	}
+	return nil
+}
+
+func (sc *SessionController) CreateSession(session *models.Session) (*models.Session, error) {
+	session.CreatedAt = time.Now()
+	session.Status = models.SESSION_ACTIVE
+	if session.Entries == nil {
+		session.Entries = []models.SessionEntry{}
+	}
+
+	result, err := sc.sessioncollection.InsertOne(sc.ctx, session)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in InsertOne")
+	}
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("failed to fetch inserted session _id")
+	}
+	session.ID = oid
+	return session, nil
+}
+
+func (sc *SessionController) GetSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	filter := bson.D{
+		bson.E{Key: "_id", Value: sessionID},
+		bson.E{Key: "createdBy", Value: ownerID},
+	}
+	if err := sc.sessioncollection.FindOne(sc.ctx, filter).Decode(&session); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return &session, nil
+}
+
+// AddSessionEntry appends entry to an active session. It returns
+// mongo.ErrNoDocuments when the session does not exist or is finished.
+func (sc *SessionController) AddSessionEntry(sessionID primitive.ObjectID, ownerID primitive.ObjectID, entry models.SessionEntry) error {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: sessionID},
+		bson.E{Key: "createdBy", Value: ownerID},
+		bson.E{Key: "status", Value: models.SESSION_ACTIVE},
+	}
+	update := bson.M{
+		"$push": bson.M{"entries": entry},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	result, err := sc.sessioncollection.UpdateOne(sc.ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FinishSession moves an active session to finished and records the id of
+// the idea it becomes. Only one of concurrent calls succeeds; the others get
+// mongo.ErrNoDocuments.
+func (sc *SessionController) FinishSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID, ideaID primitive.ObjectID, finishedAt time.Time) (*models.Session, error) {
+	var session models.Session
+	filter := bson.D{
+		bson.E{Key: "_id", Value: sessionID},
+		bson.E{Key: "createdBy", Value: ownerID},
+		bson.E{Key: "status", Value: models.SESSION_ACTIVE},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.SESSION_FINISHED,
+			"finishedAt": finishedAt,
+			"ideaId":     ideaID,
+			"updatedAt":  time.Now(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := sc.sessioncollection.FindOneAndUpdate(sc.ctx, filter, update, opts).Decode(&session); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOneAndUpdate")
+	}
+	return &session, nil
+}
+
+func (sc *SessionController) DeleteSessionsOfUser(userID primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "createdBy",
+			Value: userID,
+		},
+	}
+	result, err := sc.sessioncollection.DeleteMany(sc.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// syncSequence numbers the writes syncing clients pick up, per user. A
+// number is drawn in the transaction of its write, so concurrent writes of
+// a user conflict on the counter and commit in the order of their numbers.
+// Once a number is read as current, every write up to it is committed.
+type syncSequence struct {
+	collection *mongo.Collection
+}
+
+// next draws the next number of the user in the transaction of sc.
+func (s syncSequence) next(sc mongo.SessionContext, userID primitive.ObjectID) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.D{bson.E{Key: "$inc", Value: bson.D{bson.E{Key: "seq", Value: int64(1)}}}}
+	if err := s.collection.FindOneAndUpdate(sc, bson.D{bson.E{Key: "_id", Value: userID}}, update, opts).Decode(&counter); err != nil {
+		return 0, errors.Wrap(err, "Error in drawing sync sequence number")
+	}
+	return counter.Seq, nil
+}
+
+// current returns the last committed number of the user, 0 before the
+// first.
+func (s syncSequence) current(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.collection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: userID}}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return counter.Seq, err
+}
+
+// delete forgets the numbers of the user.
+func (s syncSequence) delete(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: userID}})
+	return err
+}
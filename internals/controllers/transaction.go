@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"context"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withTransaction runs fn in a transaction on the client of collection,
+// which is retried on transient errors. Transactions need MongoDB 4.4 or
+// later running as a replica set; a single node replica set will do.
+func withTransaction(ctx context.Context, collection *mongo.Collection, fn func(sc mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in starting database session")
+	}
+	defer session.EndSession(ctx)
+	return session.WithTransaction(ctx, fn)
+}
@@ -2,29 +2,43 @@ package controllers
 
 import (
 	"context"
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/models"
 	"time"
 
+	paginate "github.com/gobeam/mongo-go-pagination"
 	errors "github.com/pkg/errors"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const DEFAULT_USER_ROLE = "user"
 const DEFAULT_USER_IMAGE = "https://res.cloudinary.com/sixty-seconds-idea-training-project/image/upload/v1656157889/users/default-user-image_LYizIFTei_ioicfh.png"
 
+// MongoDB error code of indexes created again with other options
+const indexOptionsConflictCode = 85
+
 type UserController struct {
 	usercollection *mongo.Collection
 	ctx            context.Context
 }
 
 type IUserController interface {
+	CreateIndexes() error
 	CreateUser(user *models.User) (*models.User, error)
 	UpdateUser(id primitive.ObjectID, user *models.User) error
 	GetUserByID(id primitive.ObjectID) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
+	GetUserByFirebaseUID(uid string) (*models.User, error)
+	ListUsers(filter bson.M, page int, limit int) ([]models.User, *paginate.PaginatedData, error)
+	ListUsersAfter(afterID primitive.ObjectID, limit int) ([]models.User, error)
+	UpdateUserRole(id primitive.ObjectID, role guard.Role) error
+	SetUserSuspended(id primitive.ObjectID, suspended bool) error
+	UpdateUserGoals(id primitive.ObjectID, goals []models.Goal) error
+	DeleteUser(id primitive.ObjectID) (int64, error)
 }
 
 func NewUserController(usercollection *mongo.Collection, ctx context.Context) IUserController {
@@ -34,6 +48,35 @@ func NewUserController(usercollection *mongo.Collection, ctx context.Context) IU
 	}
 }
 
+// CreateIndexes makes email and UID unique, so concurrent sign ups or
+// provisioning of the same account can not create duplicate users and an
+// identity resolves to one user only.
+func (uc *UserController) CreateIndexes() error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := uc.usercollection.Indexes().CreateOne(uc.ctx, index); err != nil {
+		return errors.Wrap(err, "Error in creating users email index")
+	}
+	uidIndex := mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "firebaseUid", Value: 1}},
+		Options: options.Index().SetSparse(true).SetUnique(true),
+	}
+	_, err := uc.usercollection.Indexes().CreateOne(uc.ctx, uidIndex)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(indexOptionsConflictCode) {
+		// the uid index used not to be unique
+		if _, err = uc.usercollection.Indexes().DropOne(uc.ctx, "firebaseUid_1"); err == nil {
+			_, err = uc.usercollection.Indexes().CreateOne(uc.ctx, uidIndex)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error in creating users uid index")
+	}
+	return nil
+}
+
 func (uc *UserController) CreateUser(user *models.User) (*models.User, error) {
 	// deal with time stamps
 	user.CreatedAt = time.Now()
@@ -90,6 +133,22 @@ func (uc *UserController) GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserByFirebaseUID loads the user by the UID of their identity provider,
+// Firebase or the OIDC subject.
+func (uc *UserController) GetUserByFirebaseUID(uid string) (*models.User, error) {
+	var user models.User
+	filter := bson.D{
+		bson.E{
+			Key:   "firebaseUid",
+			Value: uid,
+		},
+	}
+	if err := uc.usercollection.FindOne(uc.ctx, filter).Decode(&user); err != nil {
+		return nil, errors.Wrap(err, "Error in FindOne")
+	}
+	return &user, nil
+}
+
 func (uc *UserController) UpdateUser(id primitive.ObjectID, user *models.User) error {
 	filter := bson.D{
 		bson.E{
@@ -103,3 +162,85 @@ func (uc *UserController) UpdateUser(id primitive.ObjectID, user *models.User) e
 	}
 	return nil
 }
+
+func (uc *UserController) ListUsers(filter bson.M, page int, limit int) ([]models.User, *paginate.PaginatedData, error) {
+	var users []models.User
+	paginatedData, err := paginate.New(uc.usercollection).Context(uc.ctx).Limit(int64(limit)).Page(int64(page)).Sort("createdAt", -1).Filter(filter).Decode(&users).Find()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error in paginating users")
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	return users, paginatedData, nil
+}
+
+// ListUsersAfter lists up to limit users with an _id after afterID, in _id
+// order, for jobs walking every user. Unlike offset pages, users created or
+// deleted meanwhile do not shift the users still to come.
+func (uc *UserController) ListUsersAfter(afterID primitive.ObjectID, limit int) ([]models.User, error) {
+	filter := bson.D{bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$gt", Value: afterID}}}}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := uc.usercollection.Find(uc.ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing users")
+	}
+	users := []models.User{}
+	if err = cursor.All(uc.ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (uc *UserController) UpdateUserRole(id primitive.ObjectID, role guard.Role) error {
+	update := bson.M{"$set": bson.M{"role": role, "updatedAt": time.Now()}}
+	result, err := uc.usercollection.UpdateByID(uc.ctx, id, update)
+	if err != nil {
+		return errors.Wrap(err, "Error in UpdateByID")
+	}
+	if result.MatchedCount != 1 {
+		return errors.New("failed to update user role. User not found")
+	}
+	return nil
+}
+
+func (uc *UserController) SetUserSuspended(id primitive.ObjectID, suspended bool) error {
+	update := bson.M{"$set": bson.M{"suspended": suspended, "updatedAt": time.Now()}}
+	result, err := uc.usercollection.UpdateByID(uc.ctx, id, update)
+	if err != nil {
+		return errors.Wrap(err, "Error in UpdateByID")
+	}
+	if result.MatchedCount != 1 {
+		return errors.New("failed to update user suspension. User not found")
+	}
+	return nil
+}
+
+// UpdateUserGoals replaces the goals of the user, an empty list clears them.
+func (uc *UserController) UpdateUserGoals(id primitive.ObjectID, goals []models.Goal) error {
+	update := bson.M{"$set": bson.M{"goals": goals, "updatedAt": time.Now()}}
+	result, err := uc.usercollection.UpdateByID(uc.ctx, id, update)
+	if err != nil {
+		return errors.Wrap(err, "Error in UpdateByID")
+	}
+	if result.MatchedCount != 1 {
+		return errors.New("failed to update user goals. User not found")
+	}
+	return nil
+}
+
+func (uc *UserController) DeleteUser(id primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		bson.E{
+			Key:   "_id",
+			Value: id,
+		},
+	}
+
+	result, err := uc.usercollection.DeleteOne(uc.ctx, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error in DeleteOne")
+	}
+	return result.DeletedCount, nil
+}
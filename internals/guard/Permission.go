@@ -0,0 +1,44 @@
+package guard
+
+type Permission string
+
+var (
+	ReadOwnIdeas  Permission = "ideas:read:own"
+	WriteOwnIdeas Permission = "ideas:write:own"
+	ReadAnyIdeas  Permission = "ideas:read:any"
+	WriteAnyIdeas Permission = "ideas:write:any"
+	ReadAnyUsers  Permission = "users:read:any"
+	WriteAnyUsers Permission = "users:write:any"
+)
+
+// Permissions is the permission matrix granted to each role.
+var Permissions = map[Role][]Permission{
+	User: {
+		ReadOwnIdeas,
+		WriteOwnIdeas,
+	},
+	Admin: {
+		ReadOwnIdeas,
+		WriteOwnIdeas,
+		ReadAnyIdeas,
+		WriteAnyIdeas,
+		ReadAnyUsers,
+		WriteAnyUsers,
+	},
+}
+
+// IsValid reports whether r is one of the known roles.
+func (r Role) IsValid() bool {
+	_, ok := Permissions[r]
+	return ok
+}
+
+// Can reports whether r is granted permission p.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range Permissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
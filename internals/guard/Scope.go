@@ -0,0 +1,24 @@
+package guard
+
+// Scope limits what a personal access token may do.
+type Scope string
+
+var (
+	IdeasRead  Scope = "ideas:read"
+	IdeasWrite Scope = "ideas:write"
+)
+
+var Scopes = []Scope{
+	IdeasRead,
+	IdeasWrite,
+}
+
+// IsValid reports whether s is one of the known scopes.
+func (s Scope) IsValid() bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
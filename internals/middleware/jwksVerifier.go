@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// how long fetched keys are trusted before they are fetched again
+	JWKS_CACHE_TTL = time.Hour
+	// unknown key ids trigger a refetch at most this often
+	JWKS_MIN_REFRESH_INTERVAL = time.Minute
+)
+
+// JWKSVerifier verifies OIDC ID tokens signed with RSA or EC keys published
+// as a JSON Web Key Set, either at an http(s) URL or in a local file.
+type JWKSVerifier struct {
+	source   string
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	// checkedAt is the time of the last fetch, including failed ones
+	checkedAt time.Time
+	// refreshed is closed when the running fetch is done, nil if none runs
+	refreshed chan struct{}
+	fetchErr  error
+}
+
+// NewJWKSVerifier creates a verifier reading keys from source, which is an
+// http(s) URL or a local file path. Empty issuer or audience are not checked.
+func NewJWKSVerifier(source, issuer, audience string) *JWKSVerifier {
+	return &JWKSVerifier{
+		source:   source,
+		issuer:   issuer,
+		audience: audience,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (jv *JWKSVerifier) VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return jv.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid OIDC token")
+	}
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("Invalid OIDC token")
+	}
+	if !mapClaims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("Invalid OIDC token expiry")
+	}
+	if jv.issuer != "" && !mapClaims.VerifyIssuer(jv.issuer, true) {
+		return nil, errors.New("Invalid OIDC token issuer")
+	}
+	if jv.audience != "" && !mapClaims.VerifyAudience(jv.audience, true) {
+		return nil, errors.New("Invalid OIDC token audience")
+	}
+	return claimsFromMap(mapClaims).validateVerified()
+}
+
+// key returns the public key for kid, refetching the key set when it is stale
+// or does not know kid. An empty kid is accepted when the set has one key.
+// Concurrent callers share one fetch, and known keys keep being served while
+// it runs or when it fails.
+func (jv *JWKSVerifier) key(ctx context.Context, kid string) (interface{}, error) {
+	jv.mu.Lock()
+	_, known := jv.keys[kid]
+	stale := time.Since(jv.fetchedAt) > JWKS_CACHE_TTL
+	if (stale || !known) && (jv.refreshed != nil || jv.keys == nil || time.Since(jv.checkedAt) > JWKS_MIN_REFRESH_INTERVAL) {
+		refreshed := jv.refresh()
+		// a stale key is served while the fresh set is fetched
+		if !known {
+			jv.mu.Unlock()
+			select {
+			case <-refreshed:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			jv.mu.Lock()
+		}
+	}
+	defer jv.mu.Unlock()
+
+	if key, ok := jv.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(jv.keys) == 1 {
+		for _, key := range jv.keys {
+			return key, nil
+		}
+	}
+	if jv.keys == nil && jv.fetchErr != nil {
+		return nil, jv.fetchErr
+	}
+	return nil, fmt.Errorf("no key found for kid %q", kid)
+}
+
+// refresh starts fetching the key set unless a fetch already runs and
+// returns a channel closed once it is done. jv.mu must be held.
+func (jv *JWKSVerifier) refresh() <-chan struct{} {
+	if jv.refreshed != nil {
+		return jv.refreshed
+	}
+	refreshed := make(chan struct{})
+	jv.refreshed = refreshed
+	go func() {
+		// not bound to a request, whose cancellation would fail the fetch
+		// for every caller waiting on it
+		keys, err := jv.fetch(context.Background())
+
+		jv.mu.Lock()
+		defer jv.mu.Unlock()
+		jv.checkedAt = time.Now()
+		jv.fetchErr = err
+		if err == nil {
+			jv.keys = keys
+			jv.fetchedAt = jv.checkedAt
+		}
+		jv.refreshed = nil
+		close(refreshed)
+	}()
+	return refreshed
+}
+
+func (jv *JWKSVerifier) fetch(ctx context.Context) (map[string]interface{}, error) {
+	var body []byte
+	var err error
+	if strings.HasPrefix(jv.source, "http://") || strings.HasPrefix(jv.source, "https://") {
+		body, err = jv.fetchURL(ctx)
+	} else {
+		body, err = os.ReadFile(jv.source)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in fetching JWKS")
+	}
+	return parseJWKS(body)
+}
+
+func (jv *JWKSVerifier) fetchURL(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jv.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jv.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the signing keys of a key set by kid.
+// Keys of unsupported types are skipped.
+func parseJWKS(body []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding JWKS")
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			key, err := jwk.rsaPublicKey()
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid RSA key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = key
+		case "EC":
+			key, err := jwk.ecdsaPublicKey()
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid EC key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() {
+		return nil, errors.New("exponent is too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (jwk jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -4,29 +4,45 @@ import (
 	"context"
 	"fmt"
 	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
 	"idea-training-version-go/internals/utils"
-	"idea-training-version-go/internals/utils/firebase"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type RequireAuth struct {
-	UserController controllers.IUserController
+	UserController        controllers.IUserController
+	AccessTokenController controllers.IAccessTokenController
+	TokenVerifier         TokenVerifier
+	// ProvisionUsers creates the mongo user of verified tokens on first sight
+	ProvisionUsers bool
 }
 
-func NewRequireAuth(usercontroller controllers.IUserController) RequireAuth {
+func NewRequireAuth(usercontroller controllers.IUserController, accesstokencontroller controllers.IAccessTokenController, tokenverifier TokenVerifier) RequireAuth {
 	return RequireAuth{
-		UserController: usercontroller,
+		UserController:        usercontroller,
+		AccessTokenController: accesstokencontroller,
+		TokenVerifier:         tokenverifier,
 	}
 }
 
 func (r *RequireAuth) AllowIfLogIn(ctx *gin.Context) {
-	var email string
+	r.logIn(ctx, false)
+}
+
+// AllowIfLogInSuspended also lets suspended users in. Accounts are suspended
+// while they are deleted, so their owners can still resume the deletion.
+func (r *RequireAuth) AllowIfLogInSuspended(ctx *gin.Context) {
+	r.logIn(ctx, true)
+}
+
+func (r *RequireAuth) logIn(ctx *gin.Context, allowSuspended bool) {
 	auth := ctx.GetHeader("Authorization")
 	if auth == "" {
 		res := utils.NewHttpResponse(http.StatusUnauthorized, "Invalid authorization token provided...")
@@ -34,37 +50,33 @@ func (r *RequireAuth) AllowIfLogIn(ctx *gin.Context) {
 		return
 	}
 	tokenString := strings.TrimPrefix(auth, "Bearer ")
-	if os.Getenv("STAGE") == "test" {
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-		if err != nil {
-			res := utils.NewHttpResponse(http.StatusUnauthorized, "Invalid token auth for test env...")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
-		}
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			email = claims["email"].(string)
-		}
+
+	var user *models.User
+	var accessToken *models.AccessToken
+	var claims *Claims
+	var err error
+	if utils.IsAccessToken(tokenString) {
+		user, accessToken, err = r.fetchAccessTokenUser(tokenString)
 	} else {
-		// For dev and prod environment
-		decodedToken, err := firebase.Client.VerifyIDToken(ctx, tokenString)
-		if err != nil {
-			res := utils.NewHttpResponse(http.StatusUnauthorized, errors.Wrap(err, "Invalid authorization token provided..."))
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
-			return
-		}
-		email = decodedToken.Claims["email"].(string)
+		user, claims, err = r.fetchIDTokenUser(ctx, tokenString)
 	}
-
-	user, err := r.UserController.GetUserByEmail(email)
 	if err != nil {
-		res := utils.NewHttpResponse(http.StatusUnauthorized, errors.Wrap(err, "Failed to get user from mongo db in auth middleware function"))
+		res := utils.NewHttpResponse(http.StatusUnauthorized, err)
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
 		return
 	}
+	if !allowSuspended && user.Suspended != nil && *user.Suspended {
+		res := utils.NewHttpResponse(http.StatusForbidden, "User account is suspended")
+		ctx.AbortWithStatusJSON(http.StatusForbidden, res)
+		return
+	}
+
+	// users stored before roles existed have no role
+	role := user.Role
+	if role == "" {
+		role = guard.User
+	}
+
 	// for graphql
 	c := context.WithValue(ctx.Request.Context(), "id", user.ID)
 	ctx.Request = ctx.Request.WithContext(c)
@@ -72,5 +84,203 @@ func (r *RequireAuth) AllowIfLogIn(ctx *gin.Context) {
 	// for rest api
 	ctx.Set("id", user.ID)
 	ctx.Set("email", user.Email)
+	ctx.Set("role", role)
+	ctx.Set("timezone", user.Timezone)
+	if accessToken != nil {
+		ctx.Set("accessToken", accessToken)
+	}
+	if claims != nil {
+		setTokenIdentity(ctx, claims)
+	}
+	ctx.Next()
+}
+
+// VerifyIDTokenIfPresent verifies the ID token of requests that carry one
+// and puts its identity in the context, e.g. to sign up a user of an
+// existing identity. Requests without a token pass.
+func (r *RequireAuth) VerifyIDTokenIfPresent(ctx *gin.Context) {
+	auth := ctx.GetHeader("Authorization")
+	if auth == "" {
+		ctx.Next()
+		return
+	}
+	tokenString := strings.TrimPrefix(auth, "Bearer ")
+	if utils.IsAccessToken(tokenString) {
+		res := utils.NewHttpResponse(http.StatusUnauthorized, "Personal access tokens can not access this resource")
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
+		return
+	}
+	claims, err := r.TokenVerifier.VerifyToken(ctx, tokenString)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusUnauthorized, errors.Wrap(err, "Invalid authorization token provided..."))
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
+		return
+	}
+	setTokenIdentity(ctx, claims)
+	ctx.Next()
+}
+
+// setTokenIdentity puts the UID of the verified claims and their email, if
+// verified, in the context. See utils.FetchTokenUIDFromCtx.
+func setTokenIdentity(ctx *gin.Context, claims *Claims) {
+	if claims.UID != "" {
+		ctx.Set("firebaseUid", claims.UID)
+	}
+	if claims.EmailVerified {
+		ctx.Set("verifiedEmail", claims.Email)
+	}
+}
+
+func (r *RequireAuth) fetchIDTokenUser(ctx context.Context, tokenString string) (*models.User, *Claims, error) {
+	claims, err := r.TokenVerifier.VerifyToken(ctx, tokenString)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Invalid authorization token provided...")
+	}
+	user, err := r.fetchUser(claims)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to get user from mongo db in auth middleware function")
+	}
+	return user, claims, nil
+}
+
+func (r *RequireAuth) fetchAccessTokenUser(tokenString string) (*models.User, *models.AccessToken, error) {
+	if r.AccessTokenController == nil {
+		return nil, nil, errors.New("Personal access tokens are not supported...")
+	}
+	accessToken, err := r.AccessTokenController.GetAccessTokenByHash(utils.HashAccessToken(tokenString))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Invalid personal access token provided...")
+	}
+	if accessToken.IsExpired() {
+		return nil, nil, errors.New("Personal access token has expired...")
+	}
+	user, err := r.UserController.GetUserByID(accessToken.CreatedBy)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to get user from mongo db in auth middleware function")
+	}
+	if err := r.AccessTokenController.TouchAccessToken(accessToken.ID); err != nil {
+		log.Println("Failed to update last use of access token", accessToken.ID.Hex(), err)
+	}
+	return user, accessToken, nil
+}
+
+// fetchUser loads the user of the verified claims, by the UID of the
+// identity provider first, stored as FirebaseUID, and by email otherwise.
+// Only verified emails are looked up, and an email linked to another UID
+// is refused. With ProvisionUsers set, unknown users are created from the
+// claims. The unique email index makes a concurrent first request lose the
+// insert, which then reads the winner's user.
+func (r *RequireAuth) fetchUser(claims *Claims) (*models.User, error) {
+	if claims.UID != "" {
+		user, err := r.UserController.GetUserByFirebaseUID(claims.UID)
+		if err == nil || !errors.Is(err, mongo.ErrNoDocuments) {
+			return user, err
+		}
+	}
+	if !claims.EmailVerified {
+		return nil, errors.New("token email is not verified")
+	}
+
+	user, err := r.fetchUserByEmail(claims)
+	if err == nil || !r.ProvisionUsers || !errors.Is(err, mongo.ErrNoDocuments) {
+		return user, err
+	}
+
+	newUser := &models.User{
+		FirebaseUID: claims.UID,
+		Email:       claims.Email,
+	}
+	if names := strings.Fields(claims.Name); len(names) > 0 {
+		newUser.FirstName = names[0]
+		newUser.LastName = strings.Join(names[1:], " ")
+	}
+	if claims.Picture != "" {
+		newUser.Images = []models.Image{{About: "provider", Url: claims.Picture}}
+	}
+
+	user, err = r.UserController.CreateUser(newUser)
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		return r.fetchUserByEmail(claims)
+	}
+	return user, err
+}
+
+// fetchUserByEmail loads the user of the claims' email, unless it is linked
+// to another UID.
+func (r *RequireAuth) fetchUserByEmail(claims *Claims) (*models.User, error) {
+	user, err := r.UserController.GetUserByEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UID != "" && user.FirebaseUID != "" && user.FirebaseUID != claims.UID {
+		return nil, errors.New("email is linked to another account")
+	}
+	return user, nil
+}
+
+// AllowIfScope only lets personal access tokens granted scope through.
+// ID tokens are not scoped. It must be chained after AllowIfLogIn.
+func (r *RequireAuth) AllowIfScope(scope guard.Scope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token, ok := ctx.Get("accessToken"); ok && !token.(*models.AccessToken).HasScope(scope) {
+			res := utils.NewHttpResponse(http.StatusForbidden, fmt.Sprintf("Personal access token is missing scope %v", scope))
+			ctx.AbortWithStatusJSON(http.StatusForbidden, res)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// AllowIfIDToken rejects personal access tokens, e.g. for account settings.
+// It must be chained after AllowIfLogIn.
+func (r *RequireAuth) AllowIfIDToken(ctx *gin.Context) {
+	if _, ok := ctx.Get("accessToken"); ok {
+		res := utils.NewHttpResponse(http.StatusForbidden, "Personal access tokens can not access this resource")
+		ctx.AbortWithStatusJSON(http.StatusForbidden, res)
+		return
+	}
 	ctx.Next()
 }
+
+// AllowIfRole only lets users with one of the given roles through.
+// It must be chained after AllowIfLogIn, which puts the role in the context.
+func (r *RequireAuth) AllowIfRole(roles ...guard.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role := utils.FetchRoleFromCtx(ctx)
+		if role == "" {
+			res := utils.NewHttpResponse(http.StatusUnauthorized, "No role found for the logged in user...")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
+			return
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				ctx.Next()
+				return
+			}
+		}
+		res := utils.NewHttpResponse(http.StatusForbidden, fmt.Sprintf("Role %v is not allowed to access this resource", role))
+		ctx.AbortWithStatusJSON(http.StatusForbidden, res)
+	}
+}
+
+// AllowIfPermitted only lets users whose role is granted every given
+// permission in guard.Permissions through.
+// It must be chained after AllowIfLogIn, which puts the role in the context.
+func (r *RequireAuth) AllowIfPermitted(permissions ...guard.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role := utils.FetchRoleFromCtx(ctx)
+		if role == "" {
+			res := utils.NewHttpResponse(http.StatusUnauthorized, "No role found for the logged in user...")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, res)
+			return
+		}
+		for _, permission := range permissions {
+			if !role.Can(permission) {
+				res := utils.NewHttpResponse(http.StatusForbidden, fmt.Sprintf("Role %v is missing permission %v", role, permission))
+				ctx.AbortWithStatusJSON(http.StatusForbidden, res)
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,552 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signToken: %v", err)
+	}
+	return tokenString
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":            "uid_1",
+		"email":          "test_email@test.com",
+		"email_verified": true,
+		"name":           "first_name last_name",
+		"iss":            "https://issuer.test",
+		"aud":            "idea-training",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestHMACVerifier(t *testing.T) {
+	verifier := NewHMACVerifier("secret")
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noEmail := validClaims()
+	delete(noEmail, "email")
+	unverified := validClaims()
+	unverified["email_verified"] = false
+	verifiedString := validClaims()
+	verifiedString["email_verified"] = "true"
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", validClaims()), false},
+		{"wrong secret", signToken(t, jwt.SigningMethodHS256, []byte("other"), "", validClaims()), true},
+		{"expired", signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", expired), true},
+		{"no email", signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", noEmail), true},
+		{"unverified email", signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", unverified), true},
+		{"verified as string", signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", verifiedString), false},
+		{"rsa signed", signToken(t, jwt.SigningMethodRS256, rsaKey, "", validClaims()), true},
+		{"garbage", "not-a-token", true},
+	}
+
+	for _, c := range cases {
+		claims, err := verifier.VerifyToken(context.Background(), c.token)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("TestHMACVerifier %v: expected error, got claims %v", c.name, claims)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TestHMACVerifier %v: %v", c.name, err)
+			continue
+		}
+		if claims.Email != "test_email@test.com" || claims.UID != "uid_1" {
+			t.Errorf("TestHMACVerifier %v: unexpected claims %v", c.name, claims)
+		}
+	}
+}
+
+func TestJWKSVerifierFromFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "rsa_1",
+			"use": "sig",
+			"n":   encodeBigInt(rsaKey.N),
+			"e":   encodeBigInt(big.NewInt(int64(rsaKey.E))),
+		}},
+	})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0600); err != nil {
+		t.Fatalf("TestJWKSVerifierFromFile: %v", err)
+	}
+
+	verifier := NewJWKSVerifier(path, "https://issuer.test", "idea-training")
+
+	claims, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa_1", validClaims()))
+	if err != nil {
+		t.Fatalf("TestJWKSVerifierFromFile: %v", err)
+	}
+	if claims.Email != "test_email@test.com" || claims.Name != "first_name last_name" {
+		t.Errorf("TestJWKSVerifierFromFile: unexpected claims %v", claims)
+	}
+
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://other.test"
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa_1", wrongIssuer)); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for wrong issuer")
+	}
+
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "other"
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa_1", wrongAudience)); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for wrong audience")
+	}
+
+	unverified := validClaims()
+	delete(unverified, "email_verified")
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa_1", unverified)); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for unverified email")
+	}
+
+	noExpiry := validClaims()
+	delete(noExpiry, "exp")
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa_1", noExpiry)); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for token without expiry")
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodRS256, otherKey, "rsa_1", validClaims())); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for foreign key")
+	}
+
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodHS256, []byte("secret"), "rsa_1", validClaims())); err == nil {
+		t.Errorf("TestJWKSVerifierFromFile: expected error for HMAC signed token")
+	}
+}
+
+func TestJWKSVerifierFromURL(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "ec_1",
+				"crv": "P-256",
+				"x":   encodeBigInt(ecKey.X),
+				"y":   encodeBigInt(ecKey.Y),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	verifier := NewJWKSVerifier(server.URL, "", "")
+
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodES256, ecKey, "ec_1", validClaims())); err != nil {
+			t.Fatalf("TestJWKSVerifierFromURL: %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("TestJWKSVerifierFromURL: expected keys to be cached, got %v requests", requests)
+	}
+
+	if _, err := verifier.VerifyToken(context.Background(), signToken(t, jwt.SigningMethodES256, ecKey, "unknown", validClaims())); err == nil {
+		t.Errorf("TestJWKSVerifierFromURL: expected error for unknown kid")
+	}
+}
+
+func TestJWKSVerifierRefresh(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var mu sync.Mutex
+	requests, failing := 0, false
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{"kty": "EC", "kid": "ec_1", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)}},
+		})
+	}))
+	defer server.Close()
+
+	verifier := NewJWKSVerifier(server.URL, "", "")
+	token := signToken(t, jwt.SigningMethodES256, ecKey, "ec_1", validClaims())
+	countRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+	waitForRefresh := func() {
+		verifier.mu.Lock()
+		refreshed := verifier.refreshed
+		verifier.mu.Unlock()
+		if refreshed != nil {
+			<-refreshed
+		}
+	}
+
+	// concurrent callers share the first fetch
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := verifier.VerifyToken(context.Background(), token)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("TestJWKSVerifierRefresh: %v", err)
+		}
+	}
+	if n := countRequests(); n != 1 {
+		t.Errorf("TestJWKSVerifierRefresh: expected one shared fetch, got %v", n)
+	}
+
+	// stale keys are served while the refresh fails
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+	verifier.mu.Lock()
+	verifier.fetchedAt = time.Now().Add(-2 * JWKS_CACHE_TTL)
+	verifier.checkedAt = verifier.fetchedAt
+	verifier.mu.Unlock()
+	if _, err := verifier.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("TestJWKSVerifierRefresh: expected stale key to be served, got %v", err)
+	}
+	waitForRefresh()
+	if _, err := verifier.VerifyToken(context.Background(), token); err != nil {
+		t.Errorf("TestJWKSVerifierRefresh: expected stale key after failed refresh, got %v", err)
+	}
+	if n := countRequests(); n != 2 {
+		t.Errorf("TestJWKSVerifierRefresh: expected failed refresh to be throttled, got %v requests", n)
+	}
+}
+
+type fakeVerifier struct {
+	claims *Claims
+	err    error
+}
+
+func (fv *fakeVerifier) VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	return fv.claims, fv.err
+}
+
+type fakeUserController struct {
+	controllers.IUserController
+	user *models.User
+	// concurrent is inserted by a concurrent request when CreateUser is called
+	concurrent *models.User
+	created    int
+}
+
+func (fc *fakeUserController) GetUserByEmail(email string) (*models.User, error) {
+	if fc.user == nil || fc.user.Email != email {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	return fc.user, nil
+}
+
+func (fc *fakeUserController) GetUserByFirebaseUID(uid string) (*models.User, error) {
+	if fc.user == nil || fc.user.FirebaseUID != uid {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	return fc.user, nil
+}
+
+func (fc *fakeUserController) GetUserByID(id primitive.ObjectID) (*models.User, error) {
+	if fc.user == nil || fc.user.ID != id {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	return fc.user, nil
+}
+
+func (fc *fakeUserController) CreateUser(user *models.User) (*models.User, error) {
+	if fc.concurrent != nil {
+		fc.user = fc.concurrent
+		return nil, errors.Wrap(mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, "Error in InsertOne")
+	}
+	fc.created++
+	user.ID = primitive.NewObjectID()
+	fc.user = user
+	return user, nil
+}
+
+func TestAllowIfLogIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{ID: primitive.NewObjectID(), FirebaseUID: "uid_1", Email: "test_email@test.com"}
+
+	cases := []struct {
+		name       string
+		header     string
+		verifier   TokenVerifier
+		wantStatus int
+	}{
+		{"no header", "", &fakeVerifier{claims: &Claims{Email: user.Email, EmailVerified: true}}, http.StatusUnauthorized},
+		{"invalid token", "Bearer token", &fakeVerifier{err: errors.New("invalid")}, http.StatusUnauthorized},
+		{"unknown user", "Bearer token", &fakeVerifier{claims: &Claims{Email: "other@test.com", EmailVerified: true}}, http.StatusUnauthorized},
+		{"valid token", "Bearer token", &fakeVerifier{claims: &Claims{Email: user.Email, EmailVerified: true}}, http.StatusOK},
+		{"unverified email", "Bearer token", &fakeVerifier{claims: &Claims{Email: user.Email}}, http.StatusUnauthorized},
+		{"known uid", "Bearer token", &fakeVerifier{claims: &Claims{UID: "uid_1", Email: "changed@test.com"}}, http.StatusOK},
+		{"email of another uid", "Bearer token", &fakeVerifier{claims: &Claims{UID: "uid_2", Email: user.Email, EmailVerified: true}}, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		requireAuth := NewRequireAuth(&fakeUserController{user: user}, nil, c.verifier)
+		reached := false
+		router := gin.New()
+		router.GET("/", requireAuth.AllowIfLogIn, func(ctx *gin.Context) {
+			reached = true
+			ctx.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		router.ServeHTTP(w, req)
+
+		if w.Code != c.wantStatus {
+			t.Errorf("TestAllowIfLogIn %v: expected status %v, got %v", c.name, c.wantStatus, w.Code)
+		}
+		if reached != (c.wantStatus == http.StatusOK) {
+			t.Errorf("TestAllowIfLogIn %v: handler reached = %v", c.name, reached)
+		}
+	}
+}
+
+func TestAllowIfLogInSuspended(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	suspended := true
+	user := &models.User{ID: primitive.NewObjectID(), FirebaseUID: "uid_1", Email: "test_email@test.com", Suspended: &suspended}
+	requireAuth := NewRequireAuth(&fakeUserController{user: user}, nil, &fakeVerifier{claims: &Claims{UID: "uid_1"}})
+
+	serve := func(handler gin.HandlerFunc) int {
+		router := gin.New()
+		router.DELETE("/", handler, func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(requireAuth.AllowIfLogIn); code != http.StatusForbidden {
+		t.Errorf("TestAllowIfLogInSuspended: expected AllowIfLogIn to refuse suspended users, got %v", code)
+	}
+	if code := serve(requireAuth.AllowIfLogInSuspended); code != http.StatusOK {
+		t.Errorf("TestAllowIfLogInSuspended: expected suspended user to pass, got %v", code)
+	}
+}
+
+func TestVerifyIDTokenIfPresent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name         string
+		header       string
+		verifier     TokenVerifier
+		wantStatus   int
+		wantUID      string
+		wantVerified string
+	}{
+		{"no header", "", &fakeVerifier{err: errors.New("invalid")}, http.StatusOK, "", ""},
+		{"invalid token", "Bearer token", &fakeVerifier{err: errors.New("invalid")}, http.StatusUnauthorized, "", ""},
+		{"access token", "Bearer " + utils.ACCESS_TOKEN_PREFIX + "token", &fakeVerifier{}, http.StatusUnauthorized, "", ""},
+		{"verified email", "Bearer token", &fakeVerifier{claims: &Claims{UID: "uid_1", Email: "test_email@test.com", EmailVerified: true}}, http.StatusOK, "uid_1", "test_email@test.com"},
+		{"unverified email", "Bearer token", &fakeVerifier{claims: &Claims{UID: "uid_1", Email: "test_email@test.com"}}, http.StatusOK, "uid_1", ""},
+	}
+
+	for _, c := range cases {
+		requireAuth := NewRequireAuth(&fakeUserController{}, nil, c.verifier)
+		var uid, verified string
+		router := gin.New()
+		router.POST("/", requireAuth.VerifyIDTokenIfPresent, func(ctx *gin.Context) {
+			uid, verified = utils.FetchTokenUIDFromCtx(ctx), utils.FetchVerifiedEmailFromCtx(ctx)
+			ctx.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		router.ServeHTTP(w, req)
+
+		if w.Code != c.wantStatus || uid != c.wantUID || verified != c.wantVerified {
+			t.Errorf("TestVerifyIDTokenIfPresent %v: expected status %v with %q and %q, got %v with %q and %q", c.name, c.wantStatus, c.wantUID, c.wantVerified, w.Code, uid, verified)
+		}
+	}
+}
+
+func TestAllowIfLogInProvisionUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	claims := &Claims{UID: "uid_1", Email: "new_user@test.com", EmailVerified: true, Name: "first_name last name", Picture: "https://picture.test/1.png"}
+
+	serve := func(requireAuth RequireAuth) (int, interface{}) {
+		var id interface{}
+		router := gin.New()
+		router.GET("/", requireAuth.AllowIfLogIn, func(ctx *gin.Context) {
+			id, _ = ctx.Get("id")
+			ctx.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		router.ServeHTTP(w, req)
+		return w.Code, id
+	}
+
+	// disabled by default
+	disabled := &fakeUserController{}
+	if code, _ := serve(NewRequireAuth(disabled, nil, &fakeVerifier{claims: claims})); code != http.StatusUnauthorized || disabled.created != 0 {
+		t.Errorf("TestAllowIfLogInProvisionUsers: expected no provisioning, got status %v and %v created", code, disabled.created)
+	}
+
+	// nobody can claim an email the provider did not verify
+	unverified := &fakeUserController{}
+	unverifiedAuth := NewRequireAuth(unverified, nil, &fakeVerifier{claims: &Claims{UID: "uid_2", Email: "squatted@test.com"}})
+	unverifiedAuth.ProvisionUsers = true
+	if code, _ := serve(unverifiedAuth); code != http.StatusUnauthorized || unverified.created != 0 {
+		t.Errorf("TestAllowIfLogInProvisionUsers: expected no provisioning of unverified emails, got status %v and %v created", code, unverified.created)
+	}
+
+	userController := &fakeUserController{}
+	requireAuth := NewRequireAuth(userController, nil, &fakeVerifier{claims: claims})
+	requireAuth.ProvisionUsers = true
+	for i := 0; i < 2; i++ {
+		if code, id := serve(requireAuth); code != http.StatusOK || id != userController.user.ID {
+			t.Errorf("TestAllowIfLogInProvisionUsers: expected provisioned user, got status %v and id %v", code, id)
+		}
+	}
+	if userController.created != 1 {
+		t.Errorf("TestAllowIfLogInProvisionUsers: expected 1 user created, got %v", userController.created)
+	}
+	user := userController.user
+	if user.FirebaseUID != "uid_1" || user.FirstName != "first_name" || user.LastName != "last name" || user.Images[0].Url != claims.Picture {
+		t.Errorf("TestAllowIfLogInProvisionUsers: unexpected user %v", user)
+	}
+
+	// a concurrent first request already inserted the user
+	winner := &models.User{ID: primitive.NewObjectID(), Email: claims.Email}
+	raced := &fakeUserController{concurrent: winner}
+	racedAuth := NewRequireAuth(raced, nil, &fakeVerifier{claims: claims})
+	racedAuth.ProvisionUsers = true
+	if code, id := serve(racedAuth); code != http.StatusOK || id != winner.ID {
+		t.Errorf("TestAllowIfLogInProvisionUsers: expected concurrent user, got status %v and id %v", code, id)
+	}
+}
+
+type fakeAccessTokenController struct {
+	controllers.IAccessTokenController
+	tokens map[string]*models.AccessToken
+}
+
+func (fc *fakeAccessTokenController) GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	token, ok := fc.tokens[tokenHash]
+	if !ok {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	return token, nil
+}
+
+func (fc *fakeAccessTokenController) TouchAccessToken(tokenID primitive.ObjectID) error {
+	return nil
+}
+
+func TestAllowIfLogInAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{ID: primitive.NewObjectID(), Email: "test_email@test.com"}
+	past := time.Now().Add(-time.Hour)
+	readToken, readHash, _ := utils.GenerateAccessToken()
+	expiredToken, expiredHash, _ := utils.GenerateAccessToken()
+	unknownToken, _, _ := utils.GenerateAccessToken()
+
+	tokenController := &fakeAccessTokenController{tokens: map[string]*models.AccessToken{
+		readHash:    {ID: primitive.NewObjectID(), CreatedBy: user.ID, Scopes: []guard.Scope{guard.IdeasRead}},
+		expiredHash: {ID: primitive.NewObjectID(), CreatedBy: user.ID, Scopes: []guard.Scope{guard.IdeasRead}, ExpiresAt: &past},
+	}}
+	// ID tokens must never be consulted for access tokens
+	requireAuth := NewRequireAuth(&fakeUserController{user: user}, tokenController, &fakeVerifier{err: errors.New("not an id token")})
+
+	router := gin.New()
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	router.GET("/read", requireAuth.AllowIfLogIn, requireAuth.AllowIfScope(guard.IdeasRead), ok)
+	router.POST("/write", requireAuth.AllowIfLogIn, requireAuth.AllowIfScope(guard.IdeasWrite), ok)
+	router.GET("/settings", requireAuth.AllowIfLogIn, requireAuth.AllowIfIDToken, ok)
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"granted scope", http.MethodGet, "/read", readToken, http.StatusOK},
+		{"missing scope", http.MethodPost, "/write", readToken, http.StatusForbidden},
+		{"id token only", http.MethodGet, "/settings", readToken, http.StatusForbidden},
+		{"expired", http.MethodGet, "/read", expiredToken, http.StatusUnauthorized},
+		{"unknown", http.MethodGet, "/read", unknownToken, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		router.ServeHTTP(w, req)
+		if w.Code != c.wantStatus {
+			t.Errorf("TestAllowIfLogInAccessToken %v: expected status %v, got %v", c.name, c.wantStatus, w.Code)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"idea-training-version-go/internals/guard"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AccessToken struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name       string             `json:"name,omitempty" bson:"name,omitempty"`
+	TokenHash  string             `json:"-" bson:"tokenHash,omitempty"`
+	Prefix     string             `json:"prefix,omitempty" bson:"prefix,omitempty"`
+	Scopes     []guard.Scope      `json:"scopes" bson:"scopes"`
+	CreatedBy  primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	ExpiresAt  *time.Time         `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
+
+func (t *AccessToken) MarshalBSON() ([]byte, error) {
+	// deal with time stamps
+	t.UpdatedAt = time.Now()
+
+	type custom AccessToken
+	return bson.Marshal((*custom)(t))
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *AccessToken) HasScope(scope guard.Scope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token has an expiry in the past.
+func (t *AccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
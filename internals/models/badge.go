@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	BADGE_FIRST_SESSION  = "firstSession"
+	BADGE_STREAK_7       = "streak7"
+	BADGE_STREAK_30      = "streak30"
+	BADGE_IDEAS_1000     = "ideas1000"
+	BADGE_ALL_CATEGORIES = "allCategories"
+)
+
+// BADGES lists every badge kind.
+var BADGES = []string{BADGE_FIRST_SESSION, BADGE_STREAK_7, BADGE_STREAK_30, BADGE_IDEAS_1000, BADGE_ALL_CATEGORIES}
+
+// Badge is a milestone awarded once per user. IdeaID is the session that
+// reached it, nil for badges awarded by the backfill.
+type Badge struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Kind      string             `json:"kind" bson:"kind"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	IdeaID    primitive.ObjectID `json:"ideaId" bson:"ideaId"`
+	AwardedAt time.Time          `json:"awardedAt" bson:"awardedAt"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DEFAULT_CATEGORY is given to ideas without a category, it can not be
+	// renamed or deleted.
+	DEFAULT_CATEGORY = "Other"
+
+	MAX_CATEGORIES           = 50
+	MAX_CATEGORY_LENGTH      = 32
+	MAX_CATEGORY_ICON_LENGTH = 32
+)
+
+// DEFAULT_CATEGORIES seed the category catalogue of every user.
+var DEFAULT_CATEGORIES = []string{"Business", "Career", "Health", "Learning", "Life", "Relationship", DEFAULT_CATEGORY}
+
+var categoryColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Category is an entry of the category catalogue of a user. Names are
+// unique per user regardless of case.
+type Category struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Color     string             `json:"color" bson:"color"`
+	Icon      string             `json:"icon" bson:"icon"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Normalize trims the name and icon and lowercases the colour.
+func (c *Category) Normalize() {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Color = strings.ToLower(strings.TrimSpace(c.Color))
+	c.Icon = strings.TrimSpace(c.Icon)
+}
+
+// Validate checks a normalized category. The colour is optional and given
+// as "#rrggbb".
+func (c *Category) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("category name is empty")
+	}
+	if len([]rune(c.Name)) > MAX_CATEGORY_LENGTH {
+		return fmt.Errorf("category name is longer than %v characters", MAX_CATEGORY_LENGTH)
+	}
+	if c.Color != "" && !categoryColor.MatchString(c.Color) {
+		return fmt.Errorf("invalid category color %q", c.Color)
+	}
+	if len([]rune(c.Icon)) > MAX_CATEGORY_ICON_LENGTH {
+		return fmt.Errorf("category icon is longer than %v characters", MAX_CATEGORY_ICON_LENGTH)
+	}
+	return nil
+}
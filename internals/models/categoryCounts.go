@@ -0,0 +1,25 @@
+package models
+
+// CategoryCounts sums up the sessions of a category within a period.
+type CategoryCounts struct {
+	Category string `json:"category" bson:"_id"`
+	Sessions int    `json:"sessions" bson:"sessions"`
+	Ideas    int    `json:"ideas" bson:"ideas"`
+	Liked    int    `json:"liked" bson:"liked"`
+}
+
+// AverageIdeas returns the ideas per session, 0 without sessions.
+func (c CategoryCounts) AverageIdeas() float64 {
+	if c.Sessions == 0 {
+		return 0
+	}
+	return float64(c.Ideas) / float64(c.Sessions)
+}
+
+// LikedRatio returns the share of liked sessions, 0 without sessions.
+func (c CategoryCounts) LikedRatio() float64 {
+	if c.Sessions == 0 {
+		return 0
+	}
+	return float64(c.Liked) / float64(c.Sessions)
+}
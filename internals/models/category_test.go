@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCategoryValidate(t *testing.T) {
+	cases := []struct {
+		category Category
+		valid    bool
+	}{
+		{Category{Name: " Work ", Color: " #FFAA00 ", Icon: " briefcase "}, true},
+		{Category{Name: "Work"}, true},
+		{Category{Name: "  "}, false},
+		{Category{Name: strings.Repeat("a", MAX_CATEGORY_LENGTH+1)}, false},
+		{Category{Name: "Work", Color: "orange"}, false},
+		{Category{Name: "Work", Color: "#ffaa0"}, false},
+		{Category{Name: "Work", Icon: strings.Repeat("a", MAX_CATEGORY_ICON_LENGTH+1)}, false},
+	}
+
+	for _, c := range cases {
+		category := c.category
+		category.Normalize()
+		if err := category.Validate(); (err == nil) != c.valid {
+			t.Errorf("TestCategoryValidate: expected valid %v for %+v, got %v", c.valid, c.category, err)
+		}
+	}
+
+	category := Category{Name: " Work ", Color: "#FFAA00"}
+	category.Normalize()
+	if category.Name != "Work" || category.Color != "#ffaa00" {
+		t.Errorf("TestCategoryValidate: expected normalized category, got %+v", category)
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DEFAULT_PAGE_LIMIT = 20
+	MAX_PAGE_LIMIT     = 100
+)
+
+// Cursor is a position in a listing sorted by a time field and then _id,
+// both in Order (1 or -1). A cursor pages forward from the position, or
+// backward if Before is set. Clients only see it encoded.
+type Cursor struct {
+	Field  string             `json:"f"`
+	Order  int                `json:"o"`
+	Time   time.Time          `json:"t"`
+	ID     primitive.ObjectID `json:"id"`
+	Before bool               `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor.
+func (c *Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeCursor reads a cursor returned by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(decoded, &c); err != nil || c.Field == "" || (c.Order != 1 && c.Order != -1) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// Matches reports whether the cursor belongs to a listing sorted by field
+// in order.
+func (c *Cursor) Matches(field string, order int) error {
+	if c.Field != field || c.Order != order {
+		return fmt.Errorf("cursor belongs to another sort order")
+	}
+	return nil
+}
+
+// CursorPage tells how to get the pages around a page of a cursor
+// listing. Next or Prev are empty when there is nothing to fetch.
+type CursorPage struct {
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Limit int    `json:"limit"`
+}
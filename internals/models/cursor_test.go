@@ -0,0 +1,30 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := &Cursor{Field: "createdAt", Order: -1, Time: time.Date(2024, 6, 1, 10, 0, 0, 123e6, time.UTC), ID: primitive.NewObjectID(), Before: true}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil || !reflect.DeepEqual(decoded, cursor) {
+		t.Fatalf("TestCursor: expected %+v, got %+v and %v", cursor, decoded, err)
+	}
+	if err := decoded.Matches("createdAt", -1); err != nil {
+		t.Errorf("TestCursor: expected cursor to match its sort order, got %v", err)
+	}
+	if err := decoded.Matches("createdAt", 1); err == nil {
+		t.Errorf("TestCursor: expected cursor not to match another order")
+	}
+
+	for _, encoded := range []string{"", "not a cursor", (&Cursor{Field: "createdAt"}).Encode()} {
+		if _, err := DecodeCursor(encoded); err == nil {
+			t.Errorf("TestCursor: expected %q to be invalid", encoded)
+		}
+	}
+}
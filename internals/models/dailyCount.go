@@ -0,0 +1,8 @@
+package models
+
+// DailyCount is the activity of a user on a calendar day "2006-01-02".
+type DailyCount struct {
+	Date          string `json:"date" bson:"_id"`
+	TotalSessions int    `json:"totalSessions" bson:"totalSessions"`
+	TotalIdeas    int    `json:"totalIdeas" bson:"totalIdeas"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DailyStats rolls up the sessions of a user in one category on a calendar
+// day of the user's time zone. Day is the start of that day.
+type DailyStats struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	Day           time.Time          `json:"day" bson:"day"`
+	Timezone      string             `json:"timezone" bson:"timezone"`
+	Category      string             `json:"category" bson:"category"`
+	Sessions      int                `json:"sessions" bson:"sessions"`
+	Ideas         int                `json:"ideas" bson:"ideas"`
+	Liked         int                `json:"liked" bson:"liked"`
+	TimedSessions int                `json:"timedSessions" bson:"timedSessions"` // sessions with a recorded duration
+	TimedIdeas    int                `json:"timedIdeas" bson:"timedIdeas"`
+	Seconds       float64            `json:"seconds" bson:"seconds"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DELETION_PENDING   = "pending"
+	DELETION_COMPLETED = "completed"
+)
+
+// DeletionReceipt records an account deletion request and the steps of the
+// cascade that already succeeded, so a failed deletion can be resumed.
+// FirebaseUID and ImagePublicIDs are kept until completion because the user
+// document may already be gone when the deletion is resumed.
+type DeletionReceipt struct {
+	ID             primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	RequestedBy    primitive.ObjectID `json:"requestedBy,omitempty" bson:"requestedBy,omitempty"`
+	FirebaseUID    string             `json:"-" bson:"firebaseUid,omitempty"`
+	ImagePublicIDs []string           `json:"-" bson:"imagePublicIds,omitempty"`
+	Status         string             `json:"status,omitempty" bson:"status,omitempty"`
+	CompletedSteps []string           `json:"completedSteps" bson:"completedSteps"`
+	Deleted        map[string]int64   `json:"deleted" bson:"deleted"`
+	LastError      string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	CompletedAt    *time.Time         `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
+
+func (d *DeletionReceipt) MarshalBSON() ([]byte, error) {
+	// deal with time stamps
+	d.UpdatedAt = time.Now()
+
+	type custom DeletionReceipt
+	return bson.Marshal((*custom)(d))
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	GOAL_SESSIONS = "sessions"
+	GOAL_IDEAS    = "ideas"
+
+	GOAL_DAY  = "day"
+	GOAL_WEEK = "week"
+)
+
+// Goal is a target the user sets on the profile, like 5 sessions per week.
+type Goal struct {
+	Metric string `json:"metric" bson:"metric"`
+	Period string `json:"period" bson:"period"`
+	Target int    `json:"target" bson:"target"`
+}
+
+func (g Goal) Validate() error {
+	if g.Metric != GOAL_SESSIONS && g.Metric != GOAL_IDEAS {
+		return fmt.Errorf("invalid goal metric %q", g.Metric)
+	}
+	if g.Period != GOAL_DAY && g.Period != GOAL_WEEK {
+		return fmt.Errorf("invalid goal period %q", g.Period)
+	}
+	if g.Target < 1 {
+		return fmt.Errorf("goal target must be positive, got %v", g.Target)
+	}
+	return nil
+}
+
+// GoalProgress is the state of a goal in its current period, which runs
+// from From (inclusive) to To (exclusive).
+type GoalProgress struct {
+	Goal
+	Progress  int       `json:"progress"`
+	Completed bool      `json:"completed"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,13 +12,18 @@ type Idea struct {
 	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	TopicTitle string             `json:"topicTitle,omitempty" bson:"topicTitle,omitempty"`
 	Category   string             `json:"category,omitempty" bson:"category,omitempty"`
-	Ideas      *[]string          `json:"ideas,omitempty" bson:"ideas,omitempty"`
+	Tags       *[]string          `json:"tags,omitempty" bson:"tags,omitempty"` // normalized, see NormalizeTags
+	Ideas      *[]IdeaEntry       `json:"ideas,omitempty" bson:"ideas,omitempty"`
 	CreatedBy  primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
 	Viewed     *bool              `json:"viewed,omitempty" bson:"viewed,omitempty"`
 	IsLiked    *bool              `json:"isLiked,omitempty" bson:"isLiked,omitempty"`
 	Comment    *string            `json:"comment,omitempty" bson:"comment,omitempty"`
+	SessionID  primitive.ObjectID `json:"sessionId,omitempty" bson:"sessionId,omitempty"`
+	Duration   *float64           `json:"duration,omitempty" bson:"duration,omitempty"` // seconds, recorded by sessions
+	LateIdeas  *int               `json:"lateIdeas,omitempty" bson:"lateIdeas,omitempty"`
 	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt,omitempty"`
 	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+	SyncSeq    int64              `json:"-" bson:"syncSeq,omitempty"` // see SyncToken
 }
 
 func (i *Idea) MarshalBSON() ([]byte, error) {
@@ -27,3 +33,46 @@ func (i *Idea) MarshalBSON() ([]byte, error) {
 	type custom Idea
 	return bson.Marshal((*custom)(i))
 }
+
+// ideaJSON is the JSON form of an Idea. Ideas carries the plain texts that
+// clients read before entries were structured, Entries the full entries.
+type ideaJSON struct {
+	ideaFields
+	Ideas   *[]string    `json:"ideas,omitempty"`
+	Entries *[]IdeaEntry `json:"entries,omitempty"`
+}
+
+type ideaFields Idea
+
+func (i Idea) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.toJSON())
+}
+
+func (i Idea) toJSON() ideaJSON {
+	out := ideaJSON{ideaFields: ideaFields(i), Entries: i.Ideas}
+	if i.Ideas != nil {
+		texts := make([]string, len(*i.Ideas))
+		for n, entry := range *i.Ideas {
+			texts[n] = entry.Text
+		}
+		out.Ideas = &texts
+	}
+	return out
+}
+
+// UnmarshalJSON reads entries if given, so an idea read from a response can
+// be sent back unchanged, and ideas otherwise.
+func (i *Idea) UnmarshalJSON(data []byte) error {
+	var in struct {
+		*ideaFields
+		Entries *[]IdeaEntry `json:"entries"`
+	}
+	in.ideaFields = (*ideaFields)(i)
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Entries != nil {
+		i.Ideas = in.Entries
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// IdeaEntry is a single idea of a session. Offset is the time in
+// milliseconds from the start of the session until the idea was submitted;
+// it is only known for ideas recorded by a session.
+//
+// Records written before entries were structured store plain strings. Both
+// BSON and JSON decoding accept them, so they read as entries without an
+// offset.
+type IdeaEntry struct {
+	Text   string `json:"text" bson:"text"`
+	Offset *int64 `json:"offset,omitempty" bson:"offset,omitempty"`
+	Edited bool   `json:"edited" bson:"edited"`
+}
+
+func (e *IdeaEntry) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		text, ok := bsoncore.Value{Type: t, Data: data}.StringValueOK()
+		if !ok {
+			return errors.New("invalid legacy idea entry")
+		}
+		*e = IdeaEntry{Text: text}
+		return nil
+	case bsontype.EmbeddedDocument:
+		type custom IdeaEntry
+		var entry custom
+		if err := bson.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		*e = IdeaEntry(entry)
+		return nil
+	default:
+		return errors.Errorf("cannot decode %v into an idea entry", t)
+	}
+}
+
+func (e *IdeaEntry) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*e = IdeaEntry{Text: text}
+		return nil
+	}
+	type custom IdeaEntry
+	var entry custom
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	*e = IdeaEntry(entry)
+	return nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIdeaEntryDecodesLegacyStrings(t *testing.T) {
+	offset := int64(1500)
+	structured := []IdeaEntry{{Text: "idea_1", Offset: &offset, Edited: true}}
+
+	legacyBSON, _ := bson.Marshal(bson.M{"ideas": []string{"idea_1", "idea_2"}})
+	structuredBSON, _ := bson.Marshal(bson.M{"ideas": structured})
+	legacyJSON := []byte(`{"ideas": ["idea_1", "idea_2"]}`)
+	structuredJSON := []byte(`{"ideas": [{"text": "idea_1", "offset": 1500, "edited": true}]}`)
+
+	cases := []struct {
+		name   string
+		decode func(idea *Idea) error
+		want   []IdeaEntry
+	}{
+		{"legacy bson", func(idea *Idea) error { return bson.Unmarshal(legacyBSON, idea) }, []IdeaEntry{{Text: "idea_1"}, {Text: "idea_2"}}},
+		{"structured bson", func(idea *Idea) error { return bson.Unmarshal(structuredBSON, idea) }, structured},
+		{"legacy json", func(idea *Idea) error { return json.Unmarshal(legacyJSON, idea) }, []IdeaEntry{{Text: "idea_1"}, {Text: "idea_2"}}},
+		{"structured json", func(idea *Idea) error { return json.Unmarshal(structuredJSON, idea) }, structured},
+	}
+
+	for _, c := range cases {
+		var idea Idea
+		if err := c.decode(&idea); err != nil {
+			t.Errorf("TestIdeaEntryDecodesLegacyStrings %v: %v", c.name, err)
+			continue
+		}
+		if idea.Ideas == nil || len(*idea.Ideas) != len(c.want) {
+			t.Errorf("TestIdeaEntryDecodesLegacyStrings %v: expected %v entries, got %v", c.name, len(c.want), idea.Ideas)
+			continue
+		}
+		for i, entry := range *idea.Ideas {
+			want := c.want[i]
+			if entry.Text != want.Text || entry.Edited != want.Edited || (entry.Offset == nil) != (want.Offset == nil) || (entry.Offset != nil && *entry.Offset != *want.Offset) {
+				t.Errorf("TestIdeaEntryDecodesLegacyStrings %v: expected %v, got %v", c.name, want, entry)
+			}
+		}
+	}
+
+	numbers, _ := bson.Marshal(bson.M{"ideas": []int{1}})
+	var idea Idea
+	if err := bson.Unmarshal(numbers, &idea); err == nil {
+		t.Errorf("TestIdeaEntryDecodesLegacyStrings: expected numbers to be rejected, got %v", idea.Ideas)
+	}
+}
+
+func TestIdeaJSONKeepsLegacyIdeas(t *testing.T) {
+	offset := int64(1500)
+	entries := []IdeaEntry{{Text: "idea_1", Offset: &offset}, {Text: "idea_2", Edited: true}}
+	idea := Idea{TopicTitle: "topic_1", Ideas: &entries}
+
+	b, err := json.Marshal(IdeaSearchResult{Idea: idea, Score: 1.5})
+	if err != nil {
+		t.Fatalf("TestIdeaJSONKeepsLegacyIdeas: %v", err)
+	}
+	var raw struct {
+		TopicTitle string      `json:"topicTitle"`
+		Ideas      []string    `json:"ideas"`
+		Entries    []IdeaEntry `json:"entries"`
+		Score      float64     `json:"score"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatalf("TestIdeaJSONKeepsLegacyIdeas: expected ideas as strings, got %s", b)
+	}
+	if raw.TopicTitle != "topic_1" || len(raw.Ideas) != 2 || raw.Ideas[1] != "idea_2" || len(raw.Entries) != 2 || raw.Score != 1.5 {
+		t.Errorf("TestIdeaJSONKeepsLegacyIdeas: unexpected JSON %s", b)
+	}
+
+	// entries win over ideas when both are sent back
+	var decoded IdeaSearchResult
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("TestIdeaJSONKeepsLegacyIdeas: %v", err)
+	}
+	if decoded.Ideas == nil || len(*decoded.Ideas) != 2 || (*decoded.Ideas)[0].Offset == nil || !(*decoded.Ideas)[1].Edited || decoded.Score != 1.5 {
+		t.Errorf("TestIdeaJSONKeepsLegacyIdeas: expected entries to be decoded, got %v", decoded)
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MAX_SAVED_SEARCHES           = 50
+	MAX_PINNED_SEARCHES          = 10
+	MAX_SAVED_SEARCH_NAME_LENGTH = 64
+)
+
+// SavedSearch is a search request stored under a name. Request holds the
+// body of the search as it was sent rather than a struct, so fields the
+// search learns later and fields it drops do not break stored searches.
+// Pinned searches are shown as smart collections on the dashboard.
+type SavedSearch struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Request   bson.M             `json:"request" bson:"request"`
+	Pinned    bool               `json:"pinned" bson:"pinned"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Normalize trims the name.
+func (s *SavedSearch) Normalize() {
+	s.Name = strings.TrimSpace(s.Name)
+}
+
+// Validate checks the name of a normalized saved search. The request is
+// checked by the search itself.
+func (s *SavedSearch) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("saved search name is empty")
+	}
+	if len([]rune(s.Name)) > MAX_SAVED_SEARCH_NAME_LENGTH {
+		return fmt.Errorf("saved search name is longer than %v characters", MAX_SAVED_SEARCH_NAME_LENGTH)
+	}
+	return nil
+}
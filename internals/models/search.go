@@ -0,0 +1,44 @@
+package models
+
+import "encoding/json"
+
+// Highlight is a snippet of an idea field around the matches of a search.
+// The matches are wrapped in <mark> tags, the rest of the snippet is HTML
+// escaped.
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// IdeaSearchResult is an idea found by a search. Score is the text search
+// relevance and only set when sorting by relevance.
+type IdeaSearchResult struct {
+	Idea       `bson:",inline"`
+	Score      float64     `json:"score,omitempty" bson:"score,omitempty"`
+	Highlights []Highlight `json:"highlights,omitempty" bson:"-"`
+}
+
+// MarshalJSON adds the score and highlights to the JSON form of the idea,
+// whose own MarshalJSON would otherwise be promoted and drop them.
+func (r IdeaSearchResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ideaJSON
+		Score      float64     `json:"score,omitempty"`
+		Highlights []Highlight `json:"highlights,omitempty"`
+	}{r.Idea.toJSON(), r.Score, r.Highlights})
+}
+
+func (r *IdeaSearchResult) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Idea); err != nil {
+		return err
+	}
+	var extra struct {
+		Score      float64     `json:"score"`
+		Highlights []Highlight `json:"highlights"`
+	}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	r.Score, r.Highlights = extra.Score, extra.Highlights
+	return nil
+}
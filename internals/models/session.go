@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SESSION_ACTIVE   = "active"
+	SESSION_FINISHED = "finished"
+)
+
+// SessionEntry is an idea submitted during a session, timestamped by the server.
+type SessionEntry struct {
+	Text        string    `json:"text" bson:"text"`
+	SubmittedAt time.Time `json:"submittedAt" bson:"submittedAt"`
+	Late        bool      `json:"late,omitempty" bson:"late,omitempty"`
+}
+
+// Session is a training session in progress. The server decides when it
+// started and when its time is up; finishing it turns it into an Idea.
+type Session struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	TopicTitle string             `json:"topicTitle,omitempty" bson:"topicTitle,omitempty"`
+	Category   string             `json:"category,omitempty" bson:"category,omitempty"`
+	CreatedBy  primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	Status     string             `json:"status,omitempty" bson:"status,omitempty"`
+	StartedAt  time.Time          `json:"startedAt" bson:"startedAt"`
+	Deadline   time.Time          `json:"deadline" bson:"deadline"`
+	Entries    []SessionEntry     `json:"entries" bson:"entries"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	IdeaID     primitive.ObjectID `json:"ideaId,omitempty" bson:"ideaId,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
+
+func (s *Session) MarshalBSON() ([]byte, error) {
+	// deal with time stamps
+	s.UpdatedAt = time.Now()
+
+	type custom Session
+	return bson.Marshal((*custom)(s))
+}
+
+// Duration is the time spent in the session, capped at its time limit.
+func (s *Session) Duration() time.Duration {
+	end := s.Deadline
+	if s.FinishedAt != nil && s.FinishedAt.Before(end) {
+		end = *s.FinishedAt
+	}
+	return end.Sub(s.StartedAt)
+}
@@ -0,0 +1,15 @@
+package models
+
+// Streaks describes the runs of consecutive active days of a user. Dates are
+// calendar days formatted "2006-01-02" in the user's time zone. Up to Freezes
+// missed days can be bridged within a streak; they do not count towards it.
+type Streaks struct {
+	CurrentStreak      int    `json:"currentStreak"`
+	CurrentStreakStart string `json:"currentStreakStart,omitempty"`
+	ActiveToday        bool   `json:"activeToday"`
+	LongestStreak      int    `json:"longestStreak"`
+	LongestStreakStart string `json:"longestStreakStart,omitempty"`
+	LongestStreakEnd   string `json:"longestStreakEnd,omitempty"`
+	Freezes            int    `json:"freezes"`
+	FreezesUsed        int    `json:"freezesUsed"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SYNC_TOKEN_VERSION is the version of the current SyncToken layout.
+// Tokens of older versions have to sync from scratch again.
+const SYNC_TOKEN_VERSION = 2
+
+// ErrSyncTokenOutdated is returned by DecodeSyncToken for tokens of an
+// older version.
+var ErrSyncTokenOutdated = fmt.Errorf("sync token is outdated")
+
+// SyncToken marks how far a client has synced, as a position in the ideas
+// and one in the tombstones of the sync sequence of the user, which numbers
+// every write syncing clients pick up. IssuedAt tells whether tombstones
+// may have expired since. Clients only see it encoded.
+type SyncToken struct {
+	Version    int          `json:"v"`
+	Ideas      SyncPosition `json:"i"`
+	Tombstones SyncPosition `json:"t"`
+	IssuedAt   time.Time    `json:"at"`
+}
+
+// SyncPosition is a position in a listing sorted by sync sequence number
+// and then _id. Ideas moved together share a number, so ID is the last one
+// synced of Seq, or zero once all of them are. Ideas written before the
+// sequence existed have number 0.
+type SyncPosition struct {
+	Seq int64              `json:"s"`
+	ID  primitive.ObjectID `json:"id,omitempty"`
+}
+
+// Encode returns the opaque form of the token.
+func (t *SyncToken) Encode() string {
+	t.Version = SYNC_TOKEN_VERSION
+	encoded, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeSyncToken reads a token returned by Encode.
+func DecodeSyncToken(s string) (*SyncToken, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync token")
+	}
+	var t SyncToken
+	if err := json.Unmarshal(decoded, &t); err != nil {
+		return nil, fmt.Errorf("invalid sync token")
+	}
+	if t.Version != SYNC_TOKEN_VERSION {
+		return nil, ErrSyncTokenOutdated
+	}
+	return &t, nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MAX_TAGS       = 20
+	MAX_TAG_LENGTH = 32
+)
+
+// TagCount is a tag with the number of sessions carrying it.
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// NormalizeTags lowercases and trims tags and drops empty and repeated ones,
+// keeping the first occurrence in place.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ValidateTags checks normalized tags against the limits.
+func ValidateTags(tags []string) error {
+	if len(tags) > MAX_TAGS {
+		return fmt.Errorf("at most %v tags are allowed, got %v", MAX_TAGS, len(tags))
+	}
+	for _, tag := range tags {
+		if len([]rune(tag)) > MAX_TAG_LENGTH {
+			return fmt.Errorf("tag %q is longer than %v characters", tag, MAX_TAG_LENGTH)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	cases := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{" Work ", "work", "WORK"}, []string{"work"}},
+		{[]string{"Focus", "", "  ", "deep Work", "focus"}, []string{"focus", "deep work"}},
+	}
+
+	for _, c := range cases {
+		if got := NormalizeTags(c.tags); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TestNormalizeTags: expected %q for %q, got %q", c.want, c.tags, got)
+		}
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	if err := ValidateTags([]string{"work", strings.Repeat("あ", MAX_TAG_LENGTH)}); err != nil {
+		t.Errorf("TestValidateTags: expected tags within the limits to pass, got %v", err)
+	}
+	if err := ValidateTags([]string{strings.Repeat("a", MAX_TAG_LENGTH+1)}); err == nil {
+		t.Errorf("TestValidateTags: expected too long tag to fail")
+	}
+	tooMany := make([]string, MAX_TAGS+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("a", i+1)
+	}
+	if err := ValidateTags(tooMany); err == nil {
+		t.Errorf("TestValidateTags: expected too many tags to fail")
+	}
+}
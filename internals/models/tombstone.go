@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TOMBSTONE_RETENTION is how long deletions are kept for syncing clients.
+// Clients that did not sync for longer have to sync from scratch.
+const TOMBSTONE_RETENTION = 90 * 24 * time.Hour
+
+// Tombstone records the deletion of an idea, so syncing clients learn
+// about it.
+type Tombstone struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	IdeaID    primitive.ObjectID `json:"ideaId" bson:"ideaId"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	DeletedAt time.Time          `json:"deletedAt" bson:"deletedAt"`
+	SyncSeq   int64              `json:"-" bson:"syncSeq"` // see SyncToken
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TopicAttempt is one session on a revisited topic.
+type TopicAttempt struct {
+	IdeaID    primitive.ObjectID `json:"ideaId" bson:"ideaId"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	Ideas     int                `json:"ideas" bson:"ideas"`
+}
+
+// TopicHistory lists the attempts on a topic title, oldest first. Titles
+// are matched ignoring case and surrounding spaces.
+type TopicHistory struct {
+	TopicTitle string         `json:"topicTitle" bson:"topicTitle"`
+	Attempts   []TopicAttempt `json:"attempts" bson:"attempts"`
+}
@@ -16,6 +16,9 @@ type User struct {
 	Email       string             `json:"email,omitempty" validate:"required,email" bson:"email,omitempty"`
 	Role        guard.Role         `json:"role,omitempty" bson:"role,omitempty"`
 	Images      []Image            `json:"images" bson:"images"`
+	Suspended   *bool              `json:"suspended,omitempty" bson:"suspended,omitempty"`
+	Timezone    string             `json:"timezone,omitempty" bson:"timezone,omitempty"` // IANA name, UTC if empty
+	Goals       []Goal             `json:"goals,omitempty" bson:"goals,omitempty"`
 	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
 	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
 }
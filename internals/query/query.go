@@ -0,0 +1,289 @@
+// Package query parses the search box syntax of idea searches, like
+//
+//	category:work tag:focus liked:true before:2024-06-01 "exact phrase" -excluded
+//
+// into MongoDB filters over the idea records. Words and quoted phrases
+// must all occur in an idea, words and phrases prefixed with "-" must not.
+// Filters take a single value, which may be quoted; tag can be repeated.
+package query
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/models"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	FILTER_CATEGORY = "category"
+	FILTER_TAG      = "tag"
+	FILTER_LIKED    = "liked"
+	FILTER_BEFORE   = "before"
+	FILTER_AFTER    = "after"
+
+	DATE_LAYOUT = "2006-01-02"
+)
+
+// FILTERS lists the filter keys in the order they are documented.
+var FILTERS = []string{FILTER_CATEGORY, FILTER_TAG, FILTER_LIKED, FILTER_BEFORE, FILTER_AFTER}
+
+// ParseError describes invalid query syntax. Pos is the 1-based position
+// of the offending token in runes.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at position %v", e.Msg, e.Pos)
+}
+
+// Query is a parsed search query. Dates are calendar days, which Filter
+// cuts in the time zone of the user.
+type Query struct {
+	Terms    []string
+	Excluded []string
+	Category string
+	Tags     []string
+	Liked    *bool
+	Before   *time.Time // ideas created before this day
+	After    *time.Time // ideas created after this day
+}
+
+func parseError(pos int, format string, args ...interface{}) error {
+	return &ParseError{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// readQuoted reads the quoted text starting at the quote at pos and returns
+// it with the position after the closing quote.
+func readQuoted(runes []rune, pos int) (string, int, error) {
+	for end := pos + 1; end < len(runes); end++ {
+		if runes[end] == '"' {
+			return string(runes[pos+1 : end]), end + 1, nil
+		}
+	}
+	return "", 0, parseError(pos, "unterminated quote")
+}
+
+// readValue reads the value of a filter starting at pos, quoted or up to the
+// next space.
+func readValue(runes []rune, pos int) (string, int, error) {
+	if pos < len(runes) && runes[pos] == '"' {
+		return readQuoted(runes, pos)
+	}
+	end := pos
+	for end < len(runes) && !unicode.IsSpace(runes[end]) {
+		end++
+	}
+	return string(runes[pos:end]), end, nil
+}
+
+// Parse parses input. The empty query matches every idea.
+func Parse(input string) (*Query, error) {
+	q := &Query{Terms: []string{}, Excluded: []string{}, Tags: []string{}}
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		negated := false
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			negated = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			phrase, next, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			q.addText(phrase, negated)
+			i = next
+			continue
+		}
+
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ':' {
+			end++
+		}
+		if end < len(runes) && runes[end] == ':' && end > i {
+			if negated {
+				return nil, parseError(start, "filters can not be negated")
+			}
+			key := strings.ToLower(string(runes[i:end]))
+			value, next, err := readValue(runes, end+1)
+			if err != nil {
+				return nil, err
+			}
+			if err := q.setFilter(key, strings.TrimSpace(value), start); err != nil {
+				return nil, err
+			}
+			i = next
+			continue
+		}
+
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		q.addText(string(runes[i:end]), negated)
+		i = end
+	}
+
+	// both bounds exclude their own day, so a day must lie between them
+	if q.Before != nil && q.After != nil && !q.After.AddDate(0, 0, 1).Before(*q.Before) {
+		return nil, &ParseError{Pos: 1, Msg: "after must be at least two days earlier than before"}
+	}
+	return q, nil
+}
+
+func (q *Query) addText(text string, negated bool) {
+	if text = strings.TrimSpace(text); text == "" {
+		return
+	}
+	if negated {
+		q.Excluded = append(q.Excluded, text)
+	} else {
+		q.Terms = append(q.Terms, text)
+	}
+}
+
+func (q *Query) setFilter(key string, value string, pos int) error {
+	if value == "" {
+		return parseError(pos, "missing value for %v", key)
+	}
+	switch key {
+	case FILTER_CATEGORY:
+		if q.Category != "" {
+			return parseError(pos, "category is given twice")
+		}
+		q.Category = value
+	case FILTER_TAG:
+		q.Tags = append(q.Tags, value)
+	case FILTER_LIKED:
+		if q.Liked != nil {
+			return parseError(pos, "liked is given twice")
+		}
+		switch strings.ToLower(value) {
+		case "true":
+			q.Liked = &[]bool{true}[0]
+		case "false":
+			q.Liked = &[]bool{false}[0]
+		default:
+			return parseError(pos, "liked must be true or false, got %q", value)
+		}
+	case FILTER_BEFORE, FILTER_AFTER:
+		day, err := time.Parse(DATE_LAYOUT, value)
+		if err != nil {
+			return parseError(pos, "%v must be a date like 2024-06-01, got %q", key, value)
+		}
+		target := &q.Before
+		if key == FILTER_AFTER {
+			target = &q.After
+		}
+		if *target != nil {
+			return parseError(pos, "%v is given twice", key)
+		}
+		*target = &day
+	default:
+		return parseError(pos, "unknown filter %q, use one of %v", key, strings.Join(FILTERS, ", "))
+	}
+	return nil
+}
+
+// TextFilter matches text literally and regardless of case in any
+// searchable field of an idea, the same fields as the ideas text index.
+func TextFilter(text string) []bson.M {
+	pattern := bson.M{"$regex": regexp.QuoteMeta(text), "$options": "i"}
+	return []bson.M{
+		{"topicTitle": pattern},
+		{"ideas": pattern},
+		{"ideas.text": pattern},
+		{"comment": pattern},
+		{"tags": pattern},
+		{"category": pattern},
+	}
+}
+
+// HasText reports whether the query has words or phrases to match.
+func (q *Query) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Excluded) > 0
+}
+
+// Filter returns the filter of the field filters of the query, with the
+// days cut in loc. Words and phrases are left to TextFilter or TextSearch.
+func (q *Query) Filter(loc *time.Location) bson.M {
+	filter := bson.M{}
+	if q.Category != "" {
+		// categories are matched as a whole, regardless of case
+		filter["category"] = bson.M{"$regex": "^" + regexp.QuoteMeta(q.Category) + "$", "$options": "i"}
+	}
+	if tags := models.NormalizeTags(q.Tags); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+	if q.Liked != nil {
+		if *q.Liked {
+			filter["isLiked"] = true
+		} else {
+			filter["isLiked"] = bson.M{"$ne": true}
+		}
+	}
+
+	createdAt := bson.M{}
+	if q.Before != nil {
+		createdAt["$lt"] = time.Date(q.Before.Year(), q.Before.Month(), q.Before.Day(), 0, 0, 0, 0, loc)
+	}
+	if q.After != nil {
+		createdAt["$gte"] = time.Date(q.After.Year(), q.After.Month(), q.After.Day()+1, 0, 0, 0, 0, loc)
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	return filter
+}
+
+// TextFilter returns the regular expression filter of the words and
+// phrases of the query.
+func (q *Query) TextFilter() bson.M {
+	filter := bson.M{}
+	if len(q.Terms) > 0 {
+		terms := make([]bson.M, 0, len(q.Terms))
+		for _, term := range q.Terms {
+			terms = append(terms, bson.M{"$or": TextFilter(term)})
+		}
+		filter["$and"] = terms
+	}
+	if len(q.Excluded) > 0 {
+		excluded := []bson.M{}
+		for _, term := range q.Excluded {
+			excluded = append(excluded, TextFilter(term)...)
+		}
+		filter["$nor"] = excluded
+	}
+	return filter
+}
+
+// TextSearch renders the words and phrases of the query in the syntax of
+// MongoDB text searches.
+func (q *Query) TextSearch() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Excluded))
+	render := func(text string) string {
+		if strings.IndexFunc(text, unicode.IsSpace) >= 0 {
+			return `"` + text + `"`
+		}
+		return text
+	}
+	for _, term := range q.Terms {
+		parts = append(parts, render(term))
+	}
+	for _, term := range q.Excluded {
+		parts = append(parts, "-"+render(term))
+	}
+	return strings.Join(parts, " ")
+}
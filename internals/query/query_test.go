@@ -0,0 +1,141 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`Category:"Deep Work" tag:Focus tag:morning liked:true before:2024-06-01 after:2024-05-01 "exact phrase" plan -excluded -"not this"`)
+	if err != nil {
+		t.Fatalf("TestParse: %v", err)
+	}
+
+	before := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	want := &Query{
+		Terms:    []string{"exact phrase", "plan"},
+		Excluded: []string{"excluded", "not this"},
+		Category: "Deep Work",
+		Tags:     []string{"Focus", "morning"},
+		Liked:    &[]bool{true}[0],
+		Before:   &before,
+		After:    &after,
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("TestParse: expected %+v, got %+v", want, q)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	cases := []struct {
+		input    string
+		terms    []string
+		excluded []string
+	}{
+		{"", []string{}, []string{}},
+		{"  a  b ", []string{"a", "b"}, []string{}},
+		{`- a -b ""`, []string{"-", "a"}, []string{"b"}},
+		{":x", []string{":x"}, []string{}},
+	}
+
+	for _, c := range cases {
+		q, err := Parse(c.input)
+		if err != nil {
+			t.Errorf("TestParseText: %q: %v", c.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Terms, c.terms) || !reflect.DeepEqual(q.Excluded, c.excluded) {
+			t.Errorf("TestParseText: expected %q and %q for %q, got %q and %q", c.terms, c.excluded, c.input, q.Terms, q.Excluded)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		err   string
+	}{
+		{`plan "open`, "unterminated quote at position 6"},
+		{`category:"open`, "unterminated quote at position 10"},
+		{"catgory:work", `unknown filter "catgory", use one of category, tag, liked, before, after at position 1`},
+		{"a category:", "missing value for category at position 3"},
+		{"at 12:30", `unknown filter "12", use one of category, tag, liked, before, after at position 4`},
+		{"liked:maybe", `liked must be true or false, got "maybe" at position 1`},
+		{"before:June", `before must be a date like 2024-06-01, got "June" at position 1`},
+		{"category:a category:b", "category is given twice at position 12"},
+		{"-tag:a", "filters can not be negated at position 1"},
+		{"after:2024-06-01 before:2024-06-01", "after must be at least two days earlier than before at position 1"},
+		{"after:2024-06-01 before:2024-06-02", "after must be at least two days earlier than before at position 1"},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.input)
+		if _, ok := err.(*ParseError); !ok || err.Error() != c.err {
+			t.Errorf("TestParseErrors: expected %q for %q, got %v", c.err, c.input, err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	q, err := Parse("category:work+ tag:Focus tag:focus liked:false before:2024-06-01 after:2024-05-01")
+	if err != nil {
+		t.Fatalf("TestFilter: %v", err)
+	}
+
+	want := bson.M{
+		"category": bson.M{"$regex": `^work\+$`, "$options": "i"},
+		"tags":     bson.M{"$all": []string{"focus"}},
+		"isLiked":  bson.M{"$ne": true},
+		"createdAt": bson.M{
+			"$lt":  time.Date(2024, 6, 1, 0, 0, 0, 0, loc),
+			"$gte": time.Date(2024, 5, 2, 0, 0, 0, 0, loc),
+		},
+	}
+	if got := q.Filter(loc); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestFilter: expected %v, got %v", want, got)
+	}
+
+	empty, _ := Parse("")
+	if got := empty.Filter(loc); len(got) != 0 || len(empty.TextFilter()) != 0 || empty.HasText() {
+		t.Errorf("TestFilter: expected the empty query to match everything, got %v", got)
+	}
+}
+
+func TestTextFilter(t *testing.T) {
+	q, _ := Parse(`"a.b" c -d`)
+
+	filter := q.TextFilter()
+	terms, _ := filter["$and"].([]bson.M)
+	excluded, _ := filter["$nor"].([]bson.M)
+	if len(terms) != 2 || len(excluded) != len(TextFilter("d")) {
+		t.Fatalf("TestTextFilter: expected 2 terms and 1 excluded term, got %v", filter)
+	}
+	if !reflect.DeepEqual(terms[0], bson.M{"$or": TextFilter("a.b")}) {
+		t.Errorf("TestTextFilter: unexpected term filter %v", terms[0])
+	}
+	if pattern := TextFilter("a.b")[0]["topicTitle"].(bson.M)["$regex"]; pattern != `a\.b` {
+		t.Errorf("TestTextFilter: expected escaped pattern, got %v", pattern)
+	}
+	fields := []string{}
+	for _, field := range TextFilter("a") {
+		for key := range field {
+			fields = append(fields, key)
+		}
+	}
+	if want := []string{"topicTitle", "ideas", "ideas.text", "comment", "tags", "category"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("TestTextFilter: expected the fields of the text index %v, got %v", want, fields)
+	}
+
+	if got := q.TextSearch(); got != "a.b c -d" {
+		t.Errorf("TestTextFilter: expected text search %q, got %q", "a.b c -d", got)
+	}
+	phrases, _ := Parse(`"deep work" -"not this"`)
+	if got := phrases.TextSearch(); got != `"deep work" -"not this"` {
+		t.Errorf("TestTextFilter: expected phrases to stay quoted, got %q", got)
+	}
+}
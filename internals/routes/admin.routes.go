@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/middleware"
+	"idea-training-version-go/internals/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRoutes struct {
+	AdminService services.IAdminService
+	RequireAuth  middleware.RequireAuth
+}
+
+func NewAdminRoutes(adminService services.IAdminService, requireAuth middleware.RequireAuth) AdminRoutes {
+	return AdminRoutes{
+		AdminService: adminService,
+		RequireAuth:  requireAuth,
+	}
+}
+
+func (ar *AdminRoutes) AdminRoutes(rg *gin.RouterGroup) {
+	adminroute := rg.Group("/admin", ar.RequireAuth.AllowIfLogIn, ar.RequireAuth.AllowIfIDToken, ar.RequireAuth.AllowIfRole(guard.Admin))
+
+	adminroute.GET("/users", ar.RequireAuth.AllowIfPermitted(guard.ReadAnyUsers), ar.AdminService.ListUsers)
+	adminroute.GET("/users/:id", ar.RequireAuth.AllowIfPermitted(guard.ReadAnyUsers, guard.ReadAnyIdeas), ar.AdminService.GetUserSummary)
+	adminroute.PUT("/users/:id/role", ar.RequireAuth.AllowIfPermitted(guard.WriteAnyUsers), ar.AdminService.UpdateUserRole)
+	adminroute.PUT("/users/:id/suspend", ar.RequireAuth.AllowIfPermitted(guard.WriteAnyUsers), ar.AdminService.SuspendUser)
+	adminroute.PUT("/users/:id/unsuspend", ar.RequireAuth.AllowIfPermitted(guard.WriteAnyUsers), ar.AdminService.UnsuspendUser)
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/middleware"
+	"idea-training-version-go/internals/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryRoutes struct {
+	CategoryService services.ICategoryService
+	RequireAuth     middleware.RequireAuth
+}
+
+func NewCategoryRoutes(categoryService services.ICategoryService, requireAuth middleware.RequireAuth) CategoryRoutes {
+	return CategoryRoutes{
+		CategoryService: categoryService,
+		RequireAuth:     requireAuth,
+	}
+}
+
+func (cr *CategoryRoutes) CategoryRoutes(rg *gin.RouterGroup) {
+	categoryroute := rg.Group("/categories")
+
+	categoryroute.GET("/", cr.RequireAuth.AllowIfLogIn, cr.RequireAuth.AllowIfScope(guard.IdeasRead), cr.CategoryService.GetCategories)
+	categoryroute.POST("/", cr.RequireAuth.AllowIfLogIn, cr.RequireAuth.AllowIfScope(guard.IdeasWrite), cr.CategoryService.CreateCategory)
+	categoryroute.PUT("/:id", cr.RequireAuth.AllowIfLogIn, cr.RequireAuth.AllowIfScope(guard.IdeasWrite), cr.CategoryService.UpdateCategory)
+	categoryroute.DELETE("/:id", cr.RequireAuth.AllowIfLogIn, cr.RequireAuth.AllowIfScope(guard.IdeasWrite), cr.CategoryService.DeleteCategory)
+}
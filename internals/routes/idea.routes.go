@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/middleware"
 	"idea-training-version-go/internals/services"
 
@@ -22,15 +23,23 @@ func NewIdeaRoutes(ideaService services.IIdeaService, requireAuth middleware.Req
 func (ir *IdeaRoutes) IdeaRoutes(rg *gin.RouterGroup) {
 	idearoute := rg.Group("/ideas")
 
-	idearoute.POST("/", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.CreateIdea)
-	idearoute.GET("/", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetAllIdeas)
-	idearoute.GET("/:id", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetIdeaByID)
-	idearoute.PUT("/:id", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.UpdateIdea)
-	idearoute.DELETE("/:id", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.DeleteIdea)
-	idearoute.GET("/total/today", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetTotalIdeasOfToday)
-	idearoute.GET("/total/all", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetTotalIdeasOfAllTime)
-	idearoute.GET("/total/consecutive", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetTotalConsecutiveDays)
-	idearoute.GET("/recent", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetRecentIdeas)
-	idearoute.GET("/weekly", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.GetWeeklyIdeas)
-	idearoute.POST("/search", ir.RequireAuth.AllowIfLogIn, ir.IdeaService.SearchIdeas)
+	idearoute.POST("/", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasWrite), ir.IdeaService.CreateIdea)
+	idearoute.GET("/", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetAllIdeas)
+	idearoute.GET("/:id", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetIdeaByID)
+	idearoute.PUT("/:id", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasWrite), ir.IdeaService.UpdateIdea)
+	idearoute.DELETE("/:id", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasWrite), ir.IdeaService.DeleteIdea)
+	idearoute.GET("/total/today", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTotalIdeasOfToday)
+	idearoute.GET("/total/all", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTotalIdeasOfAllTime)
+	idearoute.GET("/total/consecutive", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTotalConsecutiveDays)
+	idearoute.GET("/recent", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetRecentIdeas)
+	idearoute.GET("/weekly", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetWeeklyIdeas)
+	idearoute.GET("/stats/first-idea", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTimeToFirstIdea)
+	idearoute.GET("/stats/pace", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetIdeasPerMinute)
+	idearoute.GET("/stats/heatmap", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetHeatmap)
+	idearoute.GET("/stats/categories", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetCategoryStats)
+	idearoute.GET("/stats/topics", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTopicStats)
+	idearoute.GET("/tags", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetTags)
+	idearoute.GET("/changes", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.GetChanges)
+	idearoute.POST("/sync", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasWrite), ir.IdeaService.SyncIdeas)
+	idearoute.POST("/search", ir.RequireAuth.AllowIfLogIn, ir.RequireAuth.AllowIfScope(guard.IdeasRead), ir.IdeaService.SearchIdeas)
 }
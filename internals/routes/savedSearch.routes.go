@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/middleware"
+	"idea-training-version-go/internals/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SavedSearchRoutes struct {
+	SavedSearchService services.ISavedSearchService
+	RequireAuth        middleware.RequireAuth
+}
+
+func NewSavedSearchRoutes(savedSearchService services.ISavedSearchService, requireAuth middleware.RequireAuth) SavedSearchRoutes {
+	return SavedSearchRoutes{
+		SavedSearchService: savedSearchService,
+		RequireAuth:        requireAuth,
+	}
+}
+
+func (sr *SavedSearchRoutes) SavedSearchRoutes(rg *gin.RouterGroup) {
+	searchroute := rg.Group("/searches")
+
+	searchroute.GET("/", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasRead), sr.SavedSearchService.GetSavedSearches)
+	searchroute.POST("/", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SavedSearchService.CreateSavedSearch)
+	searchroute.GET("/collections", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasRead), sr.SavedSearchService.GetSmartCollections)
+	searchroute.PUT("/:id", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SavedSearchService.UpdateSavedSearch)
+	searchroute.DELETE("/:id", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SavedSearchService.DeleteSavedSearch)
+	searchroute.GET("/:id/results", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasRead), sr.SavedSearchService.GetSavedSearchResults)
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/middleware"
+	"idea-training-version-go/internals/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionRoutes struct {
+	SessionService services.ISessionService
+	RequireAuth    middleware.RequireAuth
+}
+
+func NewSessionRoutes(sessionService services.ISessionService, requireAuth middleware.RequireAuth) SessionRoutes {
+	return SessionRoutes{
+		SessionService: sessionService,
+		RequireAuth:    requireAuth,
+	}
+}
+
+func (sr *SessionRoutes) SessionRoutes(rg *gin.RouterGroup) {
+	sessionroute := rg.Group("/sessions")
+
+	sessionroute.POST("/start", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SessionService.StartSession)
+	sessionroute.GET("/:id", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasRead), sr.SessionService.GetSession)
+	sessionroute.POST("/:id/ideas", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SessionService.AddSessionIdea)
+	sessionroute.GET("/:id/stream", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasRead), sr.SessionService.StreamSession)
+	sessionroute.POST("/:id/finish", sr.RequireAuth.AllowIfLogIn, sr.RequireAuth.AllowIfScope(guard.IdeasWrite), sr.SessionService.FinishSession)
+}
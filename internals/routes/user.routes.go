@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/middleware"
 	"idea-training-version-go/internals/services"
 
@@ -8,23 +9,37 @@ import (
 )
 
 type UserRoutes struct {
-	UserService services.IUserService
-	RequireAuth middleware.RequireAuth
+	UserService        services.IUserService
+	AccessTokenService services.IAccessTokenService
+	AccountService     services.IAccountService
+	AchievementService services.IAchievementService
+	RequireAuth        middleware.RequireAuth
 }
 
-func NewUserRoutes(userService services.IUserService, requireAuth middleware.RequireAuth) UserRoutes {
+func NewUserRoutes(userService services.IUserService, accessTokenService services.IAccessTokenService, accountService services.IAccountService, achievementService services.IAchievementService, requireAuth middleware.RequireAuth) UserRoutes {
 	return UserRoutes{
-		UserService: userService,
-		RequireAuth: requireAuth,
+		UserService:        userService,
+		AccessTokenService: accessTokenService,
+		AccountService:     accountService,
+		AchievementService: achievementService,
+		RequireAuth:        requireAuth,
 	}
 }
 
 func (ur *UserRoutes) UserRoutes(rg *gin.RouterGroup) {
 	userroute := rg.Group("/users")
 
-	userroute.POST("/signup", ur.UserService.SignUp)
+	userroute.POST("/signup", ur.RequireAuth.VerifyIDTokenIfPresent, ur.UserService.SignUp)
 	userroute.GET("/", ur.UserService.GetUserByEmail)
-	userroute.PUT("/:id", ur.RequireAuth.AllowIfLogIn, ur.UserService.UpdateUser)
-	userroute.POST("/images", ur.RequireAuth.AllowIfLogIn, ur.UserService.UploadImageCloudinary)
-	userroute.PUT("/images", ur.RequireAuth.AllowIfLogIn, ur.UserService.RemoveImageCloudinary)
+	userroute.PUT("/:id", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.UserService.UpdateUser)
+	userroute.GET("/me/export", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfScope(guard.IdeasRead), ur.AccountService.ExportAccount)
+	userroute.GET("/me/goals", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfScope(guard.IdeasRead), ur.AchievementService.GetGoals)
+	userroute.PUT("/me/goals", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.AchievementService.UpdateGoals)
+	userroute.GET("/me/badges", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfScope(guard.IdeasRead), ur.AchievementService.GetBadges)
+	userroute.DELETE("/:id", ur.RequireAuth.AllowIfLogInSuspended, ur.RequireAuth.AllowIfIDToken, ur.AccountService.DeleteAccount)
+	userroute.POST("/images", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.UserService.UploadImageCloudinary)
+	userroute.PUT("/images", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.UserService.RemoveImageCloudinary)
+	userroute.POST("/tokens", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.AccessTokenService.CreateAccessToken)
+	userroute.GET("/tokens", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.AccessTokenService.GetAccessTokens)
+	userroute.DELETE("/tokens/:id", ur.RequireAuth.AllowIfLogIn, ur.RequireAuth.AllowIfIDToken, ur.AccessTokenService.RevokeAccessToken)
 }
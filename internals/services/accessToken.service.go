@@ -0,0 +1,137 @@
+package services
+
+import (
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IAccessTokenService interface {
+	CreateAccessToken(ctx *gin.Context)
+	GetAccessTokens(ctx *gin.Context)
+	RevokeAccessToken(ctx *gin.Context)
+}
+
+type AccessTokenService struct {
+	AccessTokenController controllers.IAccessTokenController
+}
+
+func NewAccessTokenService(accessTokenController controllers.IAccessTokenController) IAccessTokenService {
+	return &AccessTokenService{
+		AccessTokenController: accessTokenController,
+	}
+}
+
+func (as *AccessTokenService) CreateAccessToken(ctx *gin.Context) {
+	type RequestBody struct {
+		Name      string        `json:"name"`
+		Scopes    []guard.Scope `json:"scopes"`
+		ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if req.Name == "" {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Token name is required")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "At least one scope is required")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			res := utils.NewHttpResponse(http.StatusBadRequest, "Invalid scope "+string(scope))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Expiry must be in the future")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	plainToken, tokenHash, err := utils.GenerateAccessToken()
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in generating access token"))
+		ctx.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	accessToken := &models.AccessToken{
+		Name:      req.Name,
+		TokenHash: tokenHash,
+		Prefix:    plainToken[:len(utils.ACCESS_TOKEN_PREFIX)+4],
+		Scopes:    req.Scopes,
+		CreatedBy: utils.FetchUserFromCtx(ctx),
+		ExpiresAt: req.ExpiresAt,
+	}
+	newToken, err := as.AccessTokenController.CreateAccessToken(accessToken)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating access token"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	// the plain token is only returned once and never stored
+	type ResponseBody struct {
+		Token       string              `json:"token"`
+		AccessToken *models.AccessToken `json:"accessToken"`
+	}
+
+	res := utils.NewHttpResponse(http.StatusCreated, &ResponseBody{Token: plainToken, AccessToken: newToken})
+	ctx.JSON(http.StatusCreated, res)
+}
+
+func (as *AccessTokenService) GetAccessTokens(ctx *gin.Context) {
+	userID := utils.FetchUserFromCtx(ctx)
+
+	tokens, err := as.AccessTokenController.GetAccessTokens(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting access tokens"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, tokens)
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (as *AccessTokenService) RevokeAccessToken(ctx *gin.Context) {
+	tokenID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid access token id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if err := as.AccessTokenController.DeleteAccessToken(tokenID, utils.FetchUserFromCtx(ctx)); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			res := utils.NewHttpResponse(http.StatusNotFound, "Access token not found")
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in revoking access token"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, "Access token revoked successfully")
+	ctx.JSON(http.StatusOK, res)
+}
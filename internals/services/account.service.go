@@ -0,0 +1,374 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IImageStore manages uploaded user images.
+type IImageStore interface {
+	DeleteImage(publicID string) error
+}
+
+type IAccountService interface {
+	DeleteAccount(ctx *gin.Context)
+	ExportAccount(ctx *gin.Context)
+}
+
+type AccountService struct {
+	UserController            controllers.IUserController
+	IdeaController            controllers.IIdeaController
+	SessionController         controllers.ISessionController
+	DailyStatsController      controllers.IDailyStatsController
+	BadgeController           controllers.IBadgeController
+	CategoryController        controllers.ICategoryController
+	SavedSearchController     controllers.ISavedSearchController
+	AccessTokenController     controllers.IAccessTokenController
+	DeletionReceiptController controllers.IDeletionReceiptController
+	IdentityProvider          IIdentityProvider
+	ImageStore                IImageStore
+}
+
+func NewAccountService(
+	userController controllers.IUserController,
+	ideaController controllers.IIdeaController,
+	sessionController controllers.ISessionController,
+	dailyStatsController controllers.IDailyStatsController,
+	badgeController controllers.IBadgeController,
+	categoryController controllers.ICategoryController,
+	savedSearchController controllers.ISavedSearchController,
+	accessTokenController controllers.IAccessTokenController,
+	deletionReceiptController controllers.IDeletionReceiptController,
+	identityProvider IIdentityProvider,
+	imageStore IImageStore,
+) IAccountService {
+	return &AccountService{
+		UserController:            userController,
+		IdeaController:            ideaController,
+		SessionController:         sessionController,
+		DailyStatsController:      dailyStatsController,
+		BadgeController:           badgeController,
+		CategoryController:        categoryController,
+		SavedSearchController:     savedSearchController,
+		AccessTokenController:     accessTokenController,
+		DeletionReceiptController: deletionReceiptController,
+		IdentityProvider:          identityProvider,
+		ImageStore:                imageStore,
+	}
+}
+
+type deletionStep struct {
+	name string
+	run  func(receipt *models.DeletionReceipt) (int64, error)
+}
+
+// deletionSteps lists the cascade of an account deletion in order. Every step
+// must be idempotent, as a resumed deletion runs all of them again and so
+// also deletes data created after an earlier attempt failed. Signing in
+// takes both the identity and the user document, so the identity goes
+// before the document: its owner can resume every failure up to deleting
+// the identity, admins one deleting the document after it.
+func (as *AccountService) deletionSteps() []deletionStep {
+	return []deletionStep{
+		{"ideas", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.IdeaController.DeleteIdeasOfUser(receipt.UserID)
+		}},
+		{"tombstones", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.IdeaController.DeleteTombstonesOfUser(receipt.UserID)
+		}},
+		{"sessions", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.SessionController.DeleteSessionsOfUser(receipt.UserID)
+		}},
+		{"dailyStats", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.DailyStatsController.DeleteStatsOfUser(receipt.UserID)
+		}},
+		{"badges", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.BadgeController.DeleteBadgesOfUser(receipt.UserID)
+		}},
+		{"categories", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.CategoryController.DeleteCategoriesOfUser(receipt.UserID)
+		}},
+		{"savedSearches", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.SavedSearchController.DeleteSavedSearchesOfUser(receipt.UserID)
+		}},
+		{"accessTokens", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.AccessTokenController.DeleteAccessTokensOfUser(receipt.UserID)
+		}},
+		{"images", func(receipt *models.DeletionReceipt) (int64, error) {
+			for _, publicID := range receipt.ImagePublicIDs {
+				if err := as.ImageStore.DeleteImage(publicID); err != nil {
+					return 0, err
+				}
+			}
+			return int64(len(receipt.ImagePublicIDs)), nil
+		}},
+		{"firebase", func(receipt *models.DeletionReceipt) (int64, error) {
+			if receipt.FirebaseUID == "" {
+				return 0, nil
+			}
+			return 1, as.IdentityProvider.DeleteUser(receipt.FirebaseUID)
+		}},
+		{"user", func(receipt *models.DeletionReceipt) (int64, error) {
+			return as.UserController.DeleteUser(receipt.UserID)
+		}},
+	}
+}
+
+// DeleteAccount deletes a user with all their data. Users can delete
+// themselves, admins anyone. The account is suspended first, so nothing is
+// added while the data is deleted. The returned deletion receipt records
+// every completed step; a request failing midway can be repeated to resume it.
+func (as *AccountService) DeleteAccount(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid user id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	requestedBy := utils.FetchUserFromCtx(ctx)
+	if userID != requestedBy && !utils.CanActForAnyUserFromCtx(ctx, guard.WriteAnyUsers) {
+		res := utils.NewHttpResponse(http.StatusForbidden, "Users can only delete their own account")
+		ctx.JSON(http.StatusForbidden, res)
+		return
+	}
+
+	receipt, err := as.fetchDeletionReceipt(userID, requestedBy)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			res := utils.NewHttpResponse(http.StatusNotFound, "User not found")
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating deletion receipt"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if receipt.Status != models.DELETION_COMPLETED {
+		if err := as.suspendForDeletion(receipt); err != nil {
+			res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in suspending user, retry to resume the deletion"))
+			ctx.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		for _, step := range as.deletionSteps() {
+			deleted, err := step.run(receipt)
+			if err != nil {
+				if failErr := as.DeletionReceiptController.FailDeletionStep(receipt.ID, step.name, err); failErr != nil {
+					log.Println("Failed to record deletion error", receipt.ID.Hex(), failErr)
+				}
+				res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrapf(err, "Error in deleting %v, retry to resume the deletion", step.name))
+				ctx.JSON(http.StatusInternalServerError, res)
+				return
+			}
+			if err := as.DeletionReceiptController.CompleteDeletionStep(receipt.ID, step.name, deleted); err != nil {
+				res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in updating deletion receipt, retry to resume the deletion"))
+				ctx.JSON(http.StatusInternalServerError, res)
+				return
+			}
+		}
+
+		if err := as.DeletionReceiptController.CompleteDeletion(receipt.ID); err != nil {
+			res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in completing deletion receipt, retry to resume the deletion"))
+			ctx.JSON(http.StatusInternalServerError, res)
+			return
+		}
+	}
+
+	if receipt, err = as.DeletionReceiptController.GetDeletionReceipt(userID); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting deletion receipt"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, receipt)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// fetchDeletionReceipt returns the receipt of an earlier deletion request of
+// the user, or creates one from the user document.
+func (as *AccountService) fetchDeletionReceipt(userID primitive.ObjectID, requestedBy primitive.ObjectID) (*models.DeletionReceipt, error) {
+	receipt, err := as.DeletionReceiptController.GetDeletionReceipt(userID)
+	if err == nil || !errors.Is(err, mongo.ErrNoDocuments) {
+		return receipt, err
+	}
+
+	user, err := as.UserController.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt = &models.DeletionReceipt{
+		UserID:         userID,
+		RequestedBy:    requestedBy,
+		FirebaseUID:    user.FirebaseUID,
+		ImagePublicIDs: imagePublicIDs(user, nil),
+	}
+
+	receipt, err = as.DeletionReceiptController.CreateDeletionReceipt(receipt)
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		// a concurrent request created the receipt first
+		return as.DeletionReceiptController.GetDeletionReceipt(userID)
+	}
+	return receipt, err
+}
+
+// suspendForDeletion suspends the user of the receipt while their document
+// exists and adds images uploaded since the receipt was created. The images
+// are deleted before the user document, so the receipt's snapshot covers
+// every image once the document is gone.
+func (as *AccountService) suspendForDeletion(receipt *models.DeletionReceipt) error {
+	user, err := as.UserController.GetUserByID(receipt.UserID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+	if err := as.UserController.SetUserSuspended(receipt.UserID, true); err != nil {
+		return err
+	}
+	receipt.ImagePublicIDs = imagePublicIDs(user, receipt.ImagePublicIDs)
+	return nil
+}
+
+// imagePublicIDs appends the public IDs of the user's uploaded images that
+// are not in publicIDs yet.
+func imagePublicIDs(user *models.User, publicIDs []string) []string {
+	known := map[string]bool{}
+	for _, publicID := range publicIDs {
+		known[publicID] = true
+	}
+	for _, image := range user.Images {
+		if image.PublicID != "" && !known[image.PublicID] {
+			known[image.PublicID] = true
+			publicIDs = append(publicIDs, image.PublicID)
+		}
+	}
+	return publicIDs
+}
+
+// ExportAccount streams a zip archive with all data of the logged in user:
+// user.json, ideas.json and a Markdown file per session. Ideas are read from
+// a cursor and written one by one, so large accounts are not held in memory.
+func (as *AccountService) ExportAccount(ctx *gin.Context) {
+	userID := utils.FetchUserFromCtx(ctx)
+
+	user, err := as.UserController.GetUserByID(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting user"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="60s-idea-training-export-%v.zip"`, time.Now().Format("20060102")))
+	ctx.Status(http.StatusOK)
+
+	// the status is sent with the first write, so failures from here on can
+	// only be logged and the archive is left unfinished
+	if err := as.writeExport(zip.NewWriter(ctx.Writer), user); err != nil {
+		log.Println("Failed to export account", userID.Hex(), err)
+		ctx.Abort()
+	}
+}
+
+// writeExport writes the archive entries one after another. Zip entries can
+// not be interleaved, so the ideas are read twice: once for ideas.json and
+// once for the Markdown files.
+func (as *AccountService) writeExport(archive *zip.Writer, user *models.User) error {
+	userFile, err := archive.Create("user.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(userFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(user); err != nil {
+		return err
+	}
+
+	ideasFile, err := archive.Create("ideas.json")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(ideasFile, "["); err != nil {
+		return err
+	}
+	separator := "\n  "
+	err = as.IdeaController.EachIdea(user.ID, func(idea *models.Idea) error {
+		b, err := json.MarshalIndent(idea, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(ideasFile, separator); err != nil {
+			return err
+		}
+		separator = ",\n  "
+		_, err = ideasFile.Write(b)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error in exporting ideas")
+	}
+	if _, err := io.WriteString(ideasFile, "\n]\n"); err != nil {
+		return err
+	}
+
+	err = as.IdeaController.EachIdea(user.ID, func(idea *models.Idea) error {
+		sessionFile, err := archive.Create(fmt.Sprintf("sessions/%v-%v.md", idea.CreatedAt.UTC().Format("2006-01-02"), idea.ID.Hex()))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(sessionFile, ideaMarkdown(idea))
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error in exporting sessions")
+	}
+
+	return archive.Close()
+}
+
+// ideaMarkdown renders a session as a human readable Markdown document.
+func ideaMarkdown(idea *models.Idea) string {
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %v\n\n", idea.TopicTitle)
+	fmt.Fprintf(&md, "- Category: %v\n", idea.Category)
+	if idea.Tags != nil && len(*idea.Tags) > 0 {
+		fmt.Fprintf(&md, "- Tags: %v\n", strings.Join(*idea.Tags, ", "))
+	}
+	if idea.IsLiked != nil && *idea.IsLiked {
+		md.WriteString("- Liked: yes\n")
+	} else {
+		md.WriteString("- Liked: no\n")
+	}
+	fmt.Fprintf(&md, "- Created: %v\n", idea.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&md, "- Updated: %v\n", idea.UpdatedAt.UTC().Format(time.RFC3339))
+
+	md.WriteString("\n## Ideas\n\n")
+	if idea.Ideas != nil {
+		for i, entry := range *idea.Ideas {
+			fmt.Fprintf(&md, "%d. %v\n", i+1, entry.Text)
+		}
+	}
+
+	if idea.Comment != nil && *idea.Comment != "" {
+		fmt.Fprintf(&md, "\n## Comment\n\n%v\n", *idea.Comment)
+	}
+	return md.String()
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (fc *fakeUserController) GetUserByID(id primitive.ObjectID) (*models.User, error) {
+	for _, user := range fc.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+}
+
+func (fc *fakeUserController) SetUserSuspended(id primitive.ObjectID, suspended bool) error {
+	user, err := fc.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	user.Suspended = &suspended
+	return nil
+}
+
+func (fc *fakeUserController) DeleteUser(id primitive.ObjectID) (int64, error) {
+	if fc.deleteErr != nil {
+		return 0, fc.deleteErr
+	}
+	for i, user := range fc.users {
+		if user.ID == id {
+			fc.users = append(fc.users[:i], fc.users[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+type fakeIdeaController struct {
+	controllers.IIdeaController
+	ideas     map[primitive.ObjectID]int64
+	deletes   int
+	records   []*models.Idea
+	createErr error
+	searches  []bson.M
+	pages     []models.Cursor
+}
+
+func (fc *fakeIdeaController) EachIdea(userID primitive.ObjectID, fn func(*models.Idea) error) error {
+	for _, idea := range fc.records {
+		if idea.CreatedBy != userID {
+			continue
+		}
+		if err := fn(idea); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fc *fakeIdeaController) DeleteTombstonesOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+func (fc *fakeIdeaController) DeleteIdeasOfUser(userID primitive.ObjectID) (int64, error) {
+	fc.deletes++
+	deleted := fc.ideas[userID]
+	delete(fc.ideas, userID)
+	return deleted, nil
+}
+
+type fakeSessionController struct {
+	controllers.ISessionController
+	sessions map[primitive.ObjectID]*models.Session
+}
+
+func (fc *fakeSessionController) DeleteSessionsOfUser(userID primitive.ObjectID) (int64, error) {
+	var deleted int64
+	for id, session := range fc.sessions {
+		if session.CreatedBy == userID {
+			delete(fc.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type fakeDailyStatsController struct {
+	controllers.IDailyStatsController
+	streaks    models.Streaks
+	totalIdeas int
+	categories []models.CategoryCounts
+	// evaluated counts the streak lookups
+	evaluated int
+}
+
+func (fc *fakeDailyStatsController) DeleteStatsOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+type fakeBadgeController struct {
+	controllers.IBadgeController
+	badges []*models.Badge
+}
+
+func (fc *fakeBadgeController) DeleteBadgesOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+type fakeAccessTokenController struct {
+	controllers.IAccessTokenController
+}
+
+func (fc *fakeAccessTokenController) DeleteAccessTokensOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+type fakeDeletionReceiptController struct {
+	controllers.IDeletionReceiptController
+	receipts map[primitive.ObjectID]*models.DeletionReceipt
+}
+
+func (fc *fakeDeletionReceiptController) CreateDeletionReceipt(receipt *models.DeletionReceipt) (*models.DeletionReceipt, error) {
+	receipt.ID = primitive.NewObjectID()
+	receipt.Status = models.DELETION_PENDING
+	receipt.Deleted = map[string]int64{}
+	fc.receipts[receipt.UserID] = receipt
+	return receipt, nil
+}
+
+func (fc *fakeDeletionReceiptController) GetDeletionReceipt(userID primitive.ObjectID) (*models.DeletionReceipt, error) {
+	receipt, ok := fc.receipts[userID]
+	if !ok {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	copied := *receipt
+	return &copied, nil
+}
+
+func (fc *fakeDeletionReceiptController) receipt(receiptID primitive.ObjectID) *models.DeletionReceipt {
+	for _, receipt := range fc.receipts {
+		if receipt.ID == receiptID {
+			return receipt
+		}
+	}
+	return nil
+}
+
+// hasCompletedStep reports whether step of receipt already succeeded.
+func hasCompletedStep(receipt *models.DeletionReceipt, step string) bool {
+	for _, completed := range receipt.CompletedSteps {
+		if completed == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (fc *fakeDeletionReceiptController) CompleteDeletionStep(receiptID primitive.ObjectID, step string, deleted int64) error {
+	receipt := fc.receipt(receiptID)
+	if !hasCompletedStep(receipt, step) {
+		receipt.CompletedSteps = append(receipt.CompletedSteps, step)
+	}
+	receipt.Deleted[step] += deleted
+	receipt.LastError = ""
+	return nil
+}
+
+func (fc *fakeDeletionReceiptController) FailDeletionStep(receiptID primitive.ObjectID, step string, cause error) error {
+	fc.receipt(receiptID).LastError = step + ": " + cause.Error()
+	return nil
+}
+
+func (fc *fakeDeletionReceiptController) CompleteDeletion(receiptID primitive.ObjectID) error {
+	fc.receipt(receiptID).Status = models.DELETION_COMPLETED
+	return nil
+}
+
+type fakeImageStore struct {
+	err     error
+	deleted []string
+}
+
+func (fs *fakeImageStore) DeleteImage(publicID string) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	fs.deleted = append(fs.deleted, publicID)
+	return nil
+}
+
+func TestDeleteAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{
+		ID:          primitive.NewObjectID(),
+		FirebaseUID: "uid_1",
+		Email:       "test_email@test.com",
+		Images:      []models.Image{{About: "default"}, {About: "profile", PublicID: "users/image_1"}},
+	}
+	other := &models.User{ID: primitive.NewObjectID(), Email: "other@test.com"}
+
+	userController := &fakeUserController{users: []*models.User{user, other}}
+	ideaController := &fakeIdeaController{ideas: map[primitive.ObjectID]int64{user.ID: 3, other.ID: 2}}
+	receiptController := &fakeDeletionReceiptController{receipts: map[primitive.ObjectID]*models.DeletionReceipt{}}
+	identityProvider := &fakeIdentityProvider{}
+	imageStore := &fakeImageStore{err: errors.New("cloudinary unavailable")}
+	accountService := NewAccountService(userController, ideaController, &fakeSessionController{}, &fakeDailyStatsController{}, &fakeBadgeController{}, &fakeCategoryController{}, &fakeSavedSearchController{}, &fakeAccessTokenController{}, receiptController, identityProvider, imageStore)
+
+	deleteAs := func(requester primitive.ObjectID, role guard.Role, target primitive.ObjectID) (int, models.DeletionReceipt) {
+		router := gin.New()
+		router.DELETE("/users/:id", func(ctx *gin.Context) {
+			ctx.Set("id", requester)
+			ctx.Set("role", role)
+		}, accountService.DeleteAccount)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/"+target.Hex(), nil))
+		var res struct {
+			Data models.DeletionReceipt `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Data
+	}
+
+	// users can not delete other users
+	if code, _ := deleteAs(other.ID, guard.User, user.ID); code != http.StatusForbidden {
+		t.Fatalf("TestDeleteAccount: expected status %v, got %v", http.StatusForbidden, code)
+	}
+
+	// the image step fails midway
+	if code, _ := deleteAs(user.ID, guard.User, user.ID); code != http.StatusInternalServerError {
+		t.Fatalf("TestDeleteAccount: expected status %v, got %v", http.StatusInternalServerError, code)
+	}
+	if receipt := receiptController.receipts[user.ID]; receipt.LastError == "" || hasCompletedStep(receipt, "images") || !hasCompletedStep(receipt, "ideas") {
+		t.Fatalf("TestDeleteAccount: unexpected receipt after failure %v", receipt)
+	}
+	if len(userController.users) != 2 || len(identityProvider.deleted) != 0 {
+		t.Fatalf("TestDeleteAccount: expected user and identity to survive the failure")
+	}
+	if user.Suspended == nil || !*user.Suspended {
+		t.Fatalf("TestDeleteAccount: expected user to be suspended while being deleted")
+	}
+
+	// data created after the failure is deleted when resuming, the identity
+	// step fails before the user document is deleted
+	ideaController.ideas[user.ID] = 1
+	user.Images = append(user.Images, models.Image{About: "cover", PublicID: "users/image_2"})
+	imageStore.err = nil
+	identityProvider.deleteErr = errors.New("firebase unavailable")
+	if code, _ := deleteAs(user.ID, guard.User, user.ID); code != http.StatusInternalServerError {
+		t.Fatalf("TestDeleteAccount: expected status %v, got %v", http.StatusInternalServerError, code)
+	}
+	if receipt := receiptController.receipts[user.ID]; hasCompletedStep(receipt, "firebase") || hasCompletedStep(receipt, "user") {
+		t.Fatalf("TestDeleteAccount: expected the identity and user to survive, got %v", receipt)
+	}
+	if len(userController.users) != 2 {
+		t.Fatalf("TestDeleteAccount: expected the user document to be kept for signing in")
+	}
+	if len(imageStore.deleted) != 2 || imageStore.deleted[0] != "users/image_1" || imageStore.deleted[1] != "users/image_2" {
+		t.Errorf("TestDeleteAccount: expected uploaded images to be deleted, got %v", imageStore.deleted)
+	}
+
+	// the user can still sign in and retries, the user document step fails
+	identityProvider.deleteErr = nil
+	userController.deleteErr = errors.New("mongo unavailable")
+	if code, _ := deleteAs(user.ID, guard.User, user.ID); code != http.StatusInternalServerError {
+		t.Fatalf("TestDeleteAccount: expected status %v, got %v", http.StatusInternalServerError, code)
+	}
+	if receipt := receiptController.receipts[user.ID]; !hasCompletedStep(receipt, "firebase") || hasCompletedStep(receipt, "user") {
+		t.Fatalf("TestDeleteAccount: expected the identity to be deleted before the user, got %v", receipt)
+	}
+
+	// admins resume deletions of users that can not sign in anymore
+	userController.deleteErr = nil
+	code, receipt := deleteAs(other.ID, guard.Admin, user.ID)
+	if code != http.StatusOK || receipt.Status != models.DELETION_COMPLETED {
+		t.Fatalf("TestDeleteAccount: expected completed deletion, got status %v and %v", code, receipt)
+	}
+	if ideaController.deletes != 4 || receipt.Deleted["ideas"] != 4 {
+		t.Errorf("TestDeleteAccount: expected ideas to be deleted on every run, got %v deletes and %v", ideaController.deletes, receipt.Deleted)
+	}
+	// the identity is deleted again on resuming, which firebase allows
+	if len(identityProvider.deleted) != 2 || identityProvider.deleted[0] != "uid_1" || identityProvider.deleted[1] != "uid_1" {
+		t.Errorf("TestDeleteAccount: expected firebase user to be deleted on both runs, got %v", identityProvider.deleted)
+	}
+	if len(userController.users) != 1 || ideaController.ideas[other.ID] != 2 {
+		t.Errorf("TestDeleteAccount: expected only the user's data to be deleted")
+	}
+
+	// a completed deletion is answered with its receipt, admins may run it too
+	if code, receipt := deleteAs(other.ID, guard.Admin, user.ID); code != http.StatusOK || receipt.Status != models.DELETION_COMPLETED {
+		t.Errorf("TestDeleteAccount: expected completed receipt, got status %v and %v", code, receipt)
+	}
+	if ideaController.deletes != 4 {
+		t.Errorf("TestDeleteAccount: expected completed deletion not to run again")
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{ID: primitive.NewObjectID(), Email: "test_email@test.com"}
+	comment := "comment_1"
+	ideas := []models.IdeaEntry{{Text: "idea_1"}, {Text: "idea_2"}}
+	createdAt := time.Date(2022, 12, 24, 10, 0, 0, 0, time.UTC)
+	records := []*models.Idea{
+		{ID: primitive.NewObjectID(), TopicTitle: "topic_1", Category: "category_1", Ideas: &ideas, Comment: &comment, CreatedBy: user.ID, CreatedAt: createdAt},
+		{ID: primitive.NewObjectID(), TopicTitle: "topic_2", CreatedBy: user.ID, CreatedAt: createdAt.AddDate(0, 0, 1)},
+		{ID: primitive.NewObjectID(), TopicTitle: "topic_other", CreatedBy: primitive.NewObjectID(), CreatedAt: createdAt},
+	}
+
+	userController := &fakeUserController{users: []*models.User{user}}
+	ideaController := &fakeIdeaController{records: records}
+	accountService := NewAccountService(userController, ideaController, &fakeSessionController{}, &fakeDailyStatsController{}, &fakeBadgeController{}, &fakeCategoryController{}, &fakeSavedSearchController{}, &fakeAccessTokenController{}, &fakeDeletionReceiptController{}, &fakeIdentityProvider{}, &fakeImageStore{})
+
+	router := gin.New()
+	router.GET("/users/me/export", func(ctx *gin.Context) {
+		ctx.Set("id", user.ID)
+	}, accountService.ExportAccount)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/me/export", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("TestExportAccount: expected zip response, got status %v and %v", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("TestExportAccount: expected valid zip archive, got %v", err)
+	}
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("TestExportAccount: failed to open %v: %v", file.Name, err)
+		}
+		var content bytes.Buffer
+		content.ReadFrom(r)
+		r.Close()
+		files[file.Name] = content.String()
+	}
+
+	var exportedUser models.User
+	if err := json.Unmarshal([]byte(files["user.json"]), &exportedUser); err != nil || exportedUser.Email != user.Email {
+		t.Errorf("TestExportAccount: expected user.json with the user, got %v", files["user.json"])
+	}
+	var exportedIdeas []models.Idea
+	if err := json.Unmarshal([]byte(files["ideas.json"]), &exportedIdeas); err != nil || len(exportedIdeas) != 2 {
+		t.Errorf("TestExportAccount: expected ideas.json with 2 ideas, got %v", files["ideas.json"])
+	}
+
+	session := files["sessions/2022-12-24-"+records[0].ID.Hex()+".md"]
+	for _, want := range []string{"# topic_1", "category_1", "1. idea_1", "2. idea_2", "comment_1"} {
+		if !strings.Contains(session, want) {
+			t.Errorf("TestExportAccount: expected session markdown to contain %q, got %q", want, session)
+		}
+	}
+	if _, ok := files["sessions/2022-12-25-"+records[1].ID.Hex()+".md"]; !ok {
+		t.Errorf("TestExportAccount: expected a markdown file per session, got %v files", len(files))
+	}
+	if len(files) != 4 {
+		t.Errorf("TestExportAccount: expected only the user's data to be exported, got %v files", len(files))
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const MAX_GOALS = 10
+
+// users checked per page by Backfill
+const BADGE_BACKFILL_PAGE_SIZE = 100
+
+type IAchievementService interface {
+	GetGoals(ctx *gin.Context)
+	UpdateGoals(ctx *gin.Context)
+	GetBadges(ctx *gin.Context)
+	AwardBadges(idea *models.Idea, loc *time.Location)
+	Backfill() (int, error)
+}
+
+type AchievementService struct {
+	UserController     controllers.IUserController
+	StatsController    controllers.IIdeaStatsController
+	BadgeController    controllers.IBadgeController
+	CategoryController controllers.ICategoryController
+	now                func() time.Time
+}
+
+// NewAchievementService evaluates goals and badges against statsController.
+// Badges are awarded as ideas are created, register AwardBadges with
+// IDailyStatsService.OnIdeaCreated.
+func NewAchievementService(userController controllers.IUserController, statsController controllers.IIdeaStatsController, badgeController controllers.IBadgeController, categoryController controllers.ICategoryController) IAchievementService {
+	return &AchievementService{
+		UserController:     userController,
+		StatsController:    statsController,
+		BadgeController:    badgeController,
+		CategoryController: categoryController,
+		now:                time.Now,
+	}
+}
+
+// goalProgress sums up the daily counts of the current period of every goal.
+func goalProgress(goals []models.Goal, counts []models.DailyCount, now time.Time, loc *time.Location) []models.GoalProgress {
+	progress := make([]models.GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		from := utils.StartOfDay(now, loc)
+		to := from.AddDate(0, 0, 1)
+		if goal.Period == models.GOAL_WEEK {
+			from = utils.StartOfWeek(now, loc)
+			to = from.AddDate(0, 0, 7)
+		}
+
+		reached := 0
+		for _, count := range counts {
+			if count.Date < from.Format("2006-01-02") || count.Date >= to.Format("2006-01-02") {
+				continue
+			}
+			if goal.Metric == models.GOAL_SESSIONS {
+				reached += count.TotalSessions
+			} else {
+				reached += count.TotalIdeas
+			}
+		}
+		progress = append(progress, models.GoalProgress{
+			Goal:      goal,
+			Progress:  reached,
+			Completed: reached >= goal.Target,
+			From:      from,
+			To:        to,
+		})
+	}
+	return progress
+}
+
+func (as *AchievementService) respondGoals(ctx *gin.Context, userID primitive.ObjectID, goals []models.Goal) {
+	loc := utils.FetchLocationFromCtx(ctx)
+	now := as.now()
+	// the current week contains the current day
+	from := utils.StartOfWeek(now, loc)
+	counts, err := as.StatsController.GetDailyCounts(userID, from, from.AddDate(0, 0, 7), loc)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting goal progress"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, goalProgress(goals, counts, now, loc))
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetGoals returns the goals of the user with the progress of their current
+// day or week.
+func (as *AchievementService) GetGoals(ctx *gin.Context) {
+	userID := utils.FetchUserFromCtx(ctx)
+	user, err := as.UserController.GetUserByID(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusNotFound, errors.Wrap(err, "User not found"))
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+	as.respondGoals(ctx, userID, user.Goals)
+}
+
+// UpdateGoals replaces the goals of the user. Every metric and period pair
+// may be set once.
+func (as *AchievementService) UpdateGoals(ctx *gin.Context) {
+	type RequestBody struct {
+		Goals []models.Goal `json:"goals"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if len(req.Goals) > MAX_GOALS {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("At most %v goals can be set", MAX_GOALS))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	seen := map[string]bool{}
+	for _, goal := range req.Goals {
+		if err := goal.Validate(); err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid goal"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		key := goal.Metric + "/" + goal.Period
+		if seen[key] {
+			res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Goal for %v per %v is set twice", goal.Metric, goal.Period))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		seen[key] = true
+	}
+	if req.Goals == nil {
+		req.Goals = []models.Goal{}
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	if err := as.UserController.UpdateUserGoals(userID, req.Goals); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in updating goals"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	as.respondGoals(ctx, userID, req.Goals)
+}
+
+func (as *AchievementService) GetBadges(ctx *gin.Context) {
+	badges, err := as.BadgeController.GetBadges(utils.FetchUserFromCtx(ctx))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting badges"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, badges)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// totalIdeas reads the idea count of GetTotalIdeasOfAllTime.
+func totalIdeas(results []bson.M) int {
+	if len(results) == 0 {
+		return 0
+	}
+	switch total := results[0]["totalIdeas"].(type) {
+	case int32:
+		return int(total)
+	case int64:
+		return int(total)
+	case float64:
+		return int(total)
+	}
+	return 0
+}
+
+// reachedBadges lists the badges the user qualifies for, given at least one
+// session. BADGE_ALL_CATEGORIES takes an idea in every category of the
+// catalogue of the user, matched regardless of case.
+func reachedBadges(streaks *models.Streaks, ideas int, categories []string, catalogue []*models.Category) []string {
+	reached := []string{models.BADGE_FIRST_SESSION}
+	if streaks.LongestStreak >= 7 {
+		reached = append(reached, models.BADGE_STREAK_7)
+	}
+	if streaks.LongestStreak >= 30 {
+		reached = append(reached, models.BADGE_STREAK_30)
+	}
+	if ideas >= 1000 {
+		reached = append(reached, models.BADGE_IDEAS_1000)
+	}
+
+	used := map[string]bool{}
+	for _, category := range categories {
+		used[strings.ToLower(category)] = true
+	}
+	allUsed := len(catalogue) > 0
+	for _, category := range catalogue {
+		allUsed = allUsed && used[strings.ToLower(category.Name)]
+	}
+	if allUsed {
+		reached = append(reached, models.BADGE_ALL_CATEGORIES)
+	}
+	return reached
+}
+
+// AwardBadges awards the milestones the owner of a newly created idea has
+// reached, with the days cut in loc. Streaks and totals come from the
+// rollups, which already count the idea. Failures are logged and retried
+// with the next idea or by Backfill.
+func (as *AchievementService) AwardBadges(idea *models.Idea, loc *time.Location) {
+	if err := as.awardBadges(idea.CreatedBy, idea.ID, loc); err != nil {
+		log.Printf("Error in awarding badges to user %v: %v\n", idea.CreatedBy.Hex(), err)
+	}
+}
+
+// awardBadges awards the milestones the user has reached and does not hold
+// yet, crediting ideaID, which is nil when not known.
+func (as *AchievementService) awardBadges(userID primitive.ObjectID, ideaID primitive.ObjectID, loc *time.Location) error {
+	badges, err := as.BadgeController.GetBadges(userID)
+	if err != nil {
+		return err
+	}
+	held := map[string]bool{}
+	for _, badge := range badges {
+		held[badge.Kind] = true
+	}
+	if len(held) == len(models.BADGES) {
+		return nil
+	}
+
+	counts, err := as.StatsController.GetCategoryCounts(userID, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	categories := make([]string, 0, len(counts))
+	sessions := 0
+	for _, count := range counts {
+		categories = append(categories, count.Category)
+		sessions += count.Sessions
+	}
+	if sessions == 0 {
+		return nil
+	}
+	streaks, err := as.StatsController.GetStreaks(userID, loc, 0)
+	if err != nil {
+		return err
+	}
+	totals, err := as.StatsController.GetTotalIdeasOfAllTime(userID)
+	if err != nil {
+		return err
+	}
+	catalogue, err := as.CategoryController.GetCategories(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range reachedBadges(streaks, totalIdeas(totals), categories, catalogue) {
+		if held[kind] {
+			continue
+		}
+		if _, err := as.BadgeController.AwardBadge(&models.Badge{Kind: kind, CreatedBy: userID, IdeaID: ideaID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backfill awards every user the milestones they reached but do not hold,
+// such as ones an award failing after the last session missed, and returns
+// how many users were checked.
+func (as *AchievementService) Backfill() (int, error) {
+	checked := 0
+	afterID := primitive.NilObjectID
+	for {
+		users, err := as.UserController.ListUsersAfter(afterID, BADGE_BACKFILL_PAGE_SIZE)
+		if err != nil {
+			return checked, err
+		}
+		for _, user := range users {
+			if err := as.awardBadges(user.ID, primitive.NilObjectID, utils.LoadLocation(user.Timezone)); err != nil {
+				return checked, errors.Wrapf(err, "Error in awarding badges to user %v", user.ID.Hex())
+			}
+			checked++
+		}
+		if len(users) < BADGE_BACKFILL_PAGE_SIZE {
+			return checked, nil
+		}
+		afterID = users[len(users)-1].ID
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGoalProgress(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2023, 3, 15, 10, 0, 0, 0, time.UTC)
+	goals := []models.Goal{
+		{Metric: models.GOAL_SESSIONS, Period: models.GOAL_WEEK, Target: 5},
+		{Metric: models.GOAL_IDEAS, Period: models.GOAL_DAY, Target: 4},
+	}
+	counts := []models.DailyCount{
+		{Date: "2023-03-13", TotalSessions: 2, TotalIdeas: 8},
+		{Date: "2023-03-15", TotalSessions: 3, TotalIdeas: 3},
+	}
+
+	progress := goalProgress(goals, counts, now, time.UTC)
+	want := []models.GoalProgress{
+		{Goal: goals[0], Progress: 5, Completed: true, From: time.Date(2023, 3, 13, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{Goal: goals[1], Progress: 3, Completed: false, From: time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("TestGoalProgress: expected %+v, got %+v", want, progress)
+	}
+}
+
+func TestReachedBadges(t *testing.T) {
+	catalogue := []*models.Category{}
+	for _, name := range append([]string{"Custom"}, models.DEFAULT_CATEGORIES...) {
+		catalogue = append(catalogue, &models.Category{Name: name})
+	}
+
+	cases := []struct {
+		name       string
+		streak     int
+		ideas      int
+		categories []string
+		catalogue  []*models.Category
+		want       []string
+	}{
+		{"first session", 1, 4, []string{"Other"}, catalogue, []string{models.BADGE_FIRST_SESSION}},
+		{"week streak", 7, 40, nil, catalogue, []string{models.BADGE_FIRST_SESSION, models.BADGE_STREAK_7}},
+		{"month streak and ideas", 31, 1000, nil, catalogue, []string{models.BADGE_FIRST_SESSION, models.BADGE_STREAK_7, models.BADGE_STREAK_30, models.BADGE_IDEAS_1000}},
+		{"all categories", 1, 30, append([]string{"custom"}, models.DEFAULT_CATEGORIES...), catalogue, []string{models.BADGE_FIRST_SESSION, models.BADGE_ALL_CATEGORIES}},
+		{"custom category unused", 1, 30, models.DEFAULT_CATEGORIES, catalogue, []string{models.BADGE_FIRST_SESSION}},
+		{"defaults removed from the catalogue", 1, 30, []string{"Custom", "Other"}, []*models.Category{{Name: "Custom"}, {Name: "Other"}}, []string{models.BADGE_FIRST_SESSION, models.BADGE_ALL_CATEGORIES}},
+		{"no catalogue", 1, 30, []string{"Other"}, nil, []string{models.BADGE_FIRST_SESSION}},
+	}
+
+	for _, c := range cases {
+		got := reachedBadges(&models.Streaks{LongestStreak: c.streak}, c.ideas, c.categories, c.catalogue)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TestReachedBadges %v: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func (fc *fakeDailyStatsController) GetStreaks(userID primitive.ObjectID, loc *time.Location, freezes int) (*models.Streaks, error) {
+	fc.evaluated++
+	streaks := fc.streaks
+	return &streaks, nil
+}
+
+func (fc *fakeDailyStatsController) GetTotalIdeasOfAllTime(userID primitive.ObjectID) ([]bson.M, error) {
+	return []bson.M{{"totalIdeas": int32(fc.totalIdeas)}}, nil
+}
+
+func (fc *fakeDailyStatsController) GetCategoryCounts(userID primitive.ObjectID, from time.Time, to time.Time) ([]models.CategoryCounts, error) {
+	return fc.categories, nil
+}
+
+func (fc *fakeBadgeController) GetBadges(userID primitive.ObjectID) ([]*models.Badge, error) {
+	return fc.badges, nil
+}
+
+func (fc *fakeBadgeController) AwardBadge(badge *models.Badge) (bool, error) {
+	fc.badges = append(fc.badges, badge)
+	return true, nil
+}
+
+func TestAwardBadgesOnCreatedIdea(t *testing.T) {
+	userID := primitive.NewObjectID()
+	stats := &fakeDailyStatsController{
+		streaks:    models.Streaks{LongestStreak: 7},
+		totalIdeas: 12,
+		categories: []models.CategoryCounts{{Category: "Other", Sessions: 3}},
+	}
+	badges := &fakeBadgeController{}
+	dailyStats := NewDailyStatsService(&fakeUserController{}, &fakeIdeaController{})
+	dailyStats.OnIdeaCreated(NewAchievementService(&fakeUserController{}, stats, badges, &fakeCategoryController{}).AwardBadges)
+
+	// badges are evaluated from the rollups, which count the idea on creation
+	idea := &models.Idea{ID: primitive.NewObjectID(), CreatedBy: userID, Category: "Other", CreatedAt: time.Now()}
+	dailyStats.IdeaCreated(idea, time.UTC)
+	if stats.evaluated != 1 {
+		t.Fatalf("TestAwardBadgesOnCreatedIdea: expected the idea to be evaluated once, got %v", stats.evaluated)
+	}
+	kinds := []string{}
+	for _, badge := range badges.badges {
+		kinds = append(kinds, badge.Kind)
+		if badge.IdeaID != idea.ID {
+			t.Errorf("TestAwardBadgesOnCreatedIdea: expected badge %v to credit the idea, got %v", badge.Kind, badge.IdeaID)
+		}
+	}
+	if want := []string{models.BADGE_FIRST_SESSION, models.BADGE_STREAK_7}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("TestAwardBadgesOnCreatedIdea: expected badges %v, got %v", want, kinds)
+	}
+}
+
+func TestBackfillBadges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{ID: primitive.NewObjectID()}
+	ideaID := primitive.NewObjectID()
+	stats := &fakeDailyStatsController{
+		streaks:    models.Streaks{LongestStreak: 7},
+		totalIdeas: 40,
+		categories: []models.CategoryCounts{{Category: "Other", Sessions: 7}},
+	}
+	// the award of the seventh day failed
+	badges := &fakeBadgeController{badges: []*models.Badge{{Kind: models.BADGE_FIRST_SESSION, CreatedBy: user.ID, IdeaID: ideaID}}}
+	service := NewAchievementService(&fakeUserController{users: []*models.User{user}}, stats, badges, &fakeCategoryController{})
+
+	// listing the badges does not award any
+	router := gin.New()
+	router.GET("/users/me/badges", func(ctx *gin.Context) {
+		ctx.Set("id", user.ID)
+	}, service.GetBadges)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/me/badges", nil))
+	var res struct {
+		Data []models.Badge `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK || len(res.Data) != 1 {
+		t.Fatalf("TestBackfillBadges: expected the held badge only, got status %v and %v", w.Code, w.Body.String())
+	}
+
+	checked, err := service.Backfill()
+	if err != nil || checked != 1 {
+		t.Fatalf("TestBackfillBadges: expected 1 user to be checked, got %v and %v", checked, err)
+	}
+	kinds := []string{}
+	for _, badge := range badges.badges {
+		kinds = append(kinds, badge.Kind)
+	}
+	if want := []string{models.BADGE_FIRST_SESSION, models.BADGE_STREAK_7}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("TestBackfillBadges: expected badges %v, got %v", want, kinds)
+	}
+
+	// users without sessions have nothing to catch up
+	empty := &fakeBadgeController{}
+	service = NewAchievementService(&fakeUserController{users: []*models.User{user}}, &fakeDailyStatsController{}, empty, &fakeCategoryController{})
+	if _, err := service.Backfill(); err != nil || len(empty.badges) != 0 {
+		t.Errorf("TestBackfillBadges: expected no badges without sessions, got %v and %v", empty.badges, err)
+	}
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	paginate "github.com/gobeam/mongo-go-pagination"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type IAdminService interface {
+	ListUsers(ctx *gin.Context)
+	GetUserSummary(ctx *gin.Context)
+	UpdateUserRole(ctx *gin.Context)
+	SuspendUser(ctx *gin.Context)
+	UnsuspendUser(ctx *gin.Context)
+}
+
+type AdminService struct {
+	UserController controllers.IUserController
+	IdeaController controllers.IIdeaController
+}
+
+func NewAdminService(userController controllers.IUserController, ideaController controllers.IIdeaController) IAdminService {
+	return &AdminService{
+		UserController: userController,
+		IdeaController: ideaController,
+	}
+}
+
+func (as *AdminService) ListUsers(ctx *gin.Context) {
+	type RequestQuery struct {
+		Email       string    `form:"email"`
+		Role        string    `form:"role"`
+		CreatedFrom time.Time `form:"createdFrom" time_format:"2006-01-02"`
+		CreatedTo   time.Time `form:"createdTo" time_format:"2006-01-02"`
+		Pagesize    *int      `form:"pageSize"`
+		Current     *int      `form:"current"`
+	}
+
+	var req RequestQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request query is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	filter := bson.M{}
+	if req.Email != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(req.Email), "$options": "i"}
+	}
+
+	if req.Role != "" {
+		role := guard.Role(req.Role)
+		if !role.IsValid() {
+			res := utils.NewHttpResponse(http.StatusBadRequest, "Invalid role")
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		if role == guard.User {
+			// users stored before roles existed have no role
+			filter["role"] = bson.M{"$in": []interface{}{role, nil}}
+		} else {
+			filter["role"] = role
+		}
+	}
+
+	// filtering createdAt duration, createdTo is inclusive
+	createdAt := bson.M{}
+	if !req.CreatedFrom.IsZero() {
+		createdAt["$gte"] = req.CreatedFrom
+	}
+	if !req.CreatedTo.IsZero() {
+		createdAt["$lt"] = req.CreatedTo.AddDate(0, 0, 1)
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	// page and size
+	current, pageSize := 1, 20
+	if req.Current != nil {
+		current = *req.Current
+	}
+	if req.Pagesize != nil {
+		pageSize = *req.Pagesize
+	}
+	if current < 1 {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Current must be at least 1")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if pageSize < 1 || pageSize > models.MAX_PAGE_LIMIT {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("PageSize must be between 1 and %v", models.MAX_PAGE_LIMIT))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	users, paginateData, err := as.UserController.ListUsers(filter, current, pageSize)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in listing users"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type ResponseBody struct {
+		Users        []models.User           `json:"users"`
+		PaginateData *paginate.PaginatedData `json:"paginateData"`
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, &ResponseBody{Users: users, PaginateData: paginateData})
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (as *AdminService) GetUserSummary(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid user id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	user, err := as.UserController.GetUserByID(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusNotFound, errors.Wrap(err, "User not found"))
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	totals, err := as.IdeaController.GetTotalIdeasOfAllTime(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting ideas of all time"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type ResponseBody struct {
+		User                *models.User  `json:"user"`
+		TotalIdeasOfAllTime []primitive.M `json:"totalIdeasOfAllTime"`
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, &ResponseBody{User: user, TotalIdeasOfAllTime: totals})
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (as *AdminService) UpdateUserRole(ctx *gin.Context) {
+	type RequestBody struct {
+		Role guard.Role `json:"role"`
+	}
+
+	userID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid user id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if !req.Role.IsValid() {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Invalid role")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	// an admin can not lock themselves out of the admin api
+	if userID == utils.FetchUserFromCtx(ctx) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Admins can not change their own role")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if err := as.UserController.UpdateUserRole(userID, req.Role); err != nil {
+		res := utils.NewHttpResponse(http.StatusNotFound, errors.Wrap(err, "Error in updating user role"))
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	as.respondUser(ctx, userID)
+}
+
+func (as *AdminService) SuspendUser(ctx *gin.Context) {
+	as.setSuspended(ctx, true)
+}
+
+func (as *AdminService) UnsuspendUser(ctx *gin.Context) {
+	as.setSuspended(ctx, false)
+}
+
+func (as *AdminService) setSuspended(ctx *gin.Context, suspended bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid user id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if userID == utils.FetchUserFromCtx(ctx) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Admins can not suspend themselves")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if err := as.UserController.SetUserSuspended(userID, suspended); err != nil {
+		res := utils.NewHttpResponse(http.StatusNotFound, errors.Wrap(err, "Error in updating user suspension"))
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	as.respondUser(ctx, userID)
+}
+
+func (as *AdminService) respondUser(ctx *gin.Context, userID primitive.ObjectID) {
+	user, err := as.UserController.GetUserByID(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting updated user from mongodb"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, user)
+	ctx.JSON(http.StatusOK, res)
+}
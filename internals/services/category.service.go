@@ -0,0 +1,277 @@
+package services
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrUnknownCategory is returned by ResolveCategory for names that are not
+// in the catalogue of the user.
+var ErrUnknownCategory = errors.New("category is not in the catalogue")
+
+type ICategoryService interface {
+	GetCategories(ctx *gin.Context)
+	CreateCategory(ctx *gin.Context)
+	UpdateCategory(ctx *gin.Context)
+	DeleteCategory(ctx *gin.Context)
+	ResolveCategory(userID primitive.ObjectID, name string) (string, error)
+}
+
+type CategoryService struct {
+	CategoryController controllers.ICategoryController
+	IdeaController     controllers.IIdeaController
+}
+
+// NewCategoryService rebuilds the daily rollups through dailyStats after
+// ideas moved to another category.
+func NewCategoryService(categoryController controllers.ICategoryController, ideaController controllers.IIdeaController) ICategoryService {
+	return &CategoryService{
+		CategoryController: categoryController,
+		IdeaController:     ideaController,
+	}
+}
+
+// CategoryChange is the answer to a rename or deletion, with the number of
+// ideas moved to another category.
+type CategoryChange struct {
+	Category   *models.Category `json:"category"`
+	MovedIdeas int64            `json:"movedIdeas"`
+}
+
+// findCategory looks name up in categories regardless of case.
+func findCategory(categories []*models.Category, name string) *models.Category {
+	name = strings.TrimSpace(name)
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, name) {
+			return category
+		}
+	}
+	return nil
+}
+
+// catalogue returns the categories of the user. The catalogue of a user
+// without one is seeded with the default categories and every category the
+// ideas of the user already use.
+func (cs *CategoryService) catalogue(userID primitive.ObjectID) ([]*models.Category, error) {
+	categories, err := cs.CategoryController.GetCategories(userID)
+	if err != nil || len(categories) > 0 {
+		return categories, err
+	}
+
+	used, err := cs.IdeaController.GetCategories(userID)
+	if err != nil {
+		return nil, err
+	}
+	names := append([]string{}, models.DEFAULT_CATEGORIES...)
+	for _, name := range used {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := cs.CategoryController.SeedCategories(userID, names); err != nil {
+		return nil, err
+	}
+	return cs.CategoryController.GetCategories(userID)
+}
+
+// ResolveCategory returns the catalogue spelling of name, which is matched
+// regardless of case. An empty name resolves to the default category.
+func (cs *CategoryService) ResolveCategory(userID primitive.ObjectID, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return models.DEFAULT_CATEGORY, nil
+	}
+	categories, err := cs.catalogue(userID)
+	if err != nil {
+		return "", errors.Wrap(err, "Error in getting categories")
+	}
+	category := findCategory(categories, name)
+	if category == nil {
+		return "", errors.Wrapf(ErrUnknownCategory, "%q", strings.TrimSpace(name))
+	}
+	return category.Name, nil
+}
+
+// respondCategoryError answers 404 for unknown categories and 409 for names
+// the user already has.
+func respondCategoryError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		res := utils.NewHttpResponse(http.StatusNotFound, "Category not found")
+		ctx.JSON(http.StatusNotFound, res)
+	case mongo.IsDuplicateKeyError(err):
+		res := utils.NewHttpResponse(http.StatusConflict, "Category already exists")
+		ctx.JSON(http.StatusConflict, res)
+	default:
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, message))
+		ctx.JSON(http.StatusBadRequest, res)
+	}
+}
+
+func (cs *CategoryService) GetCategories(ctx *gin.Context) {
+	categories, err := cs.catalogue(utils.FetchUserFromCtx(ctx))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting categories"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, categories)
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (cs *CategoryService) CreateCategory(ctx *gin.Context) {
+	type RequestBody struct {
+		Name  string `json:"name"`
+		Color string `json:"color,omitempty"`
+		Icon  string `json:"icon,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	userID := utils.FetchUserFromCtx(ctx)
+	category := &models.Category{Name: req.Name, Color: req.Color, Icon: req.Icon, CreatedBy: userID}
+	category.Normalize()
+	if err := category.Validate(); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	// seeds the catalogue, so a new category never shadows a default one
+	categories, err := cs.catalogue(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting categories"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if len(categories) >= models.MAX_CATEGORIES {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("At most %v categories can be created", models.MAX_CATEGORIES))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	newCategory, err := cs.CategoryController.CreateCategory(category)
+	if err != nil {
+		respondCategoryError(ctx, err, "Error in creating category")
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusCreated, newCategory)
+	ctx.JSON(http.StatusCreated, res)
+}
+
+// UpdateCategory changes the name, colour or icon of a category. Renaming
+// moves all ideas of the category to the new name.
+func (cs *CategoryService) UpdateCategory(ctx *gin.Context) {
+	categoryID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type RequestBody struct {
+		Name  *string `json:"name,omitempty"`
+		Color *string `json:"color,omitempty"`
+		Icon  *string `json:"icon,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	category, err := cs.CategoryController.GetCategory(categoryID, userID)
+	if err != nil {
+		respondCategoryError(ctx, err, "Error in getting category")
+		return
+	}
+	previousName := category.Name
+	if req.Name != nil {
+		category.Name = *req.Name
+	}
+	if req.Color != nil {
+		category.Color = *req.Color
+	}
+	if req.Icon != nil {
+		category.Icon = *req.Icon
+	}
+	category.Normalize()
+	if err := category.Validate(); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if previousName == models.DEFAULT_CATEGORY && category.Name != previousName {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "The default category can not be renamed")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	moved, err := cs.CategoryController.UpdateCategory(category, previousName)
+	if err != nil {
+		respondCategoryError(ctx, err, "Error in updating category")
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, CategoryChange{Category: category, MovedIdeas: moved})
+	ctx.JSON(http.StatusOK, res)
+}
+
+// DeleteCategory deletes a category and moves its ideas to the category
+// named by the fallback query, the default category if not given.
+func (cs *CategoryService) DeleteCategory(ctx *gin.Context) {
+	categoryID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	category, err := cs.CategoryController.GetCategory(categoryID, userID)
+	if err != nil {
+		respondCategoryError(ctx, err, "Error in getting category")
+		return
+	}
+	if category.Name == models.DEFAULT_CATEGORY {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "The default category can not be deleted")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	fallback, err := cs.ResolveCategory(userID, ctx.DefaultQuery("fallback", models.DEFAULT_CATEGORY))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid fallback category"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if fallback == category.Name {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "The fallback category must differ from the deleted one")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	moved, err := cs.CategoryController.DeleteCategory(category, fallback)
+	if err != nil {
+		respondCategoryError(ctx, err, "Error in deleting category")
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, CategoryChange{Category: category, MovedIdeas: moved})
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"strings"
+	"testing"
+
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeCategoryController struct {
+	controllers.ICategoryController
+	categories []*models.Category
+	seeds      int
+}
+
+func (fc *fakeCategoryController) SeedCategories(userID primitive.ObjectID, names []string) error {
+	fc.seeds++
+	for _, name := range names {
+		if findCategory(fc.categories, name) == nil {
+			fc.categories = append(fc.categories, &models.Category{Name: name, CreatedBy: userID})
+		}
+	}
+	return nil
+}
+
+func (fc *fakeCategoryController) GetCategories(userID primitive.ObjectID) ([]*models.Category, error) {
+	categories := []*models.Category{}
+	for _, category := range fc.categories {
+		if category.CreatedBy == userID {
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
+
+func (fc *fakeCategoryController) DeleteCategoriesOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+func (fc *fakeIdeaController) GetCategories(userID primitive.ObjectID) ([]string, error) {
+	categories := []string{}
+	for _, idea := range fc.records {
+		if idea.CreatedBy == userID {
+			categories = append(categories, idea.Category)
+		}
+	}
+	return categories, nil
+}
+
+type fakeCategoryService struct {
+	ICategoryService
+}
+
+func (fs *fakeCategoryService) ResolveCategory(userID primitive.ObjectID, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return models.DEFAULT_CATEGORY, nil
+	}
+	return strings.TrimSpace(name), nil
+}
+
+func TestResolveCategory(t *testing.T) {
+	userID := primitive.NewObjectID()
+	categoryController := &fakeCategoryController{}
+	ideaController := &fakeIdeaController{records: []*models.Idea{
+		{CreatedBy: userID, Category: "Work"},
+		{CreatedBy: userID, Category: "business"},
+		{CreatedBy: primitive.NewObjectID(), Category: "Foreign"},
+	}}
+	service := NewCategoryService(categoryController, ideaController)
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"", models.DEFAULT_CATEGORY},
+		{"business", "Business"},
+		{" work ", "Work"},
+		{"OTHER", models.DEFAULT_CATEGORY},
+	}
+	for _, c := range cases {
+		if got, err := service.ResolveCategory(userID, c.name); err != nil || got != c.want {
+			t.Errorf("TestResolveCategory: expected %q for %q, got %q and %v", c.want, c.name, got, err)
+		}
+	}
+
+	for _, name := range []string{"Foreign", "Wrok"} {
+		if _, err := service.ResolveCategory(userID, name); !errors.Is(err, ErrUnknownCategory) {
+			t.Errorf("TestResolveCategory: expected %q to be unknown, got %v", name, err)
+		}
+	}
+
+	if categoryController.seeds != 1 || len(categoryController.categories) != len(models.DEFAULT_CATEGORIES)+1 {
+		t.Errorf("TestResolveCategory: expected the catalogue to be seeded once with the used categories, got %v seeds and %v categories", categoryController.seeds, len(categoryController.categories))
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// users rebuilt per page by Backfill
+const DAILY_STATS_BACKFILL_PAGE_SIZE = 100
+
+// IDailyStatsService keeps the daily rollups in step with the idea records.
+// IdeaController counts idea writes in the rollups, in the time zone given
+// by OwnerLocation.
+type IDailyStatsService interface {
+	OwnerLocation(ctx *gin.Context, ownerID primitive.ObjectID) (*time.Location, error)
+	IdeaCreated(idea *models.Idea, loc *time.Location)
+	OnIdeaCreated(hook func(idea *models.Idea, loc *time.Location))
+	Rebuild(userID primitive.ObjectID, loc *time.Location) error
+	Backfill() (int, error)
+}
+
+type DailyStatsService struct {
+	UserController controllers.IUserController
+	IdeaController controllers.IIdeaController
+	createdHooks   []func(idea *models.Idea, loc *time.Location)
+}
+
+func NewDailyStatsService(userController controllers.IUserController, ideaController controllers.IIdeaController) IDailyStatsService {
+	return &DailyStatsService{
+		UserController: userController,
+		IdeaController: ideaController,
+	}
+}
+
+// OwnerLocation returns the time zone the rollups of the owner are cut in.
+// Admins may write ideas of other users, whose time zone is looked up.
+func (ds *DailyStatsService) OwnerLocation(ctx *gin.Context, ownerID primitive.ObjectID) (*time.Location, error) {
+	if ownerID == utils.FetchUserFromCtx(ctx) {
+		return utils.FetchLocationFromCtx(ctx), nil
+	}
+	owner, err := ds.UserController.GetUserByID(ownerID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in getting owner of idea")
+	}
+	return utils.LoadLocation(owner.Timezone), nil
+}
+
+// IdeaCreated hands an idea the request created, and the rollups already
+// count, to the OnIdeaCreated hooks.
+func (ds *DailyStatsService) IdeaCreated(idea *models.Idea, loc *time.Location) {
+	for _, hook := range ds.createdHooks {
+		hook(idea, loc)
+	}
+}
+
+// OnIdeaCreated registers hook to run for every created idea, with the time
+// zone of its owner. Hooks run in order on the creating request and must
+// handle their own errors.
+func (ds *DailyStatsService) OnIdeaCreated(hook func(idea *models.Idea, loc *time.Location)) {
+	ds.createdHooks = append(ds.createdHooks, hook)
+}
+
+// Rebuild replaces the rollups of the user with ones aggregated from the
+// idea records, with the days cut in loc.
+func (ds *DailyStatsService) Rebuild(userID primitive.ObjectID, loc *time.Location) error {
+	return ds.IdeaController.RebuildDailyStats(userID, loc)
+}
+
+// Backfill rebuilds the rollups of every user and returns how many users
+// were rebuilt.
+func (ds *DailyStatsService) Backfill() (int, error) {
+	rebuilt := 0
+	afterID := primitive.NilObjectID
+	for {
+		users, err := ds.UserController.ListUsersAfter(afterID, DAILY_STATS_BACKFILL_PAGE_SIZE)
+		if err != nil {
+			return rebuilt, err
+		}
+		for _, user := range users {
+			if err := ds.Rebuild(user.ID, utils.LoadLocation(user.Timezone)); err != nil {
+				return rebuilt, errors.Wrapf(err, "Error in rebuilding daily stats of user %v", user.ID.Hex())
+			}
+			rebuilt++
+		}
+		if len(users) < DAILY_STATS_BACKFILL_PAGE_SIZE {
+			return rebuilt, nil
+		}
+		afterID = users[len(users)-1].ID
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"idea-training-version-go/internals/models"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (fc *fakeUserController) ListUsersAfter(afterID primitive.ObjectID, limit int) ([]models.User, error) {
+	sorted := append([]*models.User{}, fc.users...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID.Hex() < sorted[j].ID.Hex() })
+	users := []models.User{}
+	for _, user := range sorted {
+		if user.ID.Hex() > afterID.Hex() && len(users) < limit {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+// fakeRebuildController rebuilds rollups by recording the users, and runs
+// onRebuild before every rebuild.
+type fakeRebuildController struct {
+	fakeIdeaController
+	rebuilt   []primitive.ObjectID
+	onRebuild func()
+}
+
+func (fc *fakeRebuildController) RebuildDailyStats(userID primitive.ObjectID, loc *time.Location) error {
+	if fc.onRebuild != nil {
+		fc.onRebuild()
+	}
+	fc.rebuilt = append(fc.rebuilt, userID)
+	return nil
+}
+
+func TestBackfillDailyStats(t *testing.T) {
+	userController := &fakeUserController{}
+	for i := 0; i < 2*DAILY_STATS_BACKFILL_PAGE_SIZE+1; i++ {
+		userController.users = append(userController.users, &models.User{ID: primitive.NewObjectID()})
+	}
+	want := map[primitive.ObjectID]bool{}
+	for _, user := range userController.users {
+		want[user.ID] = true
+	}
+
+	// users rebuilt already are deleted during the run
+	ideaController := &fakeRebuildController{}
+	ideaController.onRebuild = func() {
+		if len(ideaController.rebuilt) == DAILY_STATS_BACKFILL_PAGE_SIZE/2 {
+			userController.users = userController.users[:0]
+			for id := range want {
+				if !containsObjectID(ideaController.rebuilt, id) {
+					userController.users = append(userController.users, &models.User{ID: id})
+				}
+			}
+		}
+	}
+
+	rebuilt, err := NewDailyStatsService(userController, ideaController).Backfill()
+	if err != nil || rebuilt != len(want) {
+		t.Fatalf("TestBackfillDailyStats: expected %v users to be rebuilt, got %v and %v", len(want), rebuilt, err)
+	}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ideaController.rebuilt {
+		if !want[id] || seen[id] {
+			t.Fatalf("TestBackfillDailyStats: expected every user to be rebuilt once, got %v again", id.Hex())
+		}
+		seen[id] = true
+	}
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, known := range ids {
+		if known == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"html"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/query"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	paginate "github.com/gobeam/mongo-go-pagination"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SEARCH_SORT_RELEVANCE = "relevance"
+	SEARCH_SORT_RECENT    = "recent"
+	SEARCH_SORT_OLDEST    = "oldest"
+
+	// runes kept on each side of the first match of a highlight
+	HIGHLIGHT_CONTEXT = 40
+	MAX_HIGHLIGHTS    = 5
+)
+
+// searchTerms splits a text search into the terms to highlight: quoted
+// phrases and single words, leaving out negated words.
+func searchTerms(search string) []string {
+	terms := []string{}
+	for i, part := range strings.Split(search, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if !strings.HasPrefix(word, "-") {
+				terms = append(terms, word)
+			}
+		}
+	}
+	return terms
+}
+
+type textSpan struct {
+	start int
+	end   int
+}
+
+func hasFoldedPrefix(text []rune, prefix []rune) bool {
+	if len(text) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if unicode.ToLower(text[i]) != r {
+			return false
+		}
+	}
+	return true
+}
+
+// findMatches returns the non-overlapping occurrences of the lowercased
+// terms in text, preferring the longest term at every position.
+func findMatches(text []rune, terms [][]rune) []textSpan {
+	matches := []textSpan{}
+	for i := 0; i < len(text); {
+		longest := 0
+		for _, term := range terms {
+			if len(term) > longest && hasFoldedPrefix(text[i:], term) {
+				longest = len(term)
+			}
+		}
+		if longest == 0 {
+			i++
+			continue
+		}
+		matches = append(matches, textSpan{start: i, end: i + longest})
+		i += longest
+	}
+	return matches
+}
+
+// highlightText cuts a snippet around the first match of the terms in text
+// and marks every match within it. It reports false if nothing matched.
+func highlightText(text string, terms [][]rune) (string, bool) {
+	runes := []rune(text)
+	matches := findMatches(runes, terms)
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	start := matches[0].start - HIGHLIGHT_CONTEXT
+	if start < 0 {
+		start = 0
+	}
+	end := matches[0].end + HIGHLIGHT_CONTEXT
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	at := start
+	for _, match := range matches {
+		if match.start >= end {
+			break
+		}
+		// a match is never cut off
+		if match.end > end {
+			end = match.end
+		}
+		snippet.WriteString(html.EscapeString(string(runes[at:match.start])))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(string(runes[match.start:match.end])))
+		snippet.WriteString("</mark>")
+		at = match.end
+	}
+	snippet.WriteString(html.EscapeString(string(runes[at:end])))
+	if end < len(runes) {
+		snippet.WriteString("…")
+	}
+	return snippet.String(), true
+}
+
+// highlightIdea lists snippets of the fields of idea matching the terms,
+// at most MAX_HIGHLIGHTS of them. The fields are the searched ones, see
+// query.TextFilter.
+func highlightIdea(idea *models.Idea, terms []string) []models.Highlight {
+	folded := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		runes := []rune(term)
+		for i, r := range runes {
+			runes[i] = unicode.ToLower(r)
+		}
+		folded = append(folded, runes)
+	}
+	highlights := []models.Highlight{}
+	if len(folded) == 0 {
+		return highlights
+	}
+
+	add := func(field string, text string) {
+		if len(highlights) >= MAX_HIGHLIGHTS {
+			return
+		}
+		if snippet, ok := highlightText(text, folded); ok {
+			highlights = append(highlights, models.Highlight{Field: field, Snippet: snippet})
+		}
+	}
+	add("topicTitle", idea.TopicTitle)
+	if idea.Ideas != nil {
+		for _, entry := range *idea.Ideas {
+			add("ideas", entry.Text)
+		}
+	}
+	if idea.Comment != nil {
+		add("comment", *idea.Comment)
+	}
+	if idea.Tags != nil {
+		for _, tag := range *idea.Tags {
+			add("tags", tag)
+		}
+	}
+	add("category", idea.Category)
+	return highlights
+}
+
+// SearchRequest is the body of SearchIdeas. Saved searches store it too.
+type SearchRequest struct {
+	SearchInput   string    `json:"searchInput,omitempty"`
+	Category      string    `json:"category,omitempty"`
+	CreatedAtFrom time.Time `json:"createdAtFrom,omitempty"`
+	CreatedAtTo   time.Time `json:"createdAtTo,omitempty"`
+	Pagesize      int       `json:"pageSize,omitempty"`
+	Current       int       `json:"current"`
+	Limit         int       `json:"limit,omitempty"`  // pages by cursor, by createdAt, instead of current
+	Cursor        string    `json:"cursor,omitempty"` // next or prev of the last page
+	SortByRecent  bool      `json:"sortByRecent,omitempty"`
+	SortBy        string    `json:"sortBy,omitempty"` // overrides sortByRecent
+	Q             string    `json:"q,omitempty"`      // see package query
+	IsLiked       bool      `json:"isLiked,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`    // all of them
+	AnyTags       []string  `json:"anyTags,omitempty"` // at least one of them
+}
+
+// SearchResults is the answer to a SearchRequest. PaginateData comes with
+// current pages, Page with cursor pages.
+type SearchResults struct {
+	Ideas        []models.IdeaSearchResult `json:"ideas"`
+	SortBy       string                    `json:"sortBy"`
+	PaginateData *paginate.PaginatedData   `json:"paginateData,omitempty"`
+	Page         *models.CursorPage        `json:"page,omitempty"`
+}
+
+// pageCursor decodes the cursor of a listing sorted by field in order, nil
+// for the first page.
+func pageCursor(encoded string, field string, order int) (*models.Cursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	cursor, err := models.DecodeCursor(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.Matches(field, order); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// usesCursor reports whether req pages by cursor.
+func (req *SearchRequest) usesCursor() bool {
+	return req.Limit > 0 || req.Cursor != ""
+}
+
+// Validate checks the sort order and the query of req.
+func (req *SearchRequest) Validate() error {
+	switch req.SortBy {
+	case "", SEARCH_SORT_RELEVANCE, SEARCH_SORT_RECENT, SEARCH_SORT_OLDEST:
+	default:
+		return errors.Errorf("Invalid sortBy %q", req.SortBy)
+	}
+	if req.Limit < 0 || req.Limit > models.MAX_PAGE_LIMIT {
+		return errors.Errorf("Limit must be between 1 and %v", models.MAX_PAGE_LIMIT)
+	}
+	if req.usesCursor() && req.SortBy == SEARCH_SORT_RELEVANCE {
+		return errors.New("Cursor pages are sorted by recent or oldest, not by relevance")
+	}
+	if req.Cursor != "" {
+		if _, err := models.DecodeCursor(req.Cursor); err != nil {
+			return errors.Wrap(err, "Invalid cursor")
+		}
+	}
+	if _, err := query.Parse(req.Q); err != nil {
+		return errors.Wrap(err, "Invalid query")
+	}
+	return nil
+}
+
+// RunSearch searches the ideas of userID, cutting the days of the query in
+// loc. Invalid requests fail with the error of Validate.
+func (is *IdeaService) RunSearch(userID primitive.ObjectID, loc *time.Location, req SearchRequest) (*SearchResults, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	sortBy := req.SortBy
+	if sortBy == "" {
+		sortBy = SEARCH_SORT_OLDEST
+		if req.SortByRecent {
+			sortBy = SEARCH_SORT_RECENT
+		}
+	}
+	parsed, err := query.Parse(req.Q)
+	if err != nil {
+		return nil, err
+	}
+	searchInput := strings.TrimSpace(req.SearchInput)
+	textSearch := strings.TrimSpace(searchInput + " " + parsed.TextSearch())
+	// without a search everything is equally relevant
+	if sortBy == SEARCH_SORT_RELEVANCE && searchInput == "" && len(parsed.Terms) == 0 {
+		sortBy = SEARCH_SORT_RECENT
+	}
+
+	// matchStage
+	filter := bson.M{}
+	filter["createdBy"] = userID
+	// filtering createdAt duration
+	if req.CreatedAtFrom.IsZero() && !req.CreatedAtTo.IsZero() {
+		filter["createdAt"] = bson.M{"$lte": req.CreatedAtTo}
+	}
+
+	if !req.CreatedAtFrom.IsZero() && req.CreatedAtTo.IsZero() {
+		filter["createdAt"] = bson.M{"$gte": req.CreatedAtFrom}
+	}
+
+	if !req.CreatedAtFrom.IsZero() && !req.CreatedAtTo.IsZero() {
+		filter["createdAt"] = bson.M{"$gte": req.CreatedAtFrom, "$lte": req.CreatedAtTo}
+	}
+
+	if req.Category != "" {
+		filter["category"] = req.Category
+	}
+
+	if req.IsLiked {
+		filter["isLiked"] = true
+	}
+
+	tagFilter := bson.M{}
+	if tags := models.NormalizeTags(req.Tags); len(tags) > 0 {
+		tagFilter["$all"] = tags
+	}
+	if anyTags := models.NormalizeTags(req.AnyTags); len(anyTags) > 0 {
+		tagFilter["$in"] = anyTags
+	}
+	if len(tagFilter) > 0 {
+		filter["tags"] = tagFilter
+	}
+
+	// the query narrows the fields down further, its words and phrases all
+	// have to occur literally even when ranking by relevance
+	clauses := []bson.M{}
+	if queryFilter := parsed.Filter(loc); len(queryFilter) > 0 {
+		clauses = append(clauses, queryFilter)
+	}
+	if textFilter := parsed.TextFilter(); len(textFilter) > 0 {
+		clauses = append(clauses, textFilter)
+	}
+	if len(clauses) > 0 {
+		filter["$and"] = clauses
+	}
+
+	// page and size
+	if req.Current == 0 {
+		req.Current = 1
+	}
+	if req.Pagesize == 0 {
+		req.Pagesize = 9
+	}
+
+	var results []models.IdeaSearchResult
+	var paginateData *paginate.PaginatedData
+	var page *models.CursorPage
+	var terms []string
+	if sortBy == SEARCH_SORT_RELEVANCE {
+		terms = searchTerms(textSearch)
+		results, paginateData, err = is.IdeaController.SearchByRelevance(filter, textSearch, req.Current, req.Pagesize)
+		if errors.Is(err, controllers.ErrTextIndexMissing) {
+			log.Println("Searching ideas without ranking:", err)
+			sortBy = SEARCH_SORT_RECENT
+		}
+	}
+	if sortBy != SEARCH_SORT_RELEVANCE {
+		terms = append([]string{searchInput}, parsed.Terms...)
+		if searchInput != "" {
+			filter["$or"] = query.TextFilter(searchInput)
+		}
+		sort := 1
+		if sortBy == SEARCH_SORT_RECENT {
+			sort = -1
+		}
+
+		var ideas []models.Idea
+		if req.usesCursor() {
+			// unlike updatedAt, createdAt stays put when ideas are edited
+			// between pages, so none is repeated or passed over
+			var cursor *models.Cursor
+			if cursor, err = pageCursor(req.Cursor, "createdAt", sort); err != nil {
+				return nil, errors.Wrap(err, "Invalid cursor")
+			}
+			limit := req.Limit
+			if limit == 0 {
+				limit = models.DEFAULT_PAGE_LIMIT
+			}
+			ideas, page, err = is.IdeaController.FindPage(filter, "createdAt", sort, cursor, limit)
+		} else {
+			ideas, paginateData, err = is.IdeaController.Search(filter, sort, req.Current, req.Pagesize)
+		}
+		results = make([]models.IdeaSearchResult, 0, len(ideas))
+		for _, idea := range ideas {
+			results = append(results, models.IdeaSearchResult{Idea: idea})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if textSearch != "" {
+		for i := range results {
+			results[i].Highlights = highlightIdea(&results[i].Idea, terms)
+		}
+	}
+
+	return &SearchResults{
+		Ideas:        results,
+		SortBy:       sortBy,
+		PaginateData: paginateData,
+		Page:         page,
+	}, nil
+}
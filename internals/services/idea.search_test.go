@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	paginate "github.com/gobeam/mongo-go-pagination"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (fc *fakeIdeaController) SearchByRelevance(filter bson.M, search string, page int, limit int) ([]models.IdeaSearchResult, *paginate.PaginatedData, error) {
+	return nil, nil, errors.Wrap(controllers.ErrTextIndexMissing, "text index required for $text query")
+}
+
+func (fc *fakeIdeaController) Search(filter bson.M, sort int, page int, limit int) ([]models.Idea, *paginate.PaginatedData, error) {
+	fc.searches = append(fc.searches, filter)
+	ideas := []models.Idea{}
+	for _, idea := range fc.records {
+		ideas = append(ideas, *idea)
+	}
+	return ideas, &paginate.PaginatedData{Pagination: paginate.PaginationData{Total: int64(len(ideas))}}, nil
+}
+
+func TestSearchTerms(t *testing.T) {
+	cases := []struct {
+		search string
+		want   []string
+	}{
+		{"", []string{}},
+		{" deep  work ", []string{"deep", "work"}},
+		{`morning "deep work" -email`, []string{"morning", "deep work"}},
+	}
+
+	for _, c := range cases {
+		if got := searchTerms(c.search); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TestSearchTerms: expected %q for %q, got %q", c.want, c.search, got)
+		}
+	}
+}
+
+func TestHighlightText(t *testing.T) {
+	terms := [][]rune{[]rune("work"), []rune("deep work")}
+	cases := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"Plan Deep Work & rest", "Plan <mark>Deep Work</mark> &amp; rest", true},
+		{"work, work", "<mark>work</mark>, <mark>work</mark>", true},
+		{strings.Repeat("a", 50) + " work " + strings.Repeat("b", 50), "…" + strings.Repeat("a", 39) + " <mark>work</mark> " + strings.Repeat("b", 39) + "…", true},
+		{"nothing here", "", false},
+	}
+
+	for _, c := range cases {
+		if got, ok := highlightText(c.text, terms); got != c.want || ok != c.ok {
+			t.Errorf("TestHighlightText: expected %q for %q, got %q", c.want, c.text, got)
+		}
+	}
+}
+
+func TestHighlightIdea(t *testing.T) {
+	comment := "no match"
+	idea := &models.Idea{
+		TopicTitle: "Ways to focus",
+		Category:   "Focus",
+		Ideas:      &[]models.IdeaEntry{{Text: "turn off <notifications>"}, {Text: "sleep"}, {Text: "FOCUS blocks"}},
+		Comment:    &comment,
+		Tags:       &[]string{"deep-focus", "morning"},
+	}
+
+	want := []models.Highlight{
+		{Field: "topicTitle", Snippet: "Ways to <mark>focus</mark>"},
+		{Field: "ideas", Snippet: "turn off &lt;<mark>notifications</mark>&gt;"},
+		{Field: "ideas", Snippet: "<mark>FOCUS</mark> blocks"},
+		{Field: "tags", Snippet: "deep-<mark>focus</mark>"},
+		{Field: "category", Snippet: "<mark>Focus</mark>"},
+	}
+	if got := highlightIdea(idea, []string{"focus", "Notifications"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestHighlightIdea: expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSearchIdeasWithoutTextIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	ideaController := &fakeIdeaController{records: []*models.Idea{{CreatedBy: userID, TopicTitle: "a (b"}}}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	router := gin.New()
+	router.POST("/ideas/search", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.SearchIdeas)
+	body, _ := json.Marshal(map[string]interface{}{"searchInput": "a (b", "sortBy": SEARCH_SORT_RELEVANCE})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ideas/search", bytes.NewReader(body)))
+
+	var res struct {
+		Data struct {
+			Ideas  []models.IdeaSearchResult `json:"ideas"`
+			SortBy string                    `json:"sortBy"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Data.SortBy != SEARCH_SORT_RECENT {
+		t.Fatalf("TestSearchIdeasWithoutTextIndex: expected fallback to recent, got status %v and %+v", w.Code, res.Data)
+	}
+	if len(ideaController.searches) != 1 {
+		t.Fatalf("TestSearchIdeasWithoutTextIndex: expected one regex search, got %v", len(ideaController.searches))
+	}
+	pattern := ideaController.searches[0]["$or"].([]bson.M)[0]["topicTitle"].(bson.M)["$regex"]
+	if pattern != `a \(b` {
+		t.Errorf("TestSearchIdeasWithoutTextIndex: expected escaped pattern, got %v", pattern)
+	}
+	if len(res.Data.Ideas) != 1 || len(res.Data.Ideas[0].Highlights) != 1 || res.Data.Ideas[0].Highlights[0].Snippet != "<mark>a (b</mark>" {
+		t.Errorf("TestSearchIdeasWithoutTextIndex: expected highlighted idea, got %+v", res.Data.Ideas)
+	}
+}
+
+func TestSearchIdeasWithQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	ideaController := &fakeIdeaController{}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	router := gin.New()
+	router.POST("/ideas/search", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.SearchIdeas)
+	search := func(body map[string]interface{}) (int, string) {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ideas/search", bytes.NewReader(b)))
+		var res struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Message
+	}
+
+	if code, message := search(map[string]interface{}{"q": `liked:maybe`}); code != http.StatusBadRequest || !strings.Contains(message, "liked must be true or false") {
+		t.Errorf("TestSearchIdeasWithQuery: expected parse error, got status %v and %q", code, message)
+	}
+	if len(ideaController.searches) != 0 {
+		t.Fatalf("TestSearchIdeasWithQuery: expected no search for an invalid query")
+	}
+
+	if code, _ := search(map[string]interface{}{"q": `liked:true plan`, "category": "Work"}); code != http.StatusOK {
+		t.Fatalf("TestSearchIdeasWithQuery: expected status %v, got %v", http.StatusOK, code)
+	}
+	filter := ideaController.searches[0]
+	clauses, _ := filter["$and"].([]bson.M)
+	if filter["category"] != "Work" || filter["createdBy"] != userID || len(clauses) != 2 || clauses[0]["isLiked"] != true {
+		t.Errorf("TestSearchIdeasWithQuery: expected the query on top of the fields, got %v", filter)
+	}
+}
+
+func (fc *fakeIdeaController) FindPage(filter bson.M, field string, order int, cursor *models.Cursor, limit int) ([]models.Idea, *models.CursorPage, error) {
+	fc.searches = append(fc.searches, filter)
+	fc.pages = append(fc.pages, models.Cursor{Field: field, Order: order})
+	return []models.Idea{}, &models.CursorPage{Limit: limit}, nil
+}
+
+func TestSearchIdeasByCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ideaController := &fakeIdeaController{}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	router := gin.New()
+	router.POST("/ideas/search", func(ctx *gin.Context) {
+		ctx.Set("id", primitive.NewObjectID())
+	}, service.SearchIdeas)
+	search := func(body map[string]interface{}) (int, SearchResults) {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ideas/search", bytes.NewReader(b)))
+		var res struct {
+			Data SearchResults `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Data
+	}
+
+	invalid := []map[string]interface{}{
+		{"limit": models.MAX_PAGE_LIMIT + 1},
+		{"limit": 5, "sortBy": SEARCH_SORT_RELEVANCE, "searchInput": "plan"},
+		{"cursor": "not a cursor"},
+		{"cursor": (&models.Cursor{Field: "createdAt", Order: 1}).Encode(), "sortBy": SEARCH_SORT_RECENT},
+		{"cursor": (&models.Cursor{Field: "updatedAt", Order: -1}).Encode(), "sortBy": SEARCH_SORT_RECENT},
+	}
+	for _, body := range invalid {
+		if code, _ := search(body); code != http.StatusBadRequest {
+			t.Errorf("TestSearchIdeasByCursor: expected status %v for %v, got %v", http.StatusBadRequest, body, code)
+		}
+	}
+	if len(ideaController.pages) != 0 {
+		t.Fatalf("TestSearchIdeasByCursor: expected no pages for invalid requests, got %v", ideaController.pages)
+	}
+
+	code, results := search(map[string]interface{}{"limit": 5, "sortBy": SEARCH_SORT_RECENT})
+	if code != http.StatusOK || results.Page == nil || results.Page.Limit != 5 || results.PaginateData != nil {
+		t.Fatalf("TestSearchIdeasByCursor: expected a cursor page, got status %v and %+v", code, results)
+	}
+	if page := ideaController.pages[0]; page.Field != "createdAt" || page.Order != -1 {
+		t.Errorf("TestSearchIdeasByCursor: expected recent ideas by createdAt, got %+v", page)
+	}
+
+	// current pages are still answered as before
+	if code, results := search(map[string]interface{}{"current": 1}); code != http.StatusOK || results.PaginateData == nil || results.Page != nil {
+		t.Errorf("TestSearchIdeasByCursor: expected a current page, got status %v and %+v", code, results)
+	}
+}
@@ -1,17 +1,29 @@
 package services
 
 import (
+	"fmt"
 	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/models"
 	"idea-training-version-go/internals/utils"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	paginate "github.com/gobeam/mongo-go-pagination"
 	errors "github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	MAX_STREAK_FREEZES = 7
+	MAX_HEATMAP_DAYS   = 366
+	MAX_STATS_DAYS     = 366
+	MAX_TOPICS         = 100
+	MAX_TAG_RESULTS    = 100
 )
 
 type IIdeaService interface {
@@ -25,42 +37,347 @@ type IIdeaService interface {
 	GetTotalConsecutiveDays(ctx *gin.Context)
 	GetRecentIdeas(ctx *gin.Context)
 	GetWeeklyIdeas(ctx *gin.Context)
+	GetTimeToFirstIdea(ctx *gin.Context)
+	GetIdeasPerMinute(ctx *gin.Context)
+	GetHeatmap(ctx *gin.Context)
+	GetCategoryStats(ctx *gin.Context)
+	GetTopicStats(ctx *gin.Context)
+	GetTags(ctx *gin.Context)
 	SearchIdeas(ctx *gin.Context)
+	RunSearch(userID primitive.ObjectID, loc *time.Location, req SearchRequest) (*SearchResults, error)
+	GetChanges(ctx *gin.Context)
+	SyncIdeas(ctx *gin.Context)
 }
 
 type IdeaService struct {
-	IdeaController controllers.IIdeaController
+	IdeaController  controllers.IIdeaController
+	StatsController controllers.IIdeaStatsController
+	DailyStats      IDailyStatsService
+	Categories      ICategoryService
 }
 
-func NewIdeaService(ideaController controllers.IIdeaController) IIdeaService {
+// NewIdeaService answers the statistics from statsController, normally the
+// daily rollups maintained through dailyStats. Categories of written ideas
+// are checked against the catalogue of categories.
+func NewIdeaService(ideaController controllers.IIdeaController, statsController controllers.IIdeaStatsController, dailyStats IDailyStatsService, categories ICategoryService) IIdeaService {
 	return &IdeaService{
-		IdeaController: ideaController,
+		IdeaController:  ideaController,
+		StatsController: statsController,
+		DailyStats:      dailyStats,
+		Categories:      categories,
+	}
+}
+
+// ideaOwnerScope returns the scope every single-idea operation runs in.
+// Roles granted the "any" permission reach the ideas of every user, unless
+// the request is made with a personal access token.
+func ideaOwnerScope(ctx *gin.Context, anyPermission guard.Permission) controllers.IdeaScope {
+	if utils.CanActForAnyUserFromCtx(ctx, anyPermission) {
+		return controllers.AnyIdeaOwner()
+	}
+	return controllers.OwnedBy(utils.FetchUserFromCtx(ctx))
+}
+
+// respondIdeaError answers 404 for ideas that do not exist or belong to
+// another user, so foreign ids cannot be told apart from unknown ones.
+func respondIdeaError(ctx *gin.Context, err error, message string) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		res := utils.NewHttpResponse(http.StatusNotFound, "Idea not found")
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, message))
+	ctx.JSON(http.StatusBadRequest, res)
+}
+
+// clearSessionFields drops the fields only a finished session may set.
+func clearSessionFields(idea *models.Idea) {
+	idea.SessionID = primitive.NilObjectID
+	idea.Duration = nil
+	idea.LateIdeas = nil
+	if idea.Ideas != nil {
+		for i := range *idea.Ideas {
+			(*idea.Ideas)[i].Offset = nil
+			(*idea.Ideas)[i].Edited = false
+		}
+	}
+}
+
+// normalizeIdeaTags normalizes the tags of idea, if given, and checks them
+// against the limits.
+func normalizeIdeaTags(idea *models.Idea) error {
+	if idea.Tags == nil {
+		return nil
+	}
+	tags := models.NormalizeTags(*idea.Tags)
+	if err := models.ValidateTags(tags); err != nil {
+		return err
+	}
+	idea.Tags = &tags
+	return nil
+}
+
+// mergeIdeaEntries carries the recorded offsets over to the updated entries
+// and flags the edited ones. Entries are matched by text, in order first
+// and then out of order for moved entries, so removing or reordering some
+// entries keeps the offsets of the others. The remaining entries between
+// two in order matches were edited, see pairEditedEntries. Entries left
+// over were added after the session, have no offset and count as edited.
+func mergeIdeaEntries(recorded []models.IdeaEntry, updated []models.IdeaEntry) {
+	anchors := alignIdeaEntries(recorded, updated)
+	matches := make([]int, len(updated))
+	copy(matches, anchors)
+	used := make([]bool, len(recorded))
+	for _, r := range matches {
+		if r >= 0 {
+			used[r] = true
+		}
+	}
+
+	// moved entries
+	for i := range updated {
+		if matches[i] >= 0 {
+			continue
+		}
+		for r := range recorded {
+			if !used[r] && recorded[r].Text == updated[i].Text {
+				matches[i], used[r] = r, true
+				break
+			}
+		}
+	}
+
+	// edited entries, between the same in order matches
+	start, from := 0, 0
+	for i := 0; i <= len(updated); i++ {
+		if i < len(updated) && anchors[i] < 0 {
+			continue
+		}
+		to := len(recorded)
+		if i < len(updated) {
+			to = anchors[i]
+		}
+		pairEditedEntries(recorded, updated, matches, used, start, i, from, to)
+		start, from = i+1, to+1
+	}
+
+	for i := range updated {
+		r := matches[i]
+		if r < 0 {
+			updated[i].Offset = nil
+			updated[i].Edited = true
+			continue
+		}
+		updated[i].Offset = recorded[r].Offset
+		updated[i].Edited = recorded[r].Edited || recorded[r].Text != updated[i].Text
+	}
+}
+
+// pairEditedEntries matches the unmatched updated entries in [start, end)
+// with the unused recorded ones in [from, to). As many of both were edited
+// in place and pair in order; otherwise every entry pairs with the one
+// sharing the longest prefix, as some were also removed or added.
+func pairEditedEntries(recorded []models.IdeaEntry, updated []models.IdeaEntry, matches []int, used []bool, start, end, from, to int) {
+	var edited, candidates []int
+	for u := start; u < end; u++ {
+		if matches[u] < 0 {
+			edited = append(edited, u)
+		}
+	}
+	for r := from; r < to; r++ {
+		if !used[r] {
+			candidates = append(candidates, r)
+		}
+	}
+
+	if len(edited) == len(candidates) {
+		for k, u := range edited {
+			matches[u], used[candidates[k]] = candidates[k], true
+		}
+		return
+	}
+	for _, u := range edited {
+		best, bestLength := -1, 0
+		for _, r := range candidates {
+			if length := commonPrefixLength(recorded[r].Text, updated[u].Text); !used[r] && length > bestLength {
+				best, bestLength = r, length
+			}
+		}
+		if best >= 0 {
+			matches[u], used[best] = best, true
+		}
+	}
+}
+
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// alignIdeaEntries returns the recorded entry matching each updated entry in
+// a longest common subsequence of their texts, -1 if it has none.
+func alignIdeaEntries(recorded []models.IdeaEntry, updated []models.IdeaEntry) []int {
+	// common[r][u] is the length of the longest common subsequence of
+	// recorded[r:] and updated[u:]
+	common := make([][]int, len(recorded)+1)
+	for r := range common {
+		common[r] = make([]int, len(updated)+1)
+	}
+	for r := len(recorded) - 1; r >= 0; r-- {
+		for u := len(updated) - 1; u >= 0; u-- {
+			if recorded[r].Text == updated[u].Text {
+				common[r][u] = common[r+1][u+1] + 1
+			} else if common[r+1][u] >= common[r][u+1] {
+				common[r][u] = common[r+1][u]
+			} else {
+				common[r][u] = common[r][u+1]
+			}
+		}
+	}
+
+	matches := make([]int, len(updated))
+	for u := range matches {
+		matches[u] = -1
+	}
+	for r, u := 0, 0; r < len(recorded) && u < len(updated); {
+		switch {
+		case recorded[r].Text == updated[u].Text:
+			matches[u] = r
+			r++
+			u++
+		case common[r+1][u] >= common[r][u+1]:
+			r++
+		default:
+			u++
+		}
+	}
+	return matches
+}
+
+// prepareNewIdea checks and completes idea before userID creates it.
+func (is *IdeaService) prepareNewIdea(userID primitive.ObjectID, idea *models.Idea) error {
+	idea.CreatedBy = userID
+	idea.CreatedAt = time.Time{}
+	// session timing is only recorded by the server, see SessionService
+	clearSessionFields(idea)
+	if err := normalizeIdeaTags(idea); err != nil {
+		return errors.Wrap(err, "Invalid tags")
+	}
+	category, err := is.Categories.ResolveCategory(userID, idea.Category)
+	if err != nil {
+		return errors.Wrap(err, "Invalid category")
+	}
+	idea.Category = category
+	return nil
+}
+
+// prepareIdeaUpdate checks and completes idea before it updates recorded.
+func (is *IdeaService) prepareIdeaUpdate(idea *models.Idea, recorded *models.Idea) error {
+	idea.ID = recorded.ID
+	// ownership can not be changed through the request body, nor the day
+	// the idea is counted on
+	idea.CreatedBy = primitive.NilObjectID
+	idea.CreatedAt = time.Time{}
+	clearSessionFields(idea)
+	if err := normalizeIdeaTags(idea); err != nil {
+		return errors.Wrap(err, "Invalid tags")
+	}
+	// an empty category is left unchanged
+	if idea.Category != "" {
+		category, err := is.Categories.ResolveCategory(recorded.CreatedBy, idea.Category)
+		if err != nil {
+			return errors.Wrap(err, "Invalid category")
+		}
+		idea.Category = category
+	}
+	if idea.Ideas != nil {
+		var entries []models.IdeaEntry
+		if recorded.Ideas != nil {
+			entries = *recorded.Ideas
+		}
+		mergeIdeaEntries(entries, *idea.Ideas)
 	}
+	return nil
 }
 
 func (is *IdeaService) CreateIdea(ctx *gin.Context) {
 	userID := utils.FetchUserFromCtx(ctx)
 	var idea models.Idea
-	var newIdea *models.Idea
 	if err := ctx.ShouldBindJSON(&idea); err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
-	idea.CreatedBy = userID
-	newIdea, err := is.IdeaController.CreateIdea(&idea)
+	if err := is.prepareNewIdea(userID, &idea); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	loc, err := is.DailyStats.OwnerLocation(ctx, userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	newIdea, err := is.IdeaController.CreateIdea(&idea, loc)
 	if err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating idea"))
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
+	is.DailyStats.IdeaCreated(newIdea, loc)
 	res := utils.NewHttpResponse(http.StatusCreated, newIdea)
 	ctx.JSON(http.StatusCreated, res)
 }
 
+// GetAllIdeas lists all ideas of the user. Given a limit or a cursor query
+// it answers a page of them instead, oldest first or newest first with
+// sortBy=recent, with the cursors of the pages around it.
 func (is *IdeaService) GetAllIdeas(ctx *gin.Context) {
 	userID := utils.FetchUserFromCtx(ctx)
 
+	if ctx.Query("limit") != "" || ctx.Query("cursor") != "" {
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(models.DEFAULT_PAGE_LIMIT)))
+		if err != nil || limit < 1 || limit > models.MAX_PAGE_LIMIT {
+			res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %v", models.MAX_PAGE_LIMIT))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		order := 1
+		switch ctx.Query("sortBy") {
+		case "", SEARCH_SORT_OLDEST:
+		case SEARCH_SORT_RECENT:
+			order = -1
+		default:
+			res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Invalid sortBy %q", ctx.Query("sortBy")))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		cursor, err := pageCursor(ctx.Query("cursor"), "createdAt", order)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid cursor"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+
+		type ResponseBody struct {
+			Ideas []models.Idea      `json:"ideas"`
+			Page  *models.CursorPage `json:"page"`
+		}
+		ideas, page, err := is.IdeaController.FindPage(bson.M{"createdBy": userID}, "createdAt", order, cursor, limit)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting ideas"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		res := utils.NewHttpResponse(http.StatusOK, ResponseBody{Ideas: ideas, Page: page})
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+
 	ideas, err := is.IdeaController.GetAllIdeas(userID)
 
 	if err != nil {
@@ -80,10 +397,9 @@ func (is *IdeaService) GetIdeaByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
-	idea, err := is.IdeaController.GetIdeaByID(ideaID)
+	idea, err := is.IdeaController.GetIdeaByID(ideaID, ideaOwnerScope(ctx, guard.ReadAnyIdeas))
 	if err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting idea"))
-		ctx.JSON(http.StatusBadRequest, res)
+		respondIdeaError(ctx, err, "Error in getting idea")
 		return
 	}
 
@@ -106,21 +422,36 @@ func (is *IdeaService) UpdateIdea(ctx *gin.Context) {
 		return
 	}
 
-	idea.ID = ideaID
+	scope := ideaOwnerScope(ctx, guard.WriteAnyIdeas)
 
-	if err := is.IdeaController.UpdateIdea(&idea); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in updating idea"))
+	recordedIdea, err := is.IdeaController.GetIdeaByID(ideaID, scope)
+	if err != nil {
+		respondIdeaError(ctx, err, "Error in getting idea")
+		return
+	}
+	if err := is.prepareIdeaUpdate(&idea, recordedIdea); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
-
-	updatedIdea, err := is.IdeaController.GetIdeaByID(ideaID)
+	// ideas never change owner, the rollups are cut in the owner's time zone
+	loc, err := is.DailyStats.OwnerLocation(ctx, recordedIdea.CreatedBy)
 	if err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting updated idea"))
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
 
+	if err := is.IdeaController.UpdateIdea(&idea, scope, loc); err != nil {
+		respondIdeaError(ctx, err, "Error in updating idea")
+		return
+	}
+
+	updatedIdea, err := is.IdeaController.GetIdeaByID(ideaID, scope)
+	if err != nil {
+		respondIdeaError(ctx, err, "Error in getting updated idea")
+		return
+	}
 	res := utils.NewHttpResponse(http.StatusOK, updatedIdea)
 	ctx.JSON(http.StatusOK, res)
 }
@@ -133,11 +464,22 @@ func (is *IdeaService) DeleteIdea(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
-	if err := is.IdeaController.DeleteIdea(ideaID); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in deleting idea"))
+	scope := ideaOwnerScope(ctx, guard.WriteAnyIdeas)
+	idea, err := is.IdeaController.GetIdeaByID(ideaID, scope)
+	if err != nil {
+		respondIdeaError(ctx, err, "Error in getting idea")
+		return
+	}
+	loc, err := is.DailyStats.OwnerLocation(ctx, idea.CreatedBy)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
+	if err := is.IdeaController.DeleteIdea(ideaID, scope, loc); err != nil {
+		respondIdeaError(ctx, err, "Error in deleting idea")
+		return
+	}
 
 	res := utils.NewHttpResponse(http.StatusOK, "Idea deleted successfully")
 	ctx.JSON(http.StatusOK, res)
@@ -146,7 +488,7 @@ func (is *IdeaService) DeleteIdea(ctx *gin.Context) {
 func (is *IdeaService) GetTotalIdeasOfToday(ctx *gin.Context) {
 	userID := utils.FetchUserFromCtx(ctx)
 
-	result, err := is.IdeaController.GetTotalIdeasOfToday(userID)
+	result, err := is.StatsController.GetTotalIdeasOfToday(userID, utils.FetchLocationFromCtx(ctx))
 
 	if err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting ideas"))
@@ -160,7 +502,7 @@ func (is *IdeaService) GetTotalIdeasOfToday(ctx *gin.Context) {
 func (is *IdeaService) GetTotalIdeasOfAllTime(ctx *gin.Context) {
 	userID := utils.FetchUserFromCtx(ctx)
 
-	result, err := is.IdeaController.GetTotalIdeasOfAllTime(userID)
+	result, err := is.StatsController.GetTotalIdeasOfAllTime(userID)
 	if err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting ideas of all time"))
 		ctx.JSON(http.StatusBadRequest, res)
@@ -170,10 +512,19 @@ func (is *IdeaService) GetTotalIdeasOfAllTime(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, res)
 }
 
+// GetTotalConsecutiveDays returns the current and the longest streak of
+// active days. The optional freezes query allows missed days within a streak.
 func (is *IdeaService) GetTotalConsecutiveDays(ctx *gin.Context) {
+	freezes, err := strconv.Atoi(ctx.DefaultQuery("freezes", "0"))
+	if err != nil || freezes < 0 || freezes > MAX_STREAK_FREEZES {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Freezes must be between 0 and %v", MAX_STREAK_FREEZES))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
 	userID := utils.FetchUserFromCtx(ctx)
 
-	result, err := is.IdeaController.GetTotalConsecutiveDays(userID)
+	result, err := is.StatsController.GetStreaks(userID, utils.FetchLocationFromCtx(ctx), freezes)
 	if err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting total consecutive days"))
 		ctx.JSON(http.StatusBadRequest, res)
@@ -199,7 +550,7 @@ func (is *IdeaService) GetRecentIdeas(ctx *gin.Context) {
 func (is *IdeaService) GetWeeklyIdeas(ctx *gin.Context) {
 	userID := utils.FetchUserFromCtx(ctx)
 
-	result, lastMonday, err := is.IdeaController.GetWeeklyIdeas(userID)
+	result, lastMonday, err := is.StatsController.GetWeeklyIdeas(userID, utils.FetchLocationFromCtx(ctx))
 	if err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting weekly ideas"))
 		ctx.JSON(http.StatusBadRequest, res)
@@ -215,93 +566,326 @@ func (is *IdeaService) GetWeeklyIdeas(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, res)
 }
 
-func (is *IdeaService) SearchIdeas(ctx *gin.Context) {
+// GetTimeToFirstIdea returns the median time until the first idea of a
+// session, over all sessions with recorded offsets.
+func (is *IdeaService) GetTimeToFirstIdea(ctx *gin.Context) {
+	userID := utils.FetchUserFromCtx(ctx)
 
-	type RequestBody struct {
-		SearchInput   string    `json:"searchInput,omitempty"`
-		Category      string    `json:"category,omitempty"`
-		CreatedAtFrom time.Time `json:"createdAtFrom,omitempty"`
-		CreatedAtTo   time.Time `json:"createdAtTo,omitempty"`
-		Pagesize      int       `json:"pageSize,omitempty"`
-		Current       int       `json:"current"`
-		SortByRecent  bool      `json:"sortByRecent,omitempty"`
-		IsLiked       bool      `json:"isLiked,omitempty"`
+	offsets, err := is.IdeaController.GetTimesToFirstIdea(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting time to first idea"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	var req RequestBody
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+	type ResponseBody struct {
+		MedianMs *float64 `json:"medianMs"`
+		Sessions int      `json:"sessions"`
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, &ResponseBody{MedianMs: median(offsets), Sessions: len(offsets)})
+	ctx.JSON(http.StatusOK, res)
+}
+
+// median returns the median of sorted values, or nil without values.
+func median(sorted []int64) *float64 {
+	if len(sorted) == 0 {
+		return nil
+	}
+	middle := len(sorted) / 2
+	result := float64(sorted[middle])
+	if len(sorted)%2 == 0 {
+		result = float64(sorted[middle-1]+sorted[middle]) / 2
+	}
+	return &result
+}
+
+// GetIdeasPerMinute returns the ideas per minute of timed sessions for every
+// day, week or month, given by the interval query (default week).
+func (is *IdeaService) GetIdeasPerMinute(ctx *gin.Context) {
+	interval := ctx.DefaultQuery("interval", "week")
+	if _, ok := controllers.IdeaPaceIntervals[interval]; !ok {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Interval must be day, week or month")
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
 
 	userID := utils.FetchUserFromCtx(ctx)
-
-	// matchStage
-	filter := bson.M{}
-	filter["createdBy"] = userID
-	// filtering createdAt duration
-	if req.CreatedAtFrom.IsZero() && !req.CreatedAtTo.IsZero() {
-		filter["createdAt"] = bson.M{"$lte": req.CreatedAtTo}
+	result, err := is.StatsController.GetIdeasPerMinute(userID, interval, utils.FetchLocationFromCtx(ctx))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting ideas per minute"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
+	res := utils.NewHttpResponse(http.StatusOK, result)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetHeatmap returns the sessions and ideas of every day of a year, given by
+// the year query, or of the days from and to (both inclusive, "2006-01-02").
+// Days are those of the user's time zone; days without sessions are included.
+func (is *IdeaService) GetHeatmap(ctx *gin.Context) {
+	loc := utils.FetchLocationFromCtx(ctx)
 
-	if !req.CreatedAtFrom.IsZero() && req.CreatedAtTo.IsZero() {
-		filter["createdAt"] = bson.M{"$gte": req.CreatedAtFrom}
+	from, to, err := heatmapRange(ctx.Query("year"), ctx.Query("from"), ctx.Query("to"), time.Now(), loc)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	if !req.CreatedAtFrom.IsZero() && !req.CreatedAtTo.IsZero() {
-		filter["createdAt"] = bson.M{"$gte": req.CreatedAtFrom, "$lte": req.CreatedAtTo}
+	userID := utils.FetchUserFromCtx(ctx)
+	counts, err := is.StatsController.GetDailyCounts(userID, from, to, loc)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting heatmap"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	if req.Category != "" {
-		filter["category"] = req.Category
+	type ResponseBody struct {
+		From string              `json:"from"`
+		To   string              `json:"to"`
+		Days []models.DailyCount `json:"days"`
 	}
 
-	if req.IsLiked {
-		filter["isLiked"] = true
+	res := utils.NewHttpResponse(http.StatusOK, &ResponseBody{
+		From: from.Format("2006-01-02"),
+		To:   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Days: fillDailyCounts(counts, from, to),
+	})
+	ctx.JSON(http.StatusOK, res)
+}
+
+// heatmapRange resolves the heatmap queries to local midnights, to being
+// exclusive. Without queries the current year is used.
+func heatmapRange(year string, from string, to string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	if year != "" && (from != "" || to != "") {
+		return time.Time{}, time.Time{}, errors.New("Use either year or from and to")
 	}
 
-	if req.SearchInput != "" {
-		filter["$or"] = []bson.M{
-			{"topicTitle": bson.M{"$regex": req.SearchInput, "$options": "i"}},
-			{"ideas": bson.M{"$regex": req.SearchInput, "$options": "i"}},
-			{"category": bson.M{"$regex": req.SearchInput, "$options": "i"}},
+	if from == "" && to == "" {
+		y := now.In(loc).Year()
+		if year != "" {
+			var err error
+			if y, err = strconv.Atoi(year); err != nil || y < 1970 || y > 9999 {
+				return time.Time{}, time.Time{}, errors.New("Invalid year")
+			}
 		}
+		start := time.Date(y, time.January, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0), nil
+	}
+
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, errors.New("Both from and to are required")
+	}
+	start, err := time.ParseInLocation("2006-01-02", from, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "Invalid from date")
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "Invalid to date")
+	}
+	end = end.AddDate(0, 0, 1)
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, errors.New("From must not be after to")
 	}
+	if start.AddDate(0, 0, MAX_HEATMAP_DAYS).Before(end) {
+		return time.Time{}, time.Time{}, errors.Errorf("The range can span at most %v days", MAX_HEATMAP_DAYS)
+	}
+	return start, end, nil
+}
 
-	// sort
-	var sort int
-	if req.SortByRecent {
-		sort = -1
-	} else {
-		sort = 1
+// fillDailyCounts returns a count for every day from from until to, using
+// zero counts for the days missing in counts.
+func fillDailyCounts(counts []models.DailyCount, from time.Time, to time.Time) []models.DailyCount {
+	byDate := make(map[string]models.DailyCount, len(counts))
+	for _, count := range counts {
+		byDate[count.Date] = count
 	}
 
-	// page and size
-	if req.Current == 0 {
-		req.Current = 1
+	days := []models.DailyCount{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		count, ok := byDate[date]
+		if !ok {
+			count = models.DailyCount{Date: date}
+		}
+		days = append(days, count)
 	}
-	if req.Pagesize == 0 {
-		req.Pagesize = 9
+	return days
+}
+
+type CategoryDelta struct {
+	Sessions     int     `json:"sessions"`
+	Ideas        int     `json:"ideas"`
+	AverageIdeas float64 `json:"averageIdeas"`
+	LikedRatio   float64 `json:"likedRatio"`
+}
+
+type CategoryStats struct {
+	Category     string        `json:"category"`
+	Sessions     int           `json:"sessions"`
+	Ideas        int           `json:"ideas"`
+	AverageIdeas float64       `json:"averageIdeas"`
+	LikedRatio   float64       `json:"likedRatio"`
+	Delta        CategoryDelta `json:"delta"`
+}
+
+// GetCategoryStats returns per category statistics of the last days (query,
+// default 30) including today, with deltas against the days before them.
+func (is *IdeaService) GetCategoryStats(ctx *gin.Context) {
+	days, err := strconv.Atoi(ctx.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > MAX_STATS_DAYS {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Days must be between 1 and %v", MAX_STATS_DAYS))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	results, paginateData, err := is.IdeaController.Search(filter, sort, req.Current, req.Pagesize)
+	userID := utils.FetchUserFromCtx(ctx)
+	to := utils.StartOfDay(time.Now(), utils.FetchLocationFromCtx(ctx)).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -days)
+	previousFrom := from.AddDate(0, 0, -days)
+
+	current, err := is.StatsController.GetCategoryCounts(userID, from, to)
 	if err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in searching ideas"))
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting category stats"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	previous, err := is.StatsController.GetCategoryCounts(userID, previousFrom, from)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting category stats of previous period"))
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
 
 	type ResponseBody struct {
-		Ideas        []models.Idea           `json:"ideas"`
-		PaginateData *paginate.PaginatedData `json:"paginateData"`
+		From         time.Time       `json:"from"`
+		To           time.Time       `json:"to"`
+		PreviousFrom time.Time       `json:"previousFrom"`
+		Categories   []CategoryStats `json:"categories"`
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, &ResponseBody{
+		From:         from,
+		To:           to,
+		PreviousFrom: previousFrom,
+		Categories:   compareCategoryCounts(current, previous),
+	})
+	ctx.JSON(http.StatusOK, res)
+}
+
+// compareCategoryCounts builds the stats of every category of the current
+// period, followed by those only found in the previous one.
+func compareCategoryCounts(current []models.CategoryCounts, previous []models.CategoryCounts) []CategoryStats {
+	previousByCategory := make(map[string]models.CategoryCounts, len(previous))
+	for _, counts := range previous {
+		previousByCategory[counts.Category] = counts
+	}
+
+	stats := []CategoryStats{}
+	add := func(counts models.CategoryCounts, before models.CategoryCounts) {
+		stats = append(stats, CategoryStats{
+			Category:     counts.Category,
+			Sessions:     counts.Sessions,
+			Ideas:        counts.Ideas,
+			AverageIdeas: counts.AverageIdeas(),
+			LikedRatio:   counts.LikedRatio(),
+			Delta: CategoryDelta{
+				Sessions:     counts.Sessions - before.Sessions,
+				Ideas:        counts.Ideas - before.Ideas,
+				AverageIdeas: counts.AverageIdeas() - before.AverageIdeas(),
+				LikedRatio:   counts.LikedRatio() - before.LikedRatio(),
+			},
+		})
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, counts := range current {
+		seen[counts.Category] = true
+		add(counts, previousByCategory[counts.Category])
+	}
+	for _, before := range previous {
+		if !seen[before.Category] {
+			add(models.CategoryCounts{Category: before.Category}, before)
+		}
+	}
+	return stats
+}
+
+// GetTopicStats returns the topics the user came back to with the idea
+// counts of every attempt and the change from the first to the last one.
+func (is *IdeaService) GetTopicStats(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > MAX_TOPICS {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %v", MAX_TOPICS))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	topics, err := is.IdeaController.GetRevisitedTopics(utils.FetchUserFromCtx(ctx), limit)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting topic stats"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type TopicStats struct {
+		models.TopicHistory
+		IdeasChange int `json:"ideasChange"`
+	}
+
+	stats := make([]TopicStats, 0, len(topics))
+	for _, topic := range topics {
+		first, last := topic.Attempts[0], topic.Attempts[len(topic.Attempts)-1]
+		stats = append(stats, TopicStats{TopicHistory: topic, IdeasChange: last.Ideas - first.Ideas})
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, stats)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetTags lists the tags of the user with their session counts, most used
+// first. The prefix query narrows them down for autocompletion.
+func (is *IdeaService) GetTags(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > MAX_TAG_RESULTS {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %v", MAX_TAG_RESULTS))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
+	prefix := strings.ToLower(strings.TrimSpace(ctx.Query("prefix")))
+
+	tags, err := is.IdeaController.GetTags(utils.FetchUserFromCtx(ctx), prefix, limit)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting tags"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, tags)
+	ctx.JSON(http.StatusOK, res)
+}
 
-	resBody := ResponseBody{
-		Ideas:        results,
-		PaginateData: paginateData,
+func (is *IdeaService) SearchIdeas(ctx *gin.Context) {
+	var req SearchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	res := utils.NewHttpResponse(http.StatusOK, resBody)
+	results, err := is.RunSearch(utils.FetchUserFromCtx(ctx), utils.FetchLocationFromCtx(ctx), req)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in searching ideas"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, results)
 	ctx.JSON(http.StatusOK, res)
 }
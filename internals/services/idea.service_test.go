@@ -0,0 +1,233 @@
+package services
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMergeIdeaEntries(t *testing.T) {
+	first, second := int64(4000), int64(9000)
+	recorded := []models.IdeaEntry{{Text: "idea_1", Offset: &first}, {Text: "idea_2", Offset: &second}}
+	updated := []models.IdeaEntry{{Text: "idea_1"}, {Text: "idea_2 changed"}, {Text: "idea_3"}}
+
+	mergeIdeaEntries(recorded, updated)
+
+	if updated[0].Offset != &first || updated[0].Edited {
+		t.Errorf("TestMergeIdeaEntries: expected unchanged entry to keep its offset, got %v", updated[0])
+	}
+	if updated[1].Offset != &second || !updated[1].Edited {
+		t.Errorf("TestMergeIdeaEntries: expected changed entry to be flagged edited, got %v", updated[1])
+	}
+	if updated[2].Offset != nil || !updated[2].Edited {
+		t.Errorf("TestMergeIdeaEntries: expected added entry to be edited without offset, got %v", updated[2])
+	}
+}
+
+func TestMergeIdeaEntriesMatchesByText(t *testing.T) {
+	offsets := []int64{1000, 2000, 3000, 4000, 5000}
+	recorded := make([]models.IdeaEntry, len(offsets))
+	for i := range offsets {
+		recorded[i] = models.IdeaEntry{Text: fmt.Sprintf("idea_%v", i+1), Offset: &offsets[i]}
+	}
+	recorded[4].Edited = true
+
+	cases := []struct {
+		name    string
+		updated []string
+		// want is the recorded entry each updated entry keeps the offset
+		// of, -1 for none
+		want   []int
+		edited []bool
+	}{
+		{
+			name:    "removed middle entry",
+			updated: []string{"idea_1", "idea_2", "idea_4", "idea_5"},
+			want:    []int{0, 1, 3, 4},
+			edited:  []bool{false, false, false, true},
+		},
+		{
+			name:    "moved entry",
+			updated: []string{"idea_3", "idea_1", "idea_2", "idea_4", "idea_5"},
+			want:    []int{2, 0, 1, 3, 4},
+			edited:  []bool{false, false, false, false, true},
+		},
+		{
+			name:    "removed and edited entries",
+			updated: []string{"idea_1", "idea_3 changed", "idea_4", "idea_6"},
+			want:    []int{0, 2, 3, 4},
+			edited:  []bool{false, true, false, true},
+		},
+		{
+			name:    "edited in place",
+			updated: []string{"idea_1", "first", "second", "idea_4", "idea_5"},
+			want:    []int{0, 1, 2, 3, 4},
+			edited:  []bool{false, true, true, false, true},
+		},
+		{
+			name:    "inserted entry",
+			updated: []string{"idea_1", "idea_new", "idea_2", "idea_3", "idea_4", "idea_5"},
+			want:    []int{0, -1, 1, 2, 3, 4},
+			edited:  []bool{false, true, false, false, false, true},
+		},
+	}
+
+	for _, c := range cases {
+		updated := make([]models.IdeaEntry, len(c.updated))
+		for i, text := range c.updated {
+			updated[i] = models.IdeaEntry{Text: text}
+		}
+
+		mergeIdeaEntries(recorded, updated)
+
+		for i, entry := range updated {
+			var want *int64
+			if c.want[i] >= 0 {
+				want = recorded[c.want[i]].Offset
+			}
+			if entry.Offset != want || entry.Edited != c.edited[i] {
+				t.Errorf("TestMergeIdeaEntriesMatchesByText %v: expected entry %v to have offset of %v and edited %v, got %+v", c.name, i, c.want[i], c.edited[i], entry)
+			}
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	if median(nil) != nil {
+		t.Errorf("TestMedian: expected no median without values")
+	}
+	if m := median([]int64{1000, 3000, 8000}); *m != 3000 {
+		t.Errorf("TestMedian: expected 3000, got %v", *m)
+	}
+	if m := median([]int64{1000, 2000, 4000, 9000}); *m != 3000 {
+		t.Errorf("TestMedian: expected 3000, got %v", *m)
+	}
+}
+
+func TestHeatmapRange(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Date(2023, 12, 31, 20, 0, 0, 0, time.UTC) // already 2024 in Tokyo
+
+	cases := []struct {
+		name             string
+		year, from, to   string
+		wantFrom, wantTo time.Time
+		wantErr          bool
+	}{
+		{name: "current year", wantFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, tokyo), wantTo: time.Date(2025, 1, 1, 0, 0, 0, 0, tokyo)},
+		{name: "given year", year: "2022", wantFrom: time.Date(2022, 1, 1, 0, 0, 0, 0, tokyo), wantTo: time.Date(2023, 1, 1, 0, 0, 0, 0, tokyo)},
+		{name: "quarter", from: "2023-04-01", to: "2023-06-30", wantFrom: time.Date(2023, 4, 1, 0, 0, 0, 0, tokyo), wantTo: time.Date(2023, 7, 1, 0, 0, 0, 0, tokyo)},
+		{name: "invalid year", year: "twenty", wantErr: true},
+		{name: "year and range", year: "2023", from: "2023-01-01", to: "2023-01-31", wantErr: true},
+		{name: "missing to", from: "2023-01-01", wantErr: true},
+		{name: "reversed", from: "2023-02-01", to: "2023-01-01", wantErr: true},
+		{name: "too long", from: "2022-01-01", to: "2023-06-30", wantErr: true},
+	}
+
+	for _, c := range cases {
+		from, to, err := heatmapRange(c.year, c.from, c.to, now, tokyo)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("TestHeatmapRange %v: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil || !from.Equal(c.wantFrom) || !to.Equal(c.wantTo) {
+			t.Errorf("TestHeatmapRange %v: expected %v - %v, got %v - %v (%v)", c.name, c.wantFrom, c.wantTo, from, to, err)
+		}
+	}
+}
+
+func TestFillDailyCounts(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	// the range spans the start of DST
+	from := time.Date(2023, 3, 11, 0, 0, 0, 0, newYork)
+	to := time.Date(2023, 3, 14, 0, 0, 0, 0, newYork)
+	counts := []models.DailyCount{{Date: "2023-03-12", TotalSessions: 2, TotalIdeas: 9}}
+
+	days := fillDailyCounts(counts, from, to)
+
+	want := []models.DailyCount{{Date: "2023-03-11"}, counts[0], {Date: "2023-03-13"}}
+	if len(days) != len(want) {
+		t.Fatalf("TestFillDailyCounts: expected %v days, got %v", len(want), days)
+	}
+	for i := range want {
+		if days[i] != want[i] {
+			t.Errorf("TestFillDailyCounts: expected %v, got %v", want[i], days[i])
+		}
+	}
+}
+
+func TestCompareCategoryCounts(t *testing.T) {
+	current := []models.CategoryCounts{
+		{Category: "work", Sessions: 4, Ideas: 20, Liked: 2},
+		{Category: "life", Sessions: 1, Ideas: 3, Liked: 1},
+	}
+	previous := []models.CategoryCounts{
+		{Category: "work", Sessions: 2, Ideas: 6, Liked: 2},
+		{Category: "study", Sessions: 3, Ideas: 9},
+	}
+
+	stats := compareCategoryCounts(current, previous)
+
+	want := []CategoryStats{
+		{Category: "work", Sessions: 4, Ideas: 20, AverageIdeas: 5, LikedRatio: 0.5, Delta: CategoryDelta{Sessions: 2, Ideas: 14, AverageIdeas: 2, LikedRatio: -0.5}},
+		{Category: "life", Sessions: 1, Ideas: 3, AverageIdeas: 3, LikedRatio: 1, Delta: CategoryDelta{Sessions: 1, Ideas: 3, AverageIdeas: 3, LikedRatio: 1}},
+		{Category: "study", Delta: CategoryDelta{Sessions: -3, Ideas: -9, AverageIdeas: -3}},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("TestCompareCategoryCounts: expected %v categories, got %+v", len(want), stats)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("TestCompareCategoryCounts: expected %+v, got %+v", want[i], stats[i])
+		}
+	}
+}
+
+func TestGetIdeaByIDScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ownerID, adminID := primitive.NewObjectID(), primitive.NewObjectID()
+	idea := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic_1", CreatedBy: ownerID}
+	ideaController := &fakeIdeaController{records: []*models.Idea{idea}}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	cases := []struct {
+		name        string
+		userID      primitive.ObjectID
+		role        guard.Role
+		accessToken bool
+		wantStatus  int
+	}{
+		{"owner", ownerID, guard.User, false, http.StatusOK},
+		{"owner access token", ownerID, guard.User, true, http.StatusOK},
+		{"other user", adminID, guard.User, false, http.StatusNotFound},
+		{"admin", adminID, guard.Admin, false, http.StatusOK},
+		// a token acts as its owner only, whatever the owner's role
+		{"admin access token", adminID, guard.Admin, true, http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		router := gin.New()
+		router.GET("/ideas/:id", func(ctx *gin.Context) {
+			ctx.Set("id", c.userID)
+			ctx.Set("role", c.role)
+			if c.accessToken {
+				ctx.Set("accessToken", &models.AccessToken{CreatedBy: c.userID})
+			}
+		}, service.GetIdeaByID)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ideas/"+idea.ID.Hex(), nil))
+		if w.Code != c.wantStatus {
+			t.Errorf("TestGetIdeaByIDScope %v: expected status %v, got %v", c.name, c.wantStatus, w.Code)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	SYNC_OP_CREATE = "create"
+	SYNC_OP_UPDATE = "update"
+	SYNC_OP_DELETE = "delete"
+
+	SYNC_APPLIED  = "applied"
+	SYNC_CONFLICT = "conflict" // the idea changed on the server, see SyncResult
+	SYNC_REJECTED = "rejected" // the change is invalid, do not retry it
+	SYNC_FAILED   = "failed"   // the change may succeed when retried
+
+	MAX_SYNC_CHANGES = 100
+	// ideas created offline keep their creation time if it is this recent
+	MAX_SYNC_OFFLINE = 30 * 24 * time.Hour
+)
+
+// SyncChanges is a batch of the changes since a sync token. Token resumes
+// after the batch; HasMore tells to fetch again right away.
+type SyncChanges struct {
+	Ideas      []models.Idea      `json:"ideas"`
+	Tombstones []models.Tombstone `json:"tombstones"`
+	Token      string             `json:"token"`
+	HasMore    bool               `json:"hasMore"`
+}
+
+// SyncChange is a change a client made offline. IdeaID names the updated
+// or deleted idea; on creates it is optional and makes retries safe.
+// Updates and deletions only apply if the idea was last updated at
+// BaseUpdatedAt, the updatedAt the client last saw.
+type SyncChange struct {
+	Op            string             `json:"op"`
+	IdeaID        primitive.ObjectID `json:"ideaId,omitempty"`
+	Idea          *models.Idea       `json:"idea,omitempty"`
+	BaseUpdatedAt time.Time          `json:"baseUpdatedAt,omitempty"`
+}
+
+// SyncResult is the outcome of a SyncChange. Idea is the idea as applied,
+// or the one on the server for conflicts. Deleted tells that the idea is
+// no longer on the server.
+type SyncResult struct {
+	Op      string             `json:"op"`
+	IdeaID  primitive.ObjectID `json:"ideaId"`
+	Status  string             `json:"status"`
+	Idea    *models.Idea       `json:"idea,omitempty"`
+	Deleted bool               `json:"deleted,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// GetChanges answers the ideas created or updated and the tombstones of the
+// ideas deleted since the since token, in the order they were written.
+// Without a token it answers all ideas, to start syncing from scratch.
+// Changes are read up to the last committed number of the sync sequence of
+// the user, so no token passes a write that commits later.
+func (is *IdeaService) GetChanges(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(models.MAX_PAGE_LIMIT)))
+	if err != nil || limit < 1 || limit > models.MAX_PAGE_LIMIT {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %v", models.MAX_PAGE_LIMIT))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	now := time.Now()
+	var since *models.SyncToken
+	if encoded := ctx.Query("since"); encoded != "" {
+		since, err = models.DecodeSyncToken(encoded)
+		if errors.Is(err, models.ErrSyncTokenOutdated) || (err == nil && since.IssuedAt.Before(now.Add(-models.TOMBSTONE_RETENTION))) {
+			res := utils.NewHttpResponse(http.StatusGone, "Sync token expired, sync again without a token")
+			ctx.JSON(http.StatusGone, res)
+			return
+		}
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid sync token"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	until, err := is.IdeaController.GetSyncSequence(userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting sync sequence"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	// the next token continues after until, unless a batch is cut off earlier
+	next := models.SyncToken{
+		Ideas:      models.SyncPosition{Seq: until},
+		Tombstones: models.SyncPosition{Seq: until},
+		IssuedAt:   now,
+	}
+
+	var ideasAfter *models.SyncPosition
+	if since != nil {
+		ideasAfter = &since.Ideas
+	}
+	ideas, moreIdeas, err := is.IdeaController.GetChangedIdeas(userID, ideasAfter, until, limit)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting changed ideas"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if moreIdeas {
+		last := ideas[len(ideas)-1]
+		next.Ideas = models.SyncPosition{Seq: last.SyncSeq, ID: last.ID}
+	}
+
+	// a client syncing from scratch has nothing to delete
+	tombstones := []models.Tombstone{}
+	moreTombstones := false
+	if since != nil {
+		tombstones, moreTombstones, err = is.IdeaController.GetTombstones(userID, &since.Tombstones, until, limit)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting deleted ideas"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		if moreTombstones {
+			last := tombstones[len(tombstones)-1]
+			next.Tombstones = models.SyncPosition{Seq: last.SyncSeq, ID: last.ID}
+		}
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, SyncChanges{
+		Ideas:      ideas,
+		Tombstones: tombstones,
+		Token:      next.Encode(),
+		HasMore:    moreIdeas || moreTombstones,
+	})
+	ctx.JSON(http.StatusOK, res)
+}
+
+// SyncIdeas applies a batch of changes made offline, in order, and answers
+// the outcome of each. A change fails on its own, the others still apply.
+func (is *IdeaService) SyncIdeas(ctx *gin.Context) {
+	type RequestBody struct {
+		Changes []SyncChange `json:"changes"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if len(req.Changes) > MAX_SYNC_CHANGES {
+		res := utils.NewHttpResponse(http.StatusBadRequest, fmt.Sprintf("At most %v changes can be synced at once", MAX_SYNC_CHANGES))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	results := make([]SyncResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		var result SyncResult
+		switch change.Op {
+		case SYNC_OP_CREATE:
+			result = is.syncCreate(ctx, userID, change)
+		case SYNC_OP_UPDATE:
+			result = is.syncUpdate(ctx, userID, change)
+		case SYNC_OP_DELETE:
+			result = is.syncDelete(ctx, userID, change)
+		default:
+			result = SyncResult{Status: SYNC_REJECTED, Error: fmt.Sprintf("unknown op %q", change.Op)}
+		}
+		result.Op = change.Op
+		if result.IdeaID.IsZero() {
+			result.IdeaID = change.IdeaID
+		}
+		results = append(results, result)
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, results)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// syncFailure turns err into the result of a change, a rejection if the
+// change itself is at fault.
+func syncFailure(err error, rejected bool) SyncResult {
+	if rejected {
+		return SyncResult{Status: SYNC_REJECTED, Error: err.Error()}
+	}
+	return SyncResult{Status: SYNC_FAILED, Error: err.Error()}
+}
+
+// syncConflict answers a change to an idea that changed on the server.
+func (is *IdeaService) syncConflict(userID primitive.ObjectID, ideaID primitive.ObjectID) SyncResult {
+	current, err := is.IdeaController.GetIdeaByID(ideaID, controllers.OwnedBy(userID))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return SyncResult{Status: SYNC_CONFLICT, Deleted: true}
+	}
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	return SyncResult{Status: SYNC_CONFLICT, Idea: current}
+}
+
+func (is *IdeaService) syncCreate(ctx *gin.Context, userID primitive.ObjectID, change SyncChange) SyncResult {
+	if change.Idea == nil {
+		return syncFailure(errors.New("idea is missing"), true)
+	}
+	idea := *change.Idea
+	createdAt := idea.CreatedAt
+	if err := is.prepareNewIdea(userID, &idea); err != nil {
+		return syncFailure(err, true)
+	}
+	idea.ID = change.IdeaID
+	if !createdAt.IsZero() {
+		now := time.Now()
+		if createdAt.Before(now.Add(-MAX_SYNC_OFFLINE)) {
+			return syncFailure(errors.Errorf("createdAt is more than %v days ago", MAX_SYNC_OFFLINE/(24*time.Hour)), true)
+		}
+		if createdAt.After(now) {
+			createdAt = now
+		}
+		idea.CreatedAt = createdAt
+	}
+
+	loc, err := is.DailyStats.OwnerLocation(ctx, userID)
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	newIdea, err := is.IdeaController.CreateIdea(&idea, loc)
+	if mongo.IsDuplicateKeyError(err) {
+		// a retried upload, the idea was created the first time
+		if existing, err := is.IdeaController.GetIdeaByID(change.IdeaID, controllers.OwnedBy(userID)); err == nil {
+			return SyncResult{Status: SYNC_APPLIED, IdeaID: existing.ID, Idea: existing}
+		}
+		return syncFailure(errors.New("idea id is taken"), true)
+	}
+	if err != nil {
+		return syncFailure(errors.Wrap(err, "Error in creating idea"), false)
+	}
+	is.DailyStats.IdeaCreated(newIdea, loc)
+	// the stored times are rounded, clients compare against them later
+	created, err := is.IdeaController.GetIdeaByID(newIdea.ID, controllers.OwnedBy(userID))
+	if err != nil {
+		return syncFailure(errors.Wrap(err, "Error in getting created idea"), false)
+	}
+	return SyncResult{Status: SYNC_APPLIED, IdeaID: created.ID, Idea: created}
+}
+
+func (is *IdeaService) syncUpdate(ctx *gin.Context, userID primitive.ObjectID, change SyncChange) SyncResult {
+	if change.Idea == nil {
+		return syncFailure(errors.New("idea is missing"), true)
+	}
+	recorded, err := is.IdeaController.GetIdeaByID(change.IdeaID, controllers.OwnedBy(userID))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return SyncResult{Status: SYNC_CONFLICT, Deleted: true}
+	}
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	if !recorded.UpdatedAt.Equal(change.BaseUpdatedAt) {
+		return SyncResult{Status: SYNC_CONFLICT, Idea: recorded}
+	}
+
+	idea := *change.Idea
+	if err := is.prepareIdeaUpdate(&idea, recorded); err != nil {
+		return syncFailure(err, true)
+	}
+	loc, err := is.DailyStats.OwnerLocation(ctx, userID)
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	// the check above may race with another write, the update rechecks
+	err = is.IdeaController.UpdateIdeaIfUnchanged(&idea, controllers.OwnedBy(userID), recorded.UpdatedAt, loc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return is.syncConflict(userID, change.IdeaID)
+	}
+	if err != nil {
+		return syncFailure(errors.Wrap(err, "Error in updating idea"), false)
+	}
+	updated, err := is.IdeaController.GetIdeaByID(change.IdeaID, controllers.OwnedBy(userID))
+	if err != nil {
+		return syncFailure(errors.Wrap(err, "Error in getting updated idea"), false)
+	}
+	return SyncResult{Status: SYNC_APPLIED, Idea: updated}
+}
+
+func (is *IdeaService) syncDelete(ctx *gin.Context, userID primitive.ObjectID, change SyncChange) SyncResult {
+	recorded, err := is.IdeaController.GetIdeaByID(change.IdeaID, controllers.OwnedBy(userID))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// deleting twice is harmless
+		return SyncResult{Status: SYNC_APPLIED, Deleted: true}
+	}
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	if !recorded.UpdatedAt.Equal(change.BaseUpdatedAt) {
+		return SyncResult{Status: SYNC_CONFLICT, Idea: recorded}
+	}
+
+	loc, err := is.DailyStats.OwnerLocation(ctx, userID)
+	if err != nil {
+		return syncFailure(err, false)
+	}
+	err = is.IdeaController.DeleteIdeaIfUnchanged(change.IdeaID, controllers.OwnedBy(userID), recorded.UpdatedAt, loc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if result := is.syncConflict(userID, change.IdeaID); !result.Deleted {
+			return result
+		}
+		return SyncResult{Status: SYNC_APPLIED, Deleted: true}
+	}
+	if err != nil {
+		return syncFailure(errors.Wrap(err, "Error in deleting idea"), false)
+	}
+	return SyncResult{Status: SYNC_APPLIED, Deleted: true}
+}
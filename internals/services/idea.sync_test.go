@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (fc *fakeIdeaController) UpdateIdeaIfUnchanged(idea *models.Idea, scope controllers.IdeaScope, updatedAt time.Time, loc *time.Location) error {
+	for _, recorded := range fc.records {
+		if recorded.ID == idea.ID && scope.Includes(recorded.CreatedBy) && recorded.UpdatedAt.Equal(updatedAt) {
+			recorded.TopicTitle = idea.TopicTitle
+			// zero fields are left unchanged, like with $set
+			if !idea.CreatedAt.IsZero() {
+				recorded.CreatedAt = idea.CreatedAt
+			}
+			recorded.UpdatedAt = updatedAt.Add(time.Second)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (fc *fakeIdeaController) DeleteIdeaIfUnchanged(ideaID primitive.ObjectID, scope controllers.IdeaScope, updatedAt time.Time, loc *time.Location) error {
+	for i, recorded := range fc.records {
+		if recorded.ID == ideaID && scope.Includes(recorded.CreatedBy) && recorded.UpdatedAt.Equal(updatedAt) {
+			fc.records = append(fc.records[:i], fc.records[i+1:]...)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func TestSyncIdeas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	seen := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	updated := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic_1", CreatedBy: userID, UpdatedAt: seen}
+	stale := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic_2", CreatedBy: userID, UpdatedAt: seen.Add(time.Minute)}
+	deleted := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic_3", CreatedBy: userID, UpdatedAt: seen}
+	foreign := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic_4", CreatedBy: primitive.NewObjectID(), UpdatedAt: seen}
+	ideaController := &fakeIdeaController{records: []*models.Idea{updated, stale, deleted, foreign}}
+	dailyStats := &fakeDailyStatsService{}
+	service := NewIdeaService(ideaController, ideaController, dailyStats, &fakeCategoryService{})
+
+	router := gin.New()
+	router.POST("/ideas/sync", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.SyncIdeas)
+	sync := func(changes []map[string]interface{}) (int, []SyncResult) {
+		b, _ := json.Marshal(map[string]interface{}{"changes": changes})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ideas/sync", bytes.NewReader(b)))
+		var res struct {
+			Data []SyncResult `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Data
+	}
+
+	offline := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+	createdID := primitive.NewObjectID()
+	code, results := sync([]map[string]interface{}{
+		{"op": "create", "ideaId": createdID, "idea": map[string]interface{}{"topicTitle": "offline", "createdAt": offline}},
+		{"op": "create", "idea": map[string]interface{}{"topicTitle": "too old", "createdAt": time.Now().Add(-2 * MAX_SYNC_OFFLINE)}},
+		{"op": "update", "ideaId": updated.ID, "baseUpdatedAt": seen, "idea": map[string]interface{}{"topicTitle": "topic_1 offline"}},
+		{"op": "update", "ideaId": stale.ID, "baseUpdatedAt": seen, "idea": map[string]interface{}{"topicTitle": "topic_2 offline"}},
+		{"op": "update", "ideaId": foreign.ID, "baseUpdatedAt": seen, "idea": map[string]interface{}{"topicTitle": "topic_4 offline"}},
+		{"op": "delete", "ideaId": deleted.ID, "baseUpdatedAt": seen},
+		{"op": "delete", "ideaId": deleted.ID, "baseUpdatedAt": seen},
+		{"op": "move", "ideaId": updated.ID},
+	})
+	if code != http.StatusOK || len(results) != 8 {
+		t.Fatalf("TestSyncIdeas: expected 8 results, got status %v and %v", code, results)
+	}
+
+	want := []struct {
+		status  string
+		deleted bool
+	}{
+		{SYNC_APPLIED, false},
+		{SYNC_REJECTED, false},
+		{SYNC_APPLIED, false},
+		{SYNC_CONFLICT, false},
+		{SYNC_CONFLICT, true}, // ideas of other users can not be told apart from deleted ones
+		{SYNC_APPLIED, true},
+		{SYNC_APPLIED, true},
+		{SYNC_REJECTED, false},
+	}
+	for i, result := range results {
+		if result.Status != want[i].status || result.Deleted != want[i].deleted {
+			t.Errorf("TestSyncIdeas: expected change %v to be %v (deleted %v), got %+v", i, want[i].status, want[i].deleted, result)
+		}
+	}
+
+	if created := results[0].Idea; results[0].IdeaID != createdID || created == nil || !created.CreatedAt.Equal(offline) || created.CreatedBy != userID {
+		t.Errorf("TestSyncIdeas: expected the offline idea with its id and time, got %+v", results[0])
+	}
+	if len(dailyStats.added) != 1 {
+		t.Errorf("TestSyncIdeas: expected the created idea to be counted, got %v", len(dailyStats.added))
+	}
+	if updated.TopicTitle != "topic_1 offline" || results[2].Idea == nil || !results[2].Idea.UpdatedAt.After(seen) {
+		t.Errorf("TestSyncIdeas: expected the update to apply, got %+v", results[2])
+	}
+	if stale.TopicTitle != "topic_2" || results[3].Idea == nil || results[3].Idea.TopicTitle != "topic_2" {
+		t.Errorf("TestSyncIdeas: expected the server version on conflict, got %+v", results[3])
+	}
+	if foreign.TopicTitle != "topic_4" {
+		t.Errorf("TestSyncIdeas: expected ideas of other users to stay unchanged")
+	}
+	if _, err := ideaController.GetIdeaByID(deleted.ID, controllers.OwnedBy(userID)); err == nil {
+		t.Errorf("TestSyncIdeas: expected the idea to be deleted")
+	}
+
+	tooMany := make([]map[string]interface{}, MAX_SYNC_CHANGES+1)
+	if code, _ := sync(tooMany); code != http.StatusBadRequest {
+		t.Errorf("TestSyncIdeas: expected status %v for too many changes, got %v", http.StatusBadRequest, code)
+	}
+}
+
+func TestSyncUpdateKeepsCreatedAt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	seen := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	createdAt := seen.Add(-time.Hour)
+	idea := &models.Idea{ID: primitive.NewObjectID(), TopicTitle: "topic", CreatedBy: userID, CreatedAt: createdAt, UpdatedAt: seen}
+	ideaController := &fakeIdeaController{records: []*models.Idea{idea}}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	router := gin.New()
+	router.POST("/ideas/sync", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.SyncIdeas)
+	b, _ := json.Marshal(map[string]interface{}{"changes": []map[string]interface{}{
+		{"op": "update", "ideaId": idea.ID, "baseUpdatedAt": seen, "idea": map[string]interface{}{"topicTitle": "moved", "createdAt": seen.AddDate(-1, 0, 0)}},
+	}})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ideas/sync", bytes.NewReader(b)))
+	var res struct {
+		Data []SyncResult `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+
+	if len(res.Data) != 1 || res.Data[0].Status != SYNC_APPLIED {
+		t.Fatalf("TestSyncUpdateKeepsCreatedAt: expected the update to apply, got status %v and %v", w.Code, w.Body.String())
+	}
+	if idea.TopicTitle != "moved" || !idea.CreatedAt.Equal(createdAt) {
+		t.Errorf("TestSyncUpdateKeepsCreatedAt: expected the title to change and createdAt to stay %v, got %q at %v", createdAt, idea.TopicTitle, idea.CreatedAt)
+	}
+}
+
+// fakeSyncController keeps ideas and tombstones sorted by sync sequence
+// number and _id.
+type fakeSyncController struct {
+	controllers.IIdeaController
+	seq        int64
+	ideas      []models.Idea
+	tombstones []models.Tombstone
+}
+
+// syncedAfter reports whether a record numbered seq is after the position of
+// after, if given, up to until.
+func syncedAfter(seq int64, id primitive.ObjectID, after *models.SyncPosition, until int64) bool {
+	if seq > until {
+		return false
+	}
+	if after == nil {
+		return true
+	}
+	return seq > after.Seq || (seq == after.Seq && !after.ID.IsZero() && id.Hex() > after.ID.Hex())
+}
+
+func (fc *fakeSyncController) GetSyncSequence(userID primitive.ObjectID) (int64, error) {
+	return fc.seq, nil
+}
+
+func (fc *fakeSyncController) GetChangedIdeas(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Idea, bool, error) {
+	ideas := []models.Idea{}
+	for _, idea := range fc.ideas {
+		if syncedAfter(idea.SyncSeq, idea.ID, after, until) {
+			ideas = append(ideas, idea)
+		}
+	}
+	if len(ideas) > limit {
+		return ideas[:limit], true, nil
+	}
+	return ideas, false, nil
+}
+
+func (fc *fakeSyncController) GetTombstones(userID primitive.ObjectID, after *models.SyncPosition, until int64, limit int) ([]models.Tombstone, bool, error) {
+	tombstones := []models.Tombstone{}
+	for _, tombstone := range fc.tombstones {
+		if syncedAfter(tombstone.SyncSeq, tombstone.ID, after, until) {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	if len(tombstones) > limit {
+		return tombstones[:limit], true, nil
+	}
+	return tombstones, false, nil
+}
+
+func TestGetChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	// legacy has no number, moved ones share one and pending is not committed
+	legacy := models.Idea{ID: primitive.NewObjectID(), TopicTitle: "legacy"}
+	created := models.Idea{ID: primitive.NewObjectID(), TopicTitle: "created", SyncSeq: 1}
+	moved := []models.Idea{
+		{ID: primitive.NewObjectID(), TopicTitle: "moved_1", SyncSeq: 2},
+		{ID: primitive.NewObjectID(), TopicTitle: "moved_2", SyncSeq: 2},
+	}
+	pending := models.Idea{ID: primitive.NewObjectID(), TopicTitle: "pending", SyncSeq: 3}
+	ideaController := &fakeSyncController{seq: 2, ideas: []models.Idea{legacy, created, moved[0], moved[1], pending}}
+	service := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+
+	router := gin.New()
+	router.GET("/ideas/changes", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.GetChanges)
+	pull := func(query string) (int, SyncChanges) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ideas/changes?"+query, nil))
+		var res struct {
+			Data SyncChanges `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Data
+	}
+	titles := func(ideas []models.Idea) []string {
+		got := []string{}
+		for _, idea := range ideas {
+			got = append(got, idea.TopicTitle)
+		}
+		return got
+	}
+
+	// batches split the ideas sharing a number without losing one
+	code, first := pull("limit=3")
+	if code != http.StatusOK || !first.HasMore || !reflect.DeepEqual(titles(first.Ideas), []string{"legacy", "created", "moved_1"}) {
+		t.Fatalf("TestGetChanges: expected the first batch, got status %v and %+v", code, first)
+	}
+	code, second := pull("limit=3&since=" + first.Token)
+	if code != http.StatusOK || second.HasMore || !reflect.DeepEqual(titles(second.Ideas), []string{"moved_2"}) {
+		t.Fatalf("TestGetChanges: expected the rest up to the committed number, got status %v and %+v", code, second)
+	}
+
+	// writes committing later are picked up with their number
+	ideaController.seq = 4
+	ideaController.tombstones = []models.Tombstone{{ID: primitive.NewObjectID(), IdeaID: created.ID, SyncSeq: 4}}
+	code, third := pull("since=" + second.Token)
+	if code != http.StatusOK || !reflect.DeepEqual(titles(third.Ideas), []string{"pending"}) || len(third.Tombstones) != 1 {
+		t.Errorf("TestGetChanges: expected the later writes, got status %v and %+v", code, third)
+	}
+	code, fourth := pull("since=" + third.Token)
+	if code != http.StatusOK || len(fourth.Ideas) != 0 || len(fourth.Tombstones) != 0 {
+		t.Errorf("TestGetChanges: expected no changes, got status %v and %+v", code, fourth)
+	}
+
+	// tokens of the time based layout sync again from scratch
+	layout, _ := json.Marshal(map[string]models.Cursor{
+		"i": {Field: "updatedAt", Order: 1, Time: time.Now()},
+		"t": {Field: "deletedAt", Order: 1, Time: time.Now()},
+	})
+	outdated := base64.RawURLEncoding.EncodeToString(layout)
+	if code, _ := pull("since=" + outdated); code != http.StatusGone {
+		t.Errorf("TestGetChanges: expected status %v for an outdated token, got %v", http.StatusGone, code)
+	}
+	if code, _ := pull("since=nope"); code != http.StatusBadRequest {
+		t.Errorf("TestGetChanges: expected status %v for an invalid token, got %v", http.StatusBadRequest, code)
+	}
+}
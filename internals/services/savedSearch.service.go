@@ -0,0 +1,335 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ISavedSearchService interface {
+	GetSavedSearches(ctx *gin.Context)
+	CreateSavedSearch(ctx *gin.Context)
+	UpdateSavedSearch(ctx *gin.Context)
+	DeleteSavedSearch(ctx *gin.Context)
+	GetSavedSearchResults(ctx *gin.Context)
+	GetSmartCollections(ctx *gin.Context)
+}
+
+type SavedSearchService struct {
+	SavedSearchController controllers.ISavedSearchController
+	IdeaService           IIdeaService
+}
+
+// NewSavedSearchService runs the saved searches through ideaService, the
+// same way as SearchIdeas.
+func NewSavedSearchService(savedSearchController controllers.ISavedSearchController, ideaService IIdeaService) ISavedSearchService {
+	return &SavedSearchService{
+		SavedSearchController: savedSearchController,
+		IdeaService:           ideaService,
+	}
+}
+
+// SmartCollection is a pinned saved search with the number of ideas it
+// finds. Error is set instead if the search failed.
+type SmartCollection struct {
+	SavedSearch *models.SavedSearch `json:"savedSearch"`
+	Count       int64               `json:"count"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// decodeSearchRequest reads a stored search body into a SearchRequest.
+// Fields the request does not know are ignored, fields missing from the
+// body keep their zero value.
+func decodeSearchRequest(body bson.M) (SearchRequest, error) {
+	var req SearchRequest
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return req, err
+	}
+	err = json.Unmarshal(encoded, &req)
+	return req, err
+}
+
+// storedSearchRequest checks body like SearchIdeas does and returns it for
+// storing. The page and the cursor are not stored, they are given when
+// fetching the results.
+func storedSearchRequest(body map[string]interface{}) (bson.M, error) {
+	stored := bson.M{}
+	for key, value := range body {
+		if key != "current" && key != "cursor" {
+			stored[key] = value
+		}
+	}
+	req, err := decodeSearchRequest(stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// checkLimits fails if the user can not save another search or pin another
+// one.
+func (ss *SavedSearchService) checkLimits(userID primitive.ObjectID, adding bool, pinning bool) error {
+	searches, err := ss.SavedSearchController.GetSavedSearches(userID, false)
+	if err != nil {
+		return errors.Wrap(err, "Error in getting saved searches")
+	}
+	if adding && len(searches) >= models.MAX_SAVED_SEARCHES {
+		return fmt.Errorf("At most %v searches can be saved", models.MAX_SAVED_SEARCHES)
+	}
+	pinned := 0
+	for _, search := range searches {
+		if search.Pinned {
+			pinned++
+		}
+	}
+	if pinning && pinned >= models.MAX_PINNED_SEARCHES {
+		return fmt.Errorf("At most %v searches can be pinned", models.MAX_PINNED_SEARCHES)
+	}
+	return nil
+}
+
+// respondSavedSearchError answers 404 for unknown saved searches and 409
+// for names the user already has.
+func respondSavedSearchError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		res := utils.NewHttpResponse(http.StatusNotFound, "Saved search not found")
+		ctx.JSON(http.StatusNotFound, res)
+	case mongo.IsDuplicateKeyError(err):
+		res := utils.NewHttpResponse(http.StatusConflict, "Saved search already exists")
+		ctx.JSON(http.StatusConflict, res)
+	default:
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, message))
+		ctx.JSON(http.StatusBadRequest, res)
+	}
+}
+
+func (ss *SavedSearchService) GetSavedSearches(ctx *gin.Context) {
+	searches, err := ss.SavedSearchController.GetSavedSearches(utils.FetchUserFromCtx(ctx), false)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting saved searches"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, searches)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// CreateSavedSearch saves the body of a search under a name. The body is
+// validated like the body of SearchIdeas.
+func (ss *SavedSearchService) CreateSavedSearch(ctx *gin.Context) {
+	type RequestBody struct {
+		Name    string                 `json:"name"`
+		Request map[string]interface{} `json:"request"`
+		Pinned  bool                   `json:"pinned,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	userID := utils.FetchUserFromCtx(ctx)
+	search := &models.SavedSearch{Name: req.Name, Pinned: req.Pinned, CreatedBy: userID}
+	search.Normalize()
+	if err := search.Validate(); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid saved search"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	request, err := storedSearchRequest(req.Request)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid search request"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	search.Request = request
+	if err := ss.checkLimits(userID, true, search.Pinned); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	newSearch, err := ss.SavedSearchController.CreateSavedSearch(search)
+	if err != nil {
+		respondSavedSearchError(ctx, err, "Error in saving search")
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusCreated, newSearch)
+	ctx.JSON(http.StatusCreated, res)
+}
+
+// UpdateSavedSearch renames, pins or unpins a saved search or replaces its
+// search request.
+func (ss *SavedSearchService) UpdateSavedSearch(ctx *gin.Context) {
+	searchID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid saved search id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type RequestBody struct {
+		Name    *string                `json:"name,omitempty"`
+		Request map[string]interface{} `json:"request,omitempty"`
+		Pinned  *bool                  `json:"pinned,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	search, err := ss.SavedSearchController.GetSavedSearch(searchID, userID)
+	if err != nil {
+		respondSavedSearchError(ctx, err, "Error in getting saved search")
+		return
+	}
+	if req.Name != nil {
+		search.Name = *req.Name
+	}
+	search.Normalize()
+	if err := search.Validate(); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid saved search"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if req.Request != nil {
+		request, err := storedSearchRequest(req.Request)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid search request"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		search.Request = request
+	}
+	if req.Pinned != nil {
+		if *req.Pinned && !search.Pinned {
+			if err := ss.checkLimits(userID, false, true); err != nil {
+				res := utils.NewHttpResponse(http.StatusBadRequest, err)
+				ctx.JSON(http.StatusBadRequest, res)
+				return
+			}
+		}
+		search.Pinned = *req.Pinned
+	}
+
+	if err := ss.SavedSearchController.UpdateSavedSearch(search); err != nil {
+		respondSavedSearchError(ctx, err, "Error in updating saved search")
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, search)
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (ss *SavedSearchService) DeleteSavedSearch(ctx *gin.Context) {
+	searchID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid saved search id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	if err := ss.SavedSearchController.DeleteSavedSearch(searchID, utils.FetchUserFromCtx(ctx)); err != nil {
+		respondSavedSearchError(ctx, err, "Error in deleting saved search")
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, searchID)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetSavedSearchResults runs a saved search and answers like SearchIdeas.
+// The current query selects the page, or the cursor query for searches
+// paging by cursor.
+func (ss *SavedSearchService) GetSavedSearchResults(ctx *gin.Context) {
+	searchID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid saved search id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	current, err := strconv.Atoi(ctx.DefaultQuery("current", "1"))
+	if err != nil || current < 1 {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Current must be a positive page number")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	search, err := ss.SavedSearchController.GetSavedSearch(searchID, userID)
+	if err != nil {
+		respondSavedSearchError(ctx, err, "Error in getting saved search")
+		return
+	}
+	req, err := decodeSearchRequest(search.Request)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Saved search request is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	req.Current = current
+	req.Cursor = ctx.Query("cursor")
+
+	results, err := ss.IdeaService.RunSearch(userID, utils.FetchLocationFromCtx(ctx), req)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in searching ideas"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusOK, results)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetSmartCollections lists the pinned saved searches with live counts. A
+// failing search is reported on its collection, the others are still
+// answered.
+func (ss *SavedSearchService) GetSmartCollections(ctx *gin.Context) {
+	userID := utils.FetchUserFromCtx(ctx)
+	searches, err := ss.SavedSearchController.GetSavedSearches(userID, true)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting saved searches"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	loc := utils.FetchLocationFromCtx(ctx)
+	collections := make([]SmartCollection, 0, len(searches))
+	for _, search := range searches {
+		collection := SmartCollection{SavedSearch: search}
+		req, err := decodeSearchRequest(search.Request)
+		if err == nil {
+			// the count comes with any current page, the smallest will do
+			req.Current = 1
+			req.Pagesize = 1
+			req.Limit = 0
+			var results *SearchResults
+			if results, err = ss.IdeaService.RunSearch(userID, loc, req); err == nil && results.PaginateData != nil {
+				collection.Count = results.PaginateData.Pagination.Total
+			}
+		}
+		if err != nil {
+			collection.Error = err.Error()
+		}
+		collections = append(collections, collection)
+	}
+	res := utils.NewHttpResponse(http.StatusOK, collections)
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fakeSavedSearchController struct {
+	controllers.ISavedSearchController
+	searches []*models.SavedSearch
+}
+
+func (fc *fakeSavedSearchController) CreateSavedSearch(search *models.SavedSearch) (*models.SavedSearch, error) {
+	search.ID = primitive.NewObjectID()
+	fc.searches = append(fc.searches, search)
+	return search, nil
+}
+
+func (fc *fakeSavedSearchController) GetSavedSearches(userID primitive.ObjectID, pinnedOnly bool) ([]*models.SavedSearch, error) {
+	searches := []*models.SavedSearch{}
+	for _, search := range fc.searches {
+		if search.CreatedBy == userID && (search.Pinned || !pinnedOnly) {
+			searches = append(searches, search)
+		}
+	}
+	return searches, nil
+}
+
+func (fc *fakeSavedSearchController) GetSavedSearch(searchID primitive.ObjectID, userID primitive.ObjectID) (*models.SavedSearch, error) {
+	for _, search := range fc.searches {
+		if search.ID == searchID && search.CreatedBy == userID {
+			return search, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fc *fakeSavedSearchController) DeleteSavedSearchesOfUser(userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+func TestSavedSearches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	ideaController := &fakeIdeaController{records: []*models.Idea{
+		{ID: primitive.NewObjectID(), TopicTitle: "plan_1", CreatedBy: userID},
+		{ID: primitive.NewObjectID(), TopicTitle: "plan_2", CreatedBy: userID},
+	}}
+	searchController := &fakeSavedSearchController{}
+	ideaService := NewIdeaService(ideaController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{})
+	service := NewSavedSearchService(searchController, ideaService)
+
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	})
+	router.POST("/searches", service.CreateSavedSearch)
+	router.GET("/searches/collections", service.GetSmartCollections)
+	router.GET("/searches/:id/results", service.GetSavedSearchResults)
+	call := func(method string, path string, body interface{}, data interface{}) (int, string) {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(b)))
+		res := struct {
+			Message string      `json:"message"`
+			Data    interface{} `json:"data"`
+		}{Data: data}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Message
+	}
+
+	// saved searches are validated like SearchIdeas
+	invalid := []map[string]interface{}{
+		{"sortBy": "random"},
+		{"q": "liked:maybe"},
+		{"pageSize": "nine"},
+	}
+	for _, request := range invalid {
+		if code, _ := call(http.MethodPost, "/searches", map[string]interface{}{"name": "invalid", "request": request}, nil); code != http.StatusBadRequest {
+			t.Errorf("TestSavedSearches: expected status %v for %v, got %v", http.StatusBadRequest, request, code)
+		}
+	}
+	if len(searchController.searches) != 0 {
+		t.Fatalf("TestSavedSearches: expected invalid searches not to be saved")
+	}
+
+	// fields the search does not know are kept, the page is not
+	var saved models.SavedSearch
+	body := map[string]interface{}{
+		"name":    " Liked plans ",
+		"request": map[string]interface{}{"q": "liked:true plan", "current": 3, "laterField": true},
+		"pinned":  true,
+	}
+	if code, message := call(http.MethodPost, "/searches", body, &saved); code != http.StatusCreated {
+		t.Fatalf("TestSavedSearches: expected status %v, got %v %q", http.StatusCreated, code, message)
+	}
+	if saved.Name != "Liked plans" || saved.Request["laterField"] != true || saved.Request["current"] != nil {
+		t.Errorf("TestSavedSearches: unexpected saved search %+v", saved)
+	}
+
+	var results SearchResults
+	if code, message := call(http.MethodGet, "/searches/"+saved.ID.Hex()+"/results?current=2", nil, &results); code != http.StatusOK {
+		t.Fatalf("TestSavedSearches: expected status %v, got %v %q", http.StatusOK, code, message)
+	}
+	filter := ideaController.searches[len(ideaController.searches)-1]
+	if clauses, _ := filter["$and"].([]bson.M); len(clauses) != 2 || filter["createdBy"] != userID || len(results.Ideas) != 2 {
+		t.Errorf("TestSavedSearches: expected the saved query to run, got %v", filter)
+	}
+	if code, _ := call(http.MethodGet, "/searches/"+primitive.NewObjectID().Hex()+"/results", nil, nil); code != http.StatusNotFound {
+		t.Errorf("TestSavedSearches: expected status %v for an unknown search, got %v", http.StatusNotFound, code)
+	}
+
+	// a broken search does not hide the other collections
+	searchController.searches = append(searchController.searches, &models.SavedSearch{
+		ID: primitive.NewObjectID(), Name: "broken", Request: bson.M{"sortBy": "random"}, Pinned: true, CreatedBy: userID,
+	}, &models.SavedSearch{
+		ID: primitive.NewObjectID(), Name: "unpinned", Request: bson.M{}, CreatedBy: userID,
+	})
+	collections := []SmartCollection{}
+	if code, _ := call(http.MethodGet, "/searches/collections", nil, &collections); code != http.StatusOK {
+		t.Fatalf("TestSavedSearches: expected status %v, got %v", http.StatusOK, code)
+	}
+	if len(collections) != 2 || collections[0].Count != 2 || collections[0].Error != "" || collections[1].Error == "" {
+		t.Errorf("TestSavedSearches: unexpected collections %+v", collections)
+	}
+}
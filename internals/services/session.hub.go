@@ -0,0 +1,91 @@
+package services
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SESSION_EVENT_TICK     = "tick"
+	SESSION_EVENT_TIME_UP  = "timeup"
+	SESSION_EVENT_IDEA     = "idea"
+	SESSION_EVENT_FINISHED = "finished"
+
+	// events are dropped for subscribers that fall this far behind
+	SESSION_EVENT_BUFFER = 16
+)
+
+type SessionEvent struct {
+	Type string
+	Data interface{}
+}
+
+// SessionHub fans out the events of a session to every stream following it.
+// Subscriptions live in memory, so all streams of a session have to be served
+// by the same server instance.
+type SessionHub struct {
+	mu          sync.Mutex
+	subscribers map[primitive.ObjectID]map[chan SessionEvent]struct{}
+}
+
+func NewSessionHub() *SessionHub {
+	return &SessionHub{
+		subscribers: map[primitive.ObjectID]map[chan SessionEvent]struct{}{},
+	}
+}
+
+// Subscribe returns a channel receiving the events of the session and a
+// function to unsubscribe. The channel is closed when the session is closed.
+func (h *SessionHub) Subscribe(sessionID primitive.ObjectID) (<-chan SessionEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan SessionEvent, SESSION_EVENT_BUFFER)
+	if h.subscribers[sessionID] == nil {
+		h.subscribers[sessionID] = map[chan SessionEvent]struct{}{}
+	}
+	h.subscribers[sessionID][events] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[sessionID][events]; ok {
+			delete(h.subscribers[sessionID], events)
+			if len(h.subscribers[sessionID]) == 0 {
+				delete(h.subscribers, sessionID)
+			}
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+// Publish sends event to the subscribers of the session without blocking.
+func (h *SessionHub) Publish(sessionID primitive.ObjectID, event SessionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.subscribers[sessionID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// Close sends a last event to the subscribers of the session and closes
+// their channels.
+func (h *SessionHub) Close(sessionID primitive.ObjectID, event SessionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.subscribers[sessionID] {
+		select {
+		case events <- event:
+		default:
+		}
+		close(events)
+	}
+	delete(h.subscribers, sessionID)
+}
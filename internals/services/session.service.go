@@ -0,0 +1,433 @@
+package services
+
+import (
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_SESSION_TIME_LIMIT   = 60 * time.Second
+	DEFAULT_SESSION_GRACE_PERIOD = 5 * time.Second
+
+	SESSION_TICK_INTERVAL = time.Second
+	// streams of sessions that are never finished are closed this long
+	// after the time is up
+	SESSION_STREAM_TIMEOUT = 5 * time.Minute
+)
+
+// SessionConfig controls the timing of training sessions. Ideas submitted
+// after the time limit plus the grace period are late: they are rejected
+// when RejectLate is set and kept but flagged otherwise.
+type SessionConfig struct {
+	TimeLimit   time.Duration
+	GracePeriod time.Duration
+	RejectLate  bool
+}
+
+type ISessionService interface {
+	StartSession(ctx *gin.Context)
+	GetSession(ctx *gin.Context)
+	AddSessionIdea(ctx *gin.Context)
+	FinishSession(ctx *gin.Context)
+	StreamSession(ctx *gin.Context)
+}
+
+type SessionService struct {
+	SessionController controllers.ISessionController
+	IdeaController    controllers.IIdeaController
+	DailyStats        IDailyStatsService
+	Categories        ICategoryService
+	Config            SessionConfig
+	Hub               *SessionHub
+	now               func() time.Time
+	tickInterval      time.Duration
+}
+
+func NewSessionService(sessionController controllers.ISessionController, ideaController controllers.IIdeaController, dailyStats IDailyStatsService, categories ICategoryService, config SessionConfig) ISessionService {
+	if config.TimeLimit <= 0 {
+		config.TimeLimit = DEFAULT_SESSION_TIME_LIMIT
+	}
+	if config.GracePeriod < 0 {
+		config.GracePeriod = 0
+	}
+	return &SessionService{
+		SessionController: sessionController,
+		IdeaController:    ideaController,
+		DailyStats:        dailyStats,
+		Categories:        categories,
+		Config:            config,
+		Hub:               NewSessionHub(),
+		now:               time.Now,
+		tickInterval:      SESSION_TICK_INTERVAL,
+	}
+}
+
+// respondSessionError answers 404 for sessions that do not exist or belong
+// to another user.
+func respondSessionError(ctx *gin.Context, err error, message string) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		res := utils.NewHttpResponse(http.StatusNotFound, "Session not found")
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+	res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, message))
+	ctx.JSON(http.StatusBadRequest, res)
+}
+
+func (ss *SessionService) StartSession(ctx *gin.Context) {
+	type RequestBody struct {
+		TopicTitle string `json:"topicTitle,omitempty"`
+		Category   string `json:"category,omitempty"`
+	}
+
+	// the body is optional, the topic can also be given when finishing
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	if req.Category != "" {
+		category, err := ss.Categories.ResolveCategory(userID, req.Category)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		req.Category = category
+	}
+
+	startedAt := ss.now()
+	session := &models.Session{
+		TopicTitle: req.TopicTitle,
+		Category:   req.Category,
+		CreatedBy:  userID,
+		StartedAt:  startedAt,
+		Deadline:   startedAt.Add(ss.Config.TimeLimit),
+	}
+	newSession, err := ss.SessionController.CreateSession(session)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in starting session"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusCreated, newSession)
+	ctx.JSON(http.StatusCreated, res)
+}
+
+func (ss *SessionService) GetSession(ctx *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid session id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	session, err := ss.SessionController.GetSession(sessionID, utils.FetchUserFromCtx(ctx))
+	if err != nil {
+		respondSessionError(ctx, err, "Error in getting session")
+		return
+	}
+
+	res := utils.NewHttpResponse(http.StatusOK, session)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// AddSessionIdea appends an idea to an active session. The submission time
+// is taken from the server clock, never from the request.
+func (ss *SessionService) AddSessionIdea(ctx *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid session id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type RequestBody struct {
+		Text string `json:"text"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		res := utils.NewHttpResponse(http.StatusBadRequest, "Idea text is required")
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	session, err := ss.SessionController.GetSession(sessionID, userID)
+	if err != nil {
+		respondSessionError(ctx, err, "Error in getting session")
+		return
+	}
+	if session.Status != models.SESSION_ACTIVE {
+		res := utils.NewHttpResponse(http.StatusConflict, "Session is already finished")
+		ctx.JSON(http.StatusConflict, res)
+		return
+	}
+
+	submittedAt := ss.now()
+	late := submittedAt.After(session.Deadline.Add(ss.Config.GracePeriod))
+	if late && ss.Config.RejectLate {
+		res := utils.NewHttpResponse(http.StatusConflict, "Time is up for this session")
+		ctx.JSON(http.StatusConflict, res)
+		return
+	}
+
+	entry := models.SessionEntry{
+		Text:        strings.TrimSpace(req.Text),
+		SubmittedAt: submittedAt,
+		Late:        late,
+	}
+	if err := ss.SessionController.AddSessionEntry(sessionID, userID, entry); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// finished between the lookup and the update
+			res := utils.NewHttpResponse(http.StatusConflict, "Session is already finished")
+			ctx.JSON(http.StatusConflict, res)
+			return
+		}
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in adding idea to session"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	ss.Hub.Publish(sessionID, SessionEvent{Type: SESSION_EVENT_IDEA, Data: entry})
+
+	res := utils.NewHttpResponse(http.StatusCreated, entry)
+	ctx.JSON(http.StatusCreated, res)
+}
+
+// FinishSession turns a session into an idea record. Finishing is
+// idempotent: repeating the request, for example after a failure to save
+// the idea, returns the idea of the session instead of creating another.
+func (ss *SessionService) FinishSession(ctx *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid session id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	type RequestBody struct {
+		TopicTitle string    `json:"topicTitle,omitempty"`
+		Category   string    `json:"category,omitempty"`
+		Comment    *string   `json:"comment,omitempty"`
+		Tags       *[]string `json:"tags,omitempty"`
+	}
+
+	var req RequestBody
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	if req.Category != "" {
+		category, err := ss.Categories.ResolveCategory(userID, req.Category)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid category"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		req.Category = category
+	}
+	session, err := ss.SessionController.FinishSession(sessionID, userID, primitive.NewObjectID(), ss.now())
+	if err != nil && errors.Is(err, mongo.ErrNoDocuments) {
+		// the session is unknown or was finished before
+		session, err = ss.SessionController.GetSession(sessionID, userID)
+	}
+	if err != nil {
+		respondSessionError(ctx, err, "Error in finishing session")
+		return
+	}
+
+	idea, err := ss.IdeaController.GetIdeaByID(session.IdeaID, controllers.OwnedBy(userID))
+	if err == nil {
+		res := utils.NewHttpResponse(http.StatusOK, idea)
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in getting idea of session"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	idea = sessionIdea(session)
+	if req.TopicTitle != "" {
+		idea.TopicTitle = req.TopicTitle
+	}
+	if req.Category != "" {
+		idea.Category = req.Category
+	} else if idea.Category != "" {
+		// the category of the session may have been renamed or deleted since
+		category, err := ss.Categories.ResolveCategory(userID, idea.Category)
+		if errors.Is(err, ErrUnknownCategory) {
+			category = models.DEFAULT_CATEGORY
+		} else if err != nil {
+			res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in checking category, retry to finish the session"))
+			ctx.JSON(http.StatusInternalServerError, res)
+			return
+		}
+		idea.Category = category
+	}
+	idea.Comment = req.Comment
+	idea.Tags = req.Tags
+	if err := normalizeIdeaTags(idea); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid tags"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	loc, err := ss.DailyStats.OwnerLocation(ctx, userID)
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in creating idea, retry to finish the session"))
+		ctx.JSON(http.StatusInternalServerError, res)
+		return
+	}
+	newIdea, err := ss.IdeaController.CreateIdea(idea, loc)
+	if err == nil {
+		ss.DailyStats.IdeaCreated(newIdea, loc)
+	} else {
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent request created the idea first
+			newIdea, err = ss.IdeaController.GetIdeaByID(session.IdeaID, controllers.OwnedBy(userID))
+		}
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusInternalServerError, errors.Wrap(err, "Error in creating idea, retry to finish the session"))
+			ctx.JSON(http.StatusInternalServerError, res)
+			return
+		}
+	}
+
+	ss.Hub.Close(session.ID, SessionEvent{Type: SESSION_EVENT_FINISHED, Data: newIdea})
+
+	res := utils.NewHttpResponse(http.StatusCreated, newIdea)
+	ctx.JSON(http.StatusCreated, res)
+}
+
+// StreamSession pushes the events of a session as Server-Sent Events: a tick
+// with the remaining time every second, "timeup" once the time limit passed,
+// every accepted idea and "finished" with the idea record, after which the
+// stream is closed. Any number of streams can follow the same session.
+func (ss *SessionService) StreamSession(ctx *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid session id"))
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userID := utils.FetchUserFromCtx(ctx)
+	// subscribe before the lookup, so a finish in between is not missed
+	events, unsubscribe := ss.Hub.Subscribe(sessionID)
+	defer unsubscribe()
+
+	session, err := ss.SessionController.GetSession(sessionID, userID)
+	if err != nil {
+		respondSessionError(ctx, err, "Error in getting session")
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	send := func(event SessionEvent) {
+		ctx.SSEvent(event.Type, event.Data)
+		ctx.Writer.Flush()
+	}
+
+	if session.Status != models.SESSION_ACTIVE {
+		send(SessionEvent{Type: SESSION_EVENT_FINISHED, Data: session})
+		return
+	}
+
+	ticker := time.NewTicker(ss.tickInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(session.Deadline.Add(SESSION_STREAM_TIMEOUT).Sub(ss.now()))
+	defer timeout.Stop()
+
+	timeUp := false
+	tick := func() {
+		if timeUp {
+			return
+		}
+		now := ss.now()
+		if !now.Before(session.Deadline) {
+			timeUp = true
+			send(SessionEvent{Type: SESSION_EVENT_TIME_UP, Data: gin.H{"deadline": session.Deadline}})
+			return
+		}
+		send(SessionEvent{Type: SESSION_EVENT_TICK, Data: gin.H{
+			"elapsedMs":   now.Sub(session.StartedAt).Milliseconds(),
+			"remainingMs": session.Deadline.Sub(now).Milliseconds(),
+		}})
+	}
+	tick()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-timeout.C:
+			return
+		case <-ticker.C:
+			tick()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			send(event)
+			if event.Type == SESSION_EVENT_FINISHED {
+				return
+			}
+		}
+	}
+}
+
+// sessionIdea builds the idea record of a finished session.
+func sessionIdea(session *models.Session) *models.Idea {
+	ideas := []models.IdeaEntry{}
+	lateIdeas := 0
+	for _, entry := range session.Entries {
+		offset := entry.SubmittedAt.Sub(session.StartedAt).Milliseconds()
+		ideas = append(ideas, models.IdeaEntry{Text: entry.Text, Offset: &offset})
+		if entry.Late {
+			lateIdeas++
+		}
+	}
+	duration := session.Duration().Seconds()
+
+	return &models.Idea{
+		ID:         session.IdeaID,
+		TopicTitle: session.TopicTitle,
+		Category:   session.Category,
+		Ideas:      &ideas,
+		CreatedBy:  session.CreatedBy,
+		SessionID:  session.ID,
+		Duration:   &duration,
+		LateIdeas:  &lateIdeas,
+	}
+}
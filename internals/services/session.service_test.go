@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (fc *fakeSessionController) CreateSession(session *models.Session) (*models.Session, error) {
+	session.ID = primitive.NewObjectID()
+	session.Status = models.SESSION_ACTIVE
+	session.Entries = []models.SessionEntry{}
+	fc.sessions[session.ID] = session
+	return session, nil
+}
+
+func (fc *fakeSessionController) GetSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID) (*models.Session, error) {
+	session, ok := fc.sessions[sessionID]
+	if !ok || session.CreatedBy != ownerID {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (fc *fakeSessionController) AddSessionEntry(sessionID primitive.ObjectID, ownerID primitive.ObjectID, entry models.SessionEntry) error {
+	session, ok := fc.sessions[sessionID]
+	if !ok || session.CreatedBy != ownerID || session.Status != models.SESSION_ACTIVE {
+		return mongo.ErrNoDocuments
+	}
+	session.Entries = append(session.Entries, entry)
+	return nil
+}
+
+func (fc *fakeSessionController) FinishSession(sessionID primitive.ObjectID, ownerID primitive.ObjectID, ideaID primitive.ObjectID, finishedAt time.Time) (*models.Session, error) {
+	session, ok := fc.sessions[sessionID]
+	if !ok || session.CreatedBy != ownerID || session.Status != models.SESSION_ACTIVE {
+		return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOneAndUpdate")
+	}
+	session.Status = models.SESSION_FINISHED
+	session.FinishedAt = &finishedAt
+	session.IdeaID = ideaID
+	copied := *session
+	return &copied, nil
+}
+
+func (fc *fakeIdeaController) CreateIdea(idea *models.Idea, loc *time.Location) (*models.Idea, error) {
+	if fc.createErr != nil {
+		return nil, fc.createErr
+	}
+	if idea.ID.IsZero() {
+		idea.ID = primitive.NewObjectID()
+	}
+	fc.records = append(fc.records, idea)
+	return idea, nil
+}
+
+func (fc *fakeIdeaController) GetIdeaByID(ideaID primitive.ObjectID, scope controllers.IdeaScope) (*models.Idea, error) {
+	for _, idea := range fc.records {
+		if idea.ID == ideaID && scope.Includes(idea.CreatedBy) {
+			return idea, nil
+		}
+	}
+	return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+}
+
+type fakeDailyStatsService struct {
+	IDailyStatsService
+	added   []*models.Idea
+	rebuilt []primitive.ObjectID
+}
+
+func (fs *fakeDailyStatsService) Rebuild(userID primitive.ObjectID, loc *time.Location) error {
+	fs.rebuilt = append(fs.rebuilt, userID)
+	return nil
+}
+
+func (fs *fakeDailyStatsService) OwnerLocation(ctx *gin.Context, ownerID primitive.ObjectID) (*time.Location, error) {
+	return time.UTC, nil
+}
+
+func (fs *fakeDailyStatsService) IdeaCreated(idea *models.Idea, loc *time.Location) {
+	fs.added = append(fs.added, idea)
+}
+
+type sessionTestClient struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+func newSessionTestClient(t *testing.T, service ISessionService, userID primitive.ObjectID) *sessionTestClient {
+	router := gin.New()
+	auth := func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}
+	router.POST("/sessions/start", auth, service.StartSession)
+	router.POST("/sessions/:id/ideas", auth, service.AddSessionIdea)
+	router.POST("/sessions/:id/finish", auth, service.FinishSession)
+	return &sessionTestClient{t: t, router: router}
+}
+
+func (c *sessionTestClient) post(path string, body interface{}, data interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, reader))
+	res := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		c.t.Fatalf("%v: invalid response %v", path, w.Body.String())
+	}
+	return w.Code
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	clock := time.Date(2023, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	sessionController := &fakeSessionController{sessions: map[primitive.ObjectID]*models.Session{}}
+	ideaController := &fakeIdeaController{}
+	dailyStats := &fakeDailyStatsService{}
+	service := NewSessionService(sessionController, ideaController, dailyStats, &fakeCategoryService{}, SessionConfig{GracePeriod: 5 * time.Second})
+	service.(*SessionService).now = func() time.Time { return clock }
+	client := newSessionTestClient(t, service, userID)
+
+	var session models.Session
+	if code := client.post("/sessions/start", map[string]string{"topicTitle": "topic_1"}, &session); code != http.StatusCreated {
+		t.Fatalf("TestSessionLifecycle: expected status %v, got %v", http.StatusCreated, code)
+	}
+	if !session.StartedAt.Equal(clock) || !session.Deadline.Equal(clock.Add(DEFAULT_SESSION_TIME_LIMIT)) {
+		t.Fatalf("TestSessionLifecycle: expected server start time and deadline, got %v", session)
+	}
+	base := "/sessions/" + session.ID.Hex()
+
+	if code := client.post(base+"/ideas", map[string]string{"text": " "}, nil); code != http.StatusBadRequest {
+		t.Errorf("TestSessionLifecycle: expected empty idea to be rejected, got %v", code)
+	}
+
+	clock = clock.Add(20 * time.Second)
+	var entry models.SessionEntry
+	if code := client.post(base+"/ideas", map[string]string{"text": "idea_1"}, &entry); code != http.StatusCreated || !entry.SubmittedAt.Equal(clock) || entry.Late {
+		t.Errorf("TestSessionLifecycle: expected on-time idea, got status %v and %v", code, entry)
+	}
+
+	// within the grace period
+	clock = clock.Add(43 * time.Second)
+	client.post(base+"/ideas", map[string]string{"text": "idea_2"}, &entry)
+	if entry.Late {
+		t.Errorf("TestSessionLifecycle: expected idea within the grace period not to be late")
+	}
+
+	clock = clock.Add(10 * time.Second)
+	client.post(base+"/ideas", map[string]string{"text": "idea_3"}, &entry)
+	if !entry.Late {
+		t.Errorf("TestSessionLifecycle: expected idea after the grace period to be flagged late")
+	}
+
+	var idea models.Idea
+	if code := client.post(base+"/finish", map[string]string{"category": "category_1"}, &idea); code != http.StatusCreated {
+		t.Fatalf("TestSessionLifecycle: expected status %v, got %v", http.StatusCreated, code)
+	}
+	if idea.SessionID != session.ID || idea.TopicTitle != "topic_1" || idea.Category != "category_1" || len(*idea.Ideas) != 3 {
+		t.Errorf("TestSessionLifecycle: unexpected idea %v", idea)
+	}
+	if offset := (*idea.Ideas)[1].Offset; offset == nil || *offset != 63000 {
+		t.Errorf("TestSessionLifecycle: expected idea offset from the session start, got %v", offset)
+	}
+	if *idea.Duration != DEFAULT_SESSION_TIME_LIMIT.Seconds() || *idea.LateIdeas != 1 {
+		t.Errorf("TestSessionLifecycle: expected duration capped at the time limit and 1 late idea, got %v and %v", *idea.Duration, *idea.LateIdeas)
+	}
+
+	if code := client.post(base+"/ideas", map[string]string{"text": "idea_4"}, nil); code != http.StatusConflict {
+		t.Errorf("TestSessionLifecycle: expected finished session to reject ideas, got %v", code)
+	}
+
+	// finishing again returns the same idea
+	var again models.Idea
+	if code := client.post(base+"/finish", nil, &again); code != http.StatusOK || again.ID != idea.ID || len(ideaController.records) != 1 {
+		t.Errorf("TestSessionLifecycle: expected repeated finish to return the idea, got status %v and %v ideas", code, len(ideaController.records))
+	}
+	if len(dailyStats.added) != 1 || dailyStats.added[0].ID != idea.ID {
+		t.Errorf("TestSessionLifecycle: expected the idea to be added to the daily stats once, got %v", dailyStats.added)
+	}
+
+	other := newSessionTestClient(t, service, primitive.NewObjectID())
+	if code := other.post(base+"/finish", nil, nil); code != http.StatusNotFound {
+		t.Errorf("TestSessionLifecycle: expected session of other user to be not found, got %v", code)
+	}
+}
+
+func TestSessionRejectLate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+	clock := time.Date(2023, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	sessionController := &fakeSessionController{sessions: map[primitive.ObjectID]*models.Session{}}
+	ideaController := &fakeIdeaController{createErr: errors.New("insert failed")}
+	service := NewSessionService(sessionController, ideaController, &fakeDailyStatsService{}, &fakeCategoryService{}, SessionConfig{TimeLimit: 30 * time.Second, RejectLate: true})
+	service.(*SessionService).now = func() time.Time { return clock }
+	client := newSessionTestClient(t, service, userID)
+
+	var session models.Session
+	client.post("/sessions/start", nil, &session)
+	base := "/sessions/" + session.ID.Hex()
+
+	clock = clock.Add(10 * time.Second)
+	if code := client.post(base+"/ideas", map[string]string{"text": "idea_1"}, nil); code != http.StatusCreated {
+		t.Errorf("TestSessionRejectLate: expected on-time idea to be accepted, got %v", code)
+	}
+	clock = clock.Add(21 * time.Second)
+	if code := client.post(base+"/ideas", map[string]string{"text": "idea_2"}, nil); code != http.StatusConflict {
+		t.Errorf("TestSessionRejectLate: expected late idea to be rejected, got %v", code)
+	}
+
+	// a failed finish can be retried
+	if code := client.post(base+"/finish", nil, nil); code != http.StatusInternalServerError {
+		t.Fatalf("TestSessionRejectLate: expected status %v, got %v", http.StatusInternalServerError, code)
+	}
+	ideaController.createErr = nil
+	var idea models.Idea
+	if code := client.post(base+"/finish", nil, &idea); code != http.StatusCreated || len(*idea.Ideas) != 1 || *idea.Duration != 30 {
+		t.Errorf("TestSessionRejectLate: expected retried finish to create the idea, got status %v and %v", code, idea)
+	}
+	if idea.ID != sessionController.sessions[session.ID].IdeaID {
+		t.Errorf("TestSessionRejectLate: expected idea to keep the id reserved by the session")
+	}
+}
+
+func TestStreamSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+
+	sessionController := &fakeSessionController{sessions: map[primitive.ObjectID]*models.Session{}}
+	service := NewSessionService(sessionController, &fakeIdeaController{}, &fakeDailyStatsService{}, &fakeCategoryService{}, SessionConfig{TimeLimit: 300 * time.Millisecond})
+	service.(*SessionService).tickInterval = 20 * time.Millisecond
+	client := newSessionTestClient(t, service, userID)
+	client.router.GET("/sessions/:id/stream", func(ctx *gin.Context) {
+		ctx.Set("id", userID)
+	}, service.StreamSession)
+	server := httptest.NewServer(client.router)
+	defer server.Close()
+
+	var session models.Session
+	client.post("/sessions/start", nil, &session)
+	base := "/sessions/" + session.ID.Hex()
+
+	openStream := func() (<-chan string, *http.Response) {
+		res, err := http.Get(server.URL + base + "/stream")
+		if err != nil {
+			t.Fatalf("TestStreamSession: %v", err)
+		}
+		if res.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("TestStreamSession: expected event stream, got %v", res.Header.Get("Content-Type"))
+		}
+		events := make(chan string, 100)
+		go func() {
+			defer close(events)
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if line := scanner.Text(); strings.HasPrefix(line, "event:") {
+					events <- strings.TrimPrefix(line, "event:")
+				}
+			}
+		}()
+		return events, res
+	}
+	waitFor := func(events <-chan string, want string) {
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					t.Fatalf("TestStreamSession: stream closed before %v", want)
+				}
+				if event == want {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("TestStreamSession: timed out waiting for %v", want)
+			}
+		}
+	}
+
+	// two devices follow the same session
+	first, firstRes := openStream()
+	defer firstRes.Body.Close()
+	second, secondRes := openStream()
+	defer secondRes.Body.Close()
+	waitFor(first, SESSION_EVENT_TICK)
+	waitFor(second, SESSION_EVENT_TICK)
+
+	client.post(base+"/ideas", map[string]string{"text": "idea_1"}, nil)
+	waitFor(first, SESSION_EVENT_IDEA)
+	waitFor(second, SESSION_EVENT_IDEA)
+	waitFor(first, SESSION_EVENT_TIME_UP)
+
+	client.post(base+"/finish", nil, nil)
+	waitFor(first, SESSION_EVENT_FINISHED)
+	waitFor(second, SESSION_EVENT_FINISHED)
+	if _, ok := <-first; ok {
+		t.Errorf("TestStreamSession: expected stream to close after the session finished")
+	}
+
+	// a finished session answers with its final state right away
+	finished, finishedRes := openStream()
+	defer finishedRes.Body.Close()
+	waitFor(finished, SESSION_EVENT_FINISHED)
+}
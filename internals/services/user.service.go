@@ -1,14 +1,16 @@
 package services
 
 import (
-	"context"
 	"idea-training-version-go/internals/controllers"
-	"idea-training-version-go/internals/db"
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/models"
 	"idea-training-version-go/internals/utils"
-	"idea-training-version-go/internals/utils/firebase"
+	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
@@ -26,95 +28,140 @@ type IUserService interface {
 	GetUserByEmail(ctx *gin.Context)
 }
 
+// IIdentityProvider manages the accounts users sign in with.
+type IIdentityProvider interface {
+	CreateUser(email, password, firstName, lastName string) (string, error)
+	DeleteUser(uid string) error
+}
+
 type UserService struct {
-	UserController controllers.IUserController
+	UserController   controllers.IUserController
+	DailyStats       IDailyStatsService
+	IdentityProvider IIdentityProvider
 }
 
-func NewUserService(userController controllers.IUserController) IUserService {
+func NewUserService(userController controllers.IUserController, dailyStats IDailyStatsService, identityProvider IIdentityProvider) IUserService {
 	return &UserService{
-		UserController: userController,
+		UserController:   userController,
+		DailyStats:       dailyStats,
+		IdentityProvider: identityProvider,
 	}
 }
 
+// SignUp validates the request, creates the identity unless the client
+// already did, then persists the user. When persisting fails, an identity
+// created here is deleted again so no orphaned account is left behind.
+// A client created identity is taken from the verified ID token of the
+// request, whose email has to be verified and the one signed up.
 func (us *UserService) SignUp(ctx *gin.Context) {
 	type RequestBody struct {
-		FirstName   string         `json:"firstName"`
-		LastName    string         `json:"lastName,omitempty"`
-		Email       string         `json:"email"`
-		Password    string         `json:"password"`
-		FirebaseUID string         `json:"firebaseUID,omitempty"`
-		Images      []models.Image `json:"images,omitempty"`
+		FirstName string         `json:"firstName"`
+		LastName  string         `json:"lastName,omitempty"`
+		Email     string         `json:"email"`
+		Password  string         `json:"password"`
+		Images    []models.Image `json:"images,omitempty"`
 	}
 	var req RequestBody
-	var user models.User
-	var newUser *models.User
-	var session mongo.Session
-	var err error
 
-	if err = ctx.ShouldBindJSON(&req); err != nil {
+	// validate
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Request body is not valid"))
 		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
-
-	if session, err = db.MongoDB.StartSession(); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating mongo session"))
+	tokenUID := utils.FetchTokenUIDFromCtx(ctx)
+	if err := validateSignUp(req.Email, req.Password, req.FirstName, tokenUID); err != nil {
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
 		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
-
-	if err = session.StartTransaction(); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in starting transaction"))
+	if tokenUID != "" && !strings.EqualFold(utils.FetchVerifiedEmailFromCtx(ctx), req.Email) {
+		res := utils.NewHttpResponse(http.StatusForbidden, "Signing up an existing identity needs its ID token with the email verified")
+		ctx.JSON(http.StatusForbidden, res)
+		return
+	}
+	if tokenUID != "" {
+		if _, err := us.UserController.GetUserByFirebaseUID(tokenUID); err == nil {
+			res := utils.NewHttpResponse(http.StatusConflict, "User with this identity already exists")
+			ctx.JSON(http.StatusConflict, res)
+			return
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in checking existing user"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+	}
+	if _, err := us.UserController.GetUserByEmail(req.Email); err == nil {
+		res := utils.NewHttpResponse(http.StatusConflict, "User with this email already exists")
+		ctx.JSON(http.StatusConflict, res)
+		return
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in checking existing user"))
 		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
 	// register in firebase
-	var firebaseUID string
-	if req.FirebaseUID == "" {
-		firebaseUID, err = firebase.CreateUserInFirebase(req.Email, req.Password, req.FirstName, req.LastName)
+	firebaseUID := tokenUID
+	createdIdentity := false
+	if firebaseUID == "" {
+		uid, err := us.IdentityProvider.CreateUser(req.Email, req.Password, req.FirstName, req.LastName)
 		if err != nil {
 			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating user in firebase"))
 			ctx.JSON(http.StatusBadRequest, res)
 			return
 		}
-	} else {
-		firebaseUID = req.FirebaseUID
+		firebaseUID = uid
+		createdIdentity = true
 	}
 
-	user.FirebaseUID = firebaseUID
-	user.FirstName = req.FirstName
-	user.LastName = req.LastName
-	user.Email = req.Email
-
-	if err := mongo.WithSession(context.Background(), session, func(sc mongo.SessionContext) error {
-		// register in mongodb
-		newUser, err = us.UserController.CreateUser(&user)
-		if err != nil {
-			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating user in mongodb"))
-			ctx.JSON(http.StatusBadRequest, res)
-			return err
-		}
-
-		if err = session.CommitTransaction(sc); err != nil {
-			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in committing transaction"))
-			ctx.JSON(http.StatusBadRequest, res)
+	// register in mongodb
+	user := models.User{
+		FirebaseUID: firebaseUID,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		Email:       req.Email,
+		Images:      req.Images,
+	}
+	newUser, err := us.UserController.CreateUser(&user)
+	if err != nil {
+		err = errors.Wrap(err, "Error in creating user in mongodb")
+		if createdIdentity {
+			if rollbackErr := us.IdentityProvider.DeleteUser(firebaseUID); rollbackErr != nil {
+				log.Println("Failed to roll back firebase user", firebaseUID, rollbackErr)
+				err = errors.Wrapf(err, "rolling back firebase user failed (%v)", rollbackErr)
+			}
 		}
-		return nil
-	}); err != nil {
-		res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Error in creating session"))
+		res := utils.NewHttpResponse(http.StatusBadRequest, err)
 		ctx.JSON(http.StatusBadRequest, res)
+		return
 	}
 
-	session.EndSession(context.Background())
-
 	res := utils.NewHttpResponse(http.StatusOK, newUser)
 	ctx.JSON(http.StatusOK, res)
 }
 
+func validateSignUp(email, password, firstName, firebaseUID string) error {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return errors.Wrap(err, "Email is not valid")
+	}
+	if strings.TrimSpace(firstName) == "" {
+		return errors.New("First name is required")
+	}
+	// firebase rejects passwords shorter than 6 characters
+	if firebaseUID == "" && len(password) < 6 {
+		return errors.New("Password must be at least 6 characters")
+	}
+	return nil
+}
+
 func (us *UserService) UpdateUser(ctx *gin.Context) {
 	type RequestBody struct {
 		Email     string         `json:"email,omitempty"`
 		FirstName string         `json:"firstName,omitempty"`
 		LastName  string         `json:"lastName,omitempty"`
 		Images    []models.Image `json:"images,omitempty"`
+		Timezone  string         `json:"timezone,omitempty"`
 	}
 
 	var req RequestBody
@@ -129,6 +176,11 @@ func (us *UserService) UpdateUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, res)
 		return
 	}
+	if userID != utils.FetchUserFromCtx(ctx) && !utils.CanActForAnyUserFromCtx(ctx, guard.WriteAnyUsers) {
+		res := utils.NewHttpResponse(http.StatusForbidden, "Users can only update their own account")
+		ctx.JSON(http.StatusForbidden, res)
+		return
+	}
 
 	// Bind json
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -137,11 +189,39 @@ func (us *UserService) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
+	// the email is the one the identity provider verified for the user
+	if req.Email != "" {
+		recordedUser, err := us.UserController.GetUserByID(userID)
+		if err != nil {
+			res := utils.NewHttpResponse(http.StatusNotFound, errors.Wrap(err, "User not found"))
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		if !strings.EqualFold(recordedUser.Email, req.Email) && (userID != utils.FetchUserFromCtx(ctx) || !strings.EqualFold(utils.FetchVerifiedEmailFromCtx(ctx), req.Email)) {
+			res := utils.NewHttpResponse(http.StatusForbidden, "Email changes need an ID token with the new email verified")
+			ctx.JSON(http.StatusForbidden, res)
+			return
+		}
+	}
+
+	timezoneChanged := false
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			res := utils.NewHttpResponse(http.StatusBadRequest, errors.Wrap(err, "Invalid timezone"))
+			ctx.JSON(http.StatusBadRequest, res)
+			return
+		}
+		if recordedUser, err := us.UserController.GetUserByID(userID); err == nil {
+			timezoneChanged = recordedUser.Timezone != req.Timezone
+		}
+	}
+
 	user := &models.User{
 		Email:     req.Email,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Images:    req.Images,
+		Timezone:  req.Timezone,
 	}
 
 	// update in mongodb
@@ -157,6 +237,13 @@ func (us *UserService) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
+	// the daily stats are cut in the time zone of the user
+	if timezoneChanged {
+		if err = us.DailyStats.Rebuild(userID, utils.LoadLocation(updatedUser.Timezone)); err != nil {
+			log.Printf("Daily stats of user %v are out of date: %v\n", userID.Hex(), err)
+		}
+	}
+
 	res := utils.NewHttpResponse(http.StatusOK, updatedUser)
 	ctx.JSON(http.StatusOK, res)
 }
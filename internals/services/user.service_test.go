@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	errors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fakeIdentityProvider struct {
+	createErr error
+	deleteErr error
+	created   []string
+	deleted   []string
+}
+
+func (fp *fakeIdentityProvider) CreateUser(email, password, firstName, lastName string) (string, error) {
+	if fp.createErr != nil {
+		return "", fp.createErr
+	}
+	uid := "uid_" + email
+	fp.created = append(fp.created, uid)
+	return uid, nil
+}
+
+func (fp *fakeIdentityProvider) DeleteUser(uid string) error {
+	if fp.deleteErr != nil {
+		return fp.deleteErr
+	}
+	fp.deleted = append(fp.deleted, uid)
+	return nil
+}
+
+type fakeUserController struct {
+	controllers.IUserController
+	users     []*models.User
+	lookupErr error
+	createErr error
+	deleteErr error
+}
+
+func (fc *fakeUserController) GetUserByEmail(email string) (*models.User, error) {
+	if fc.lookupErr != nil {
+		return nil, fc.lookupErr
+	}
+	for _, user := range fc.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+}
+
+func (fc *fakeUserController) GetUserByFirebaseUID(uid string) (*models.User, error) {
+	if fc.lookupErr != nil {
+		return nil, fc.lookupErr
+	}
+	for _, user := range fc.users {
+		if user.FirebaseUID == uid {
+			return user, nil
+		}
+	}
+	return nil, errors.Wrap(mongo.ErrNoDocuments, "Error in FindOne")
+}
+
+func (fc *fakeUserController) UpdateUser(id primitive.ObjectID, update *models.User) error {
+	user, err := fc.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if update.Email != "" {
+		user.Email = update.Email
+	}
+	if update.Timezone != "" {
+		user.Timezone = update.Timezone
+	}
+	return nil
+}
+
+func (fc *fakeUserController) CreateUser(user *models.User) (*models.User, error) {
+	if fc.createErr != nil {
+		return nil, fc.createErr
+	}
+	user.ID = primitive.NewObjectID()
+	fc.users = append(fc.users, user)
+	return user, nil
+}
+
+func TestSignUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	valid := map[string]string{
+		"email":     "test_email@test.com",
+		"password":  "password_1",
+		"firstName": "first_name",
+		"lastName":  "last_name",
+	}
+	existing := &models.User{Email: "taken@test.com"}
+	linked := &models.User{Email: "linked@test.com", FirebaseUID: "uid_client"}
+	clientSignUp := map[string]string{"email": "test_email@test.com", "firstName": "first_name"}
+
+	cases := []struct {
+		name           string
+		body           map[string]string
+		tokenUID       string
+		verifiedEmail  string
+		provider       *fakeIdentityProvider
+		controller     *fakeUserController
+		wantStatus     int
+		wantCreated    int
+		wantDeleted    int
+		wantPersisted  int
+		wantMessageHas string
+	}{
+		{
+			name:       "success",
+			body:       valid,
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusOK, wantCreated: 1, wantPersisted: 1,
+		},
+		{
+			name:     "client created identity",
+			body:     clientSignUp,
+			tokenUID: "uid_client", verifiedEmail: "Test_Email@test.com",
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusOK, wantPersisted: 1,
+		},
+		{
+			name:     "client created identity of another email",
+			body:     clientSignUp,
+			tokenUID: "uid_client", verifiedEmail: "attacker@test.com",
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "client created identity with unverified email",
+			body:       clientSignUp,
+			tokenUID:   "uid_client",
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "client created identity already signed up",
+			body:     clientSignUp,
+			tokenUID: "uid_client", verifiedEmail: "test_email@test.com",
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{users: []*models.User{linked}},
+			wantStatus: http.StatusConflict, wantPersisted: 1,
+		},
+		{
+			name:       "uid in the body is ignored",
+			body:       map[string]string{"email": "test_email@test.com", "password": "password_1", "firstName": "first_name", "firebaseUID": "uid_client"},
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusOK, wantCreated: 1, wantPersisted: 1,
+		},
+		{
+			name:       "invalid email",
+			body:       map[string]string{"email": "not-an-email", "password": "password_1", "firstName": "first_name"},
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "short password",
+			body:       map[string]string{"email": "test_email@test.com", "password": "123", "firstName": "first_name"},
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "existing email",
+			body:       map[string]string{"email": "taken@test.com", "password": "password_1", "firstName": "first_name"},
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{users: []*models.User{existing}},
+			wantStatus: http.StatusConflict, wantPersisted: 1,
+		},
+		{
+			name:       "lookup fails",
+			body:       valid,
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{lookupErr: errors.New("connection refused")},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "identity creation fails",
+			body:       valid,
+			provider:   &fakeIdentityProvider{createErr: errors.New("email exists in firebase")},
+			controller: &fakeUserController{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "persistence fails",
+			body:       valid,
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{createErr: errors.New("insert failed")},
+			wantStatus: http.StatusBadRequest, wantCreated: 1, wantDeleted: 1,
+		},
+		{
+			name:       "persistence and rollback fail",
+			body:       valid,
+			provider:   &fakeIdentityProvider{deleteErr: errors.New("firebase unavailable")},
+			controller: &fakeUserController{createErr: errors.New("insert failed")},
+			wantStatus: http.StatusBadRequest, wantCreated: 1, wantMessageHas: "firebase unavailable",
+		},
+		{
+			name:     "persistence fails for client created identity",
+			body:     clientSignUp,
+			tokenUID: "uid_client", verifiedEmail: "test_email@test.com",
+			provider:   &fakeIdentityProvider{},
+			controller: &fakeUserController{createErr: errors.New("insert failed")},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		router := gin.New()
+		router.POST("/signup", func(ctx *gin.Context) {
+			if c.tokenUID != "" {
+				ctx.Set("firebaseUid", c.tokenUID)
+			}
+			if c.verifiedEmail != "" {
+				ctx.Set("verifiedEmail", c.verifiedEmail)
+			}
+		}, NewUserService(c.controller, &fakeDailyStatsService{}, c.provider).SignUp)
+
+		body, _ := json.Marshal(c.body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/signup", bytes.NewReader(body)))
+
+		// a second response would be appended to the body and break decoding
+		var res struct {
+			StatusCode int    `json:"status_code"`
+			Message    string `json:"message"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Errorf("TestSignUp %v: expected exactly one response, got %v", c.name, w.Body.String())
+			continue
+		}
+		if w.Code != c.wantStatus || res.StatusCode != c.wantStatus {
+			t.Errorf("TestSignUp %v: expected status %v, got %v (%v)", c.name, c.wantStatus, w.Code, res.Message)
+		}
+		if len(c.provider.created) != c.wantCreated {
+			t.Errorf("TestSignUp %v: expected %v identities created, got %v", c.name, c.wantCreated, len(c.provider.created))
+		}
+		if len(c.provider.deleted) != c.wantDeleted {
+			t.Errorf("TestSignUp %v: expected %v identities deleted, got %v", c.name, c.wantDeleted, len(c.provider.deleted))
+		}
+		if len(c.controller.users) != c.wantPersisted {
+			t.Errorf("TestSignUp %v: expected %v users persisted, got %v", c.name, c.wantPersisted, len(c.controller.users))
+		}
+		if c.wantMessageHas != "" && !strings.Contains(res.Message, c.wantMessageHas) {
+			t.Errorf("TestSignUp %v: expected message to contain %q, got %q", c.name, c.wantMessageHas, res.Message)
+		}
+	}
+}
+
+func TestUpdateUserOfOtherUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := &models.User{ID: primitive.NewObjectID(), Email: "test_email@test.com", Timezone: "UTC"}
+	other := &models.User{ID: primitive.NewObjectID(), Email: "other@test.com", Timezone: "UTC"}
+
+	cases := []struct {
+		name        string
+		userID      primitive.ObjectID
+		role        guard.Role
+		accessToken bool
+		wantStatus  int
+	}{
+		{"self", user.ID, guard.User, false, http.StatusOK},
+		{"other user", other.ID, guard.User, false, http.StatusForbidden},
+		{"admin", other.ID, guard.Admin, false, http.StatusOK},
+		{"admin access token", other.ID, guard.Admin, true, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		user.Timezone = "UTC"
+		controller := &fakeUserController{users: []*models.User{user, other}}
+		dailyStats := &fakeDailyStatsService{}
+		router := gin.New()
+		router.PUT("/users/:id", func(ctx *gin.Context) {
+			ctx.Set("id", c.userID)
+			ctx.Set("role", c.role)
+			if c.accessToken {
+				ctx.Set("accessToken", &models.AccessToken{CreatedBy: c.userID})
+			}
+		}, NewUserService(controller, dailyStats, &fakeIdentityProvider{}).UpdateUser)
+
+		body, _ := json.Marshal(map[string]string{"timezone": "Asia/Tokyo"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/"+user.ID.Hex(), bytes.NewReader(body)))
+
+		if w.Code != c.wantStatus {
+			t.Errorf("TestUpdateUserOfOtherUser %v: expected status %v, got %v", c.name, c.wantStatus, w.Code)
+		}
+		changed := w.Code == http.StatusOK
+		if (user.Timezone == "Asia/Tokyo") != changed || (len(dailyStats.rebuilt) == 1) != changed {
+			t.Errorf("TestUpdateUserOfOtherUser %v: expected changes %v, got timezone %v and %v rebuilds", c.name, changed, user.Timezone, len(dailyStats.rebuilt))
+		}
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name          string
+		email         string
+		verifiedEmail string
+		role          guard.Role
+		self          bool
+		wantStatus    int
+		wantEmail     string
+	}{
+		{"verified", "new@test.com", "new@test.com", guard.User, true, http.StatusOK, "new@test.com"},
+		{"unverified", "new@test.com", "", guard.User, true, http.StatusForbidden, "test_email@test.com"},
+		{"another verified email", "new@test.com", "test_email@test.com", guard.User, true, http.StatusForbidden, "test_email@test.com"},
+		{"admin", "new@test.com", "new@test.com", guard.Admin, false, http.StatusForbidden, "test_email@test.com"},
+		{"unchanged", "TEST_EMAIL@test.com", "", guard.User, true, http.StatusOK, "TEST_EMAIL@test.com"},
+	}
+
+	for _, c := range cases {
+		user := &models.User{ID: primitive.NewObjectID(), Email: "test_email@test.com"}
+		admin := &models.User{ID: primitive.NewObjectID(), Email: "admin@test.com"}
+		callerID := user.ID
+		if !c.self {
+			callerID = admin.ID
+		}
+		controller := &fakeUserController{users: []*models.User{user, admin}}
+		router := gin.New()
+		router.PUT("/users/:id", func(ctx *gin.Context) {
+			ctx.Set("id", callerID)
+			ctx.Set("role", c.role)
+			if c.verifiedEmail != "" {
+				ctx.Set("verifiedEmail", c.verifiedEmail)
+			}
+		}, NewUserService(controller, &fakeDailyStatsService{}, &fakeIdentityProvider{}).UpdateUser)
+
+		body, _ := json.Marshal(map[string]string{"email": c.email})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/"+user.ID.Hex(), bytes.NewReader(body)))
+
+		if w.Code != c.wantStatus || user.Email != c.wantEmail {
+			t.Errorf("TestUpdateUserEmail %v: expected status %v and email %v, got %v and %v", c.name, c.wantStatus, c.wantEmail, w.Code, user.Email)
+		}
+	}
+}
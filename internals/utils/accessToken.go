@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// ACCESS_TOKEN_PREFIX tells personal access tokens apart from ID tokens.
+const ACCESS_TOKEN_PREFIX = "pat_"
+
+// GenerateAccessToken returns a new random personal access token and the
+// hash it is stored under. The plain token is only ever shown once.
+func GenerateAccessToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := ACCESS_TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAccessToken(token), nil
+}
+
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, ACCESS_TOKEN_PREFIX)
+}
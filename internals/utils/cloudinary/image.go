@@ -0,0 +1,32 @@
+package cloudinary
+
+import (
+	"context"
+	"os"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	errors "github.com/pkg/errors"
+)
+
+// ImageStore exposes the cloudinary image functions to services.
+type ImageStore struct{}
+
+// DeleteImage treats an already deleted image as success, so callers can retry.
+func (ImageStore) DeleteImage(publicID string) error {
+	cld, err := cloudinary.NewFromParams(string(os.Getenv("CLOUDINARY_CLOUD_NAME")), string(os.Getenv("CLOUDINARY_API_KEY")), string(os.Getenv("CLOUDINARY_API_SECRET")))
+	if err != nil {
+		return errors.Wrap(err, "Error in configuring cloudinary")
+	}
+	resp, err := cld.Upload.Destroy(context.Background(), uploader.DestroyParams{PublicID: publicID})
+	if err != nil {
+		return errors.Wrap(err, "Error in deleting image")
+	}
+	if resp.Error.Message != "" {
+		return errors.New(resp.Error.Message)
+	}
+	if resp.Result != "ok" && resp.Result != "not found" {
+		return errors.Errorf("unexpected result %q deleting image %v", resp.Result, publicID)
+	}
+	return nil
+}
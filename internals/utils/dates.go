@@ -0,0 +1,21 @@
+package utils
+
+import "time"
+
+// StartOfDay returns midnight of the day t falls on in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// StartOfWeek returns midnight of the Monday of the week t falls on in loc.
+// Days are counted with AddDate, so weeks spanning a DST change stay aligned
+// to local midnight.
+func StartOfWeek(t time.Time, loc *time.Location) time.Time {
+	today := StartOfDay(t, loc)
+	weekday := int(today.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	return today.AddDate(0, 0, -(weekday - 1))
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %v: %v", name, err)
+	}
+	return loc
+}
+
+func TestStartOfDay(t *testing.T) {
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	cases := []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{
+			// 8am in Tokyo is still the previous day in UTC
+			name: "tokyo morning",
+			now:  time.Date(2023, 1, 10, 23, 0, 0, 0, time.UTC),
+			loc:  tokyo,
+			want: time.Date(2023, 1, 10, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "utc",
+			now:  time.Date(2023, 1, 10, 23, 0, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// the day DST starts has 23 hours, midnight is still EST
+			name: "new york spring forward",
+			now:  time.Date(2023, 3, 12, 20, 0, 0, 0, time.UTC),
+			loc:  newYork,
+			want: time.Date(2023, 3, 12, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			// the day DST ends has 25 hours, midnight is still EDT
+			name: "new york fall back",
+			now:  time.Date(2023, 11, 5, 23, 0, 0, 0, time.UTC),
+			loc:  newYork,
+			want: time.Date(2023, 11, 5, 4, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		if got := StartOfDay(c.now, c.loc); !got.Equal(c.want) {
+			t.Errorf("TestStartOfDay %v: expected %v, got %v", c.name, c.want, got.UTC())
+		}
+	}
+
+	// the previous day across the DST change starts 23 hours earlier
+	if got := StartOfDay(time.Date(2023, 3, 13, 12, 0, 0, 0, time.UTC), newYork).AddDate(0, 0, -1); !got.Equal(time.Date(2023, 3, 12, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("TestStartOfDay: expected previous local midnight, got %v", got.UTC())
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+
+	cases := []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{
+			// Monday 8am in Tokyo, Sunday in UTC
+			name: "tokyo monday morning",
+			now:  time.Date(2023, 1, 15, 23, 0, 0, 0, time.UTC),
+			loc:  tokyo,
+			want: time.Date(2023, 1, 15, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "sunday",
+			now:  time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: time.Date(2023, 1, 9, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// Monday is still CET although DST started on Sunday
+			name: "berlin week with dst start",
+			now:  time.Date(2023, 3, 26, 20, 0, 0, 0, time.UTC),
+			loc:  berlin,
+			want: time.Date(2023, 3, 19, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "berlin week after dst end",
+			now:  time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC),
+			loc:  berlin,
+			want: time.Date(2023, 10, 29, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		if got := StartOfWeek(c.now, c.loc); !got.Equal(c.want) {
+			t.Errorf("TestStartOfWeek %v: expected %v, got %v", c.name, c.want, got.UTC())
+		}
+	}
+}
@@ -72,6 +72,21 @@ func DeleteUserInFirebase(uid string) error {
 	return nil
 }
 
+// IdentityProvider exposes the firebase user functions to services.
+type IdentityProvider struct{}
+
+func (IdentityProvider) CreateUser(email, password, firstName, lastName string) (string, error) {
+	return CreateUserInFirebase(email, password, firstName, lastName)
+}
+
+// DeleteUser treats an already deleted user as success, so callers can retry.
+func (IdentityProvider) DeleteUser(uid string) error {
+	if err := Client.DeleteUser(ctx, uid); err != nil && !auth.IsUserNotFound(err) {
+		return errors.Wrap(err, "Error deleting user in firebase")
+	}
+	return nil
+}
+
 func DeleteAllUsersInFirebase() error {
 	iter := Client.Users(ctx, "")
 	for {
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"idea-training-version-go/internals/guard"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,3 +19,60 @@ func FetchUserFromCtx(ctx *gin.Context) primitive.ObjectID {
 	}
 	return userId
 }
+
+func FetchRoleFromCtx(ctx *gin.Context) guard.Role {
+	role, ok := ctx.Get("role")
+	if !ok {
+		return ""
+	}
+	r, _ := role.(guard.Role)
+	return r
+}
+
+// CanActForAnyUserFromCtx reports whether the logged in user may use
+// permission on the data of other users. Personal access tokens only ever
+// act as their owner, whatever the owner's role, so a leaked token can not
+// reach other accounts.
+func CanActForAnyUserFromCtx(ctx *gin.Context, permission guard.Permission) bool {
+	if _, ok := ctx.Get("accessToken"); ok {
+		return false
+	}
+	return FetchRoleFromCtx(ctx).Can(permission)
+}
+
+// FetchTokenUIDFromCtx returns the identity provider UID of the verified ID
+// token of the request, empty without one.
+func FetchTokenUIDFromCtx(ctx *gin.Context) string {
+	uid, _ := ctx.Get("firebaseUid")
+	s, _ := uid.(string)
+	return s
+}
+
+// FetchVerifiedEmailFromCtx returns the email of the verified ID token of
+// the request if the identity provider verified it, empty otherwise.
+func FetchVerifiedEmailFromCtx(ctx *gin.Context) string {
+	email, _ := ctx.Get("verifiedEmail")
+	s, _ := email.(string)
+	return s
+}
+
+// FetchLocationFromCtx returns the time zone of the logged in user, falling
+// back to UTC for users without a valid one.
+func FetchLocationFromCtx(ctx *gin.Context) *time.Location {
+	timezone, _ := ctx.Get("timezone")
+	name, _ := timezone.(string)
+	return LoadLocation(name)
+}
+
+// LoadLocation returns the time zone of a user, UTC if name is empty or
+// invalid.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
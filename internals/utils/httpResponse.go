@@ -18,6 +18,8 @@ func NewHttpResponse(statusCode int, data interface{}) HTTPResponse {
 		http.StatusInternalServerError,
 		http.StatusUnauthorized,
 		http.StatusForbidden,
+		http.StatusConflict,
+		http.StatusGone,
 		http.StatusRequestTimeout:
 
 		if e, ok := data.(error); ok {
@@ -7,9 +7,13 @@ import (
 	"idea-training-version-go/internals/middleware"
 	"idea-training-version-go/internals/routes"
 	"idea-training-version-go/internals/services"
+	"idea-training-version-go/internals/utils/cloudinary"
+	"idea-training-version-go/internals/utils/firebase"
 	"log"
 	"os"
 	"time"
+	// the production image has no zoneinfo for user time zones
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,18 +23,47 @@ import (
 )
 
 var (
-	server         *gin.Engine
-	usercollection *mongo.Collection
-	ideacollection *mongo.Collection
-	usercontroller controllers.IUserController
-	ideacontroller controllers.IIdeaController
-	userservice    services.IUserService
-	ideaservice    services.IIdeaService
-	requireauth    middleware.RequireAuth
-	userroute      routes.UserRoutes
-	idearoute      routes.IdeaRoutes
-	ctx            context.Context
-	err            error
+	server             *gin.Engine
+	usercollection     *mongo.Collection
+	ideacollection     *mongo.Collection
+	sessioncollection  *mongo.Collection
+	statscollection    *mongo.Collection
+	badgecollection    *mongo.Collection
+	categorycollection *mongo.Collection
+	searchcollection   *mongo.Collection
+	tombcollection     *mongo.Collection
+	seqcollection      *mongo.Collection
+	tokencollection    *mongo.Collection
+	receiptcollection  *mongo.Collection
+	usercontroller     controllers.IUserController
+	ideacontroller     controllers.IIdeaController
+	sessioncontroller  controllers.ISessionController
+	statscontroller    controllers.IDailyStatsController
+	badgecontroller    controllers.IBadgeController
+	categorycontroller controllers.ICategoryController
+	searchcontroller   controllers.ISavedSearchController
+	tokencontroller    controllers.IAccessTokenController
+	receiptcontroller  controllers.IDeletionReceiptController
+	userservice        services.IUserService
+	ideaservice        services.IIdeaService
+	dailystatsservice  services.IDailyStatsService
+	sessionservice     services.ISessionService
+	adminservice       services.IAdminService
+	tokenservice       services.IAccessTokenService
+	accountservice     services.IAccountService
+	achievementservice services.IAchievementService
+	categoryservice    services.ICategoryService
+	searchservice      services.ISavedSearchService
+	tokenverifier      middleware.TokenVerifier
+	requireauth        middleware.RequireAuth
+	userroute          routes.UserRoutes
+	idearoute          routes.IdeaRoutes
+	sessionroute       routes.SessionRoutes
+	categoryroute      routes.CategoryRoutes
+	searchroute        routes.SavedSearchRoutes
+	adminroute         routes.AdminRoutes
+	ctx                context.Context
+	err                error
 )
 
 func init() {
@@ -44,17 +77,85 @@ func init() {
 	// collections
 	usercollection = db.MongoDB.Database("60s-idea-trainings").Collection("users")
 	ideacollection = db.MongoDB.Database("60s-idea-trainings").Collection("idearecords")
+	sessioncollection = db.MongoDB.Database("60s-idea-trainings").Collection("sessions")
+	statscollection = db.MongoDB.Database("60s-idea-trainings").Collection("daily_stats")
+	badgecollection = db.MongoDB.Database("60s-idea-trainings").Collection("badges")
+	categorycollection = db.MongoDB.Database("60s-idea-trainings").Collection("categories")
+	searchcollection = db.MongoDB.Database("60s-idea-trainings").Collection("savedsearches")
+	tombcollection = db.MongoDB.Database("60s-idea-trainings").Collection("tombstones")
+	seqcollection = db.MongoDB.Database("60s-idea-trainings").Collection("syncsequences")
+	tokencollection = db.MongoDB.Database("60s-idea-trainings").Collection("accesstokens")
+	receiptcollection = db.MongoDB.Database("60s-idea-trainings").Collection("deletionreceipts")
 	// controllers
 	usercontroller = controllers.NewUserController(usercollection, ctx)
-	ideacontroller = controllers.NewIdeaController(ideacollection, ctx)
+	ideacontroller = controllers.NewIdeaController(ideacollection, tombcollection, seqcollection, statscollection, ctx)
+	sessioncontroller = controllers.NewSessionController(sessioncollection, ctx)
+	statscontroller = controllers.NewDailyStatsController(statscollection, ctx)
+	badgecontroller = controllers.NewBadgeController(badgecollection, ctx)
+	categorycontroller = controllers.NewCategoryController(categorycollection, ideacollection, seqcollection, statscollection, ctx)
+	searchcontroller = controllers.NewSavedSearchController(searchcollection, ctx)
+	tokencontroller = controllers.NewAccessTokenController(tokencollection, ctx)
+	receiptcontroller = controllers.NewDeletionReceiptController(receiptcollection, ctx)
+	if err = usercontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = ideacontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = sessioncontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = statscontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = badgecontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = categorycontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = searchcontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = tokencontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = receiptcontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
 	// services
-	userservice = services.NewUserService(usercontroller)
-	ideaservice = services.NewIdeaService(ideacontroller)
+	dailystatsservice = services.NewDailyStatsService(usercontroller, ideacontroller)
+	userservice = services.NewUserService(usercontroller, dailystatsservice, firebase.IdentityProvider{})
+	categoryservice = services.NewCategoryService(categorycontroller, ideacontroller)
+	ideaservice = services.NewIdeaService(ideacontroller, statscontroller, dailystatsservice, categoryservice)
+	searchservice = services.NewSavedSearchService(searchcontroller, ideaservice)
+	sessionservice = services.NewSessionService(sessioncontroller, ideacontroller, dailystatsservice, categoryservice, sessionConfig())
+	adminservice = services.NewAdminService(usercontroller, ideacontroller)
+	tokenservice = services.NewAccessTokenService(tokencontroller)
+	achievementservice = services.NewAchievementService(usercontroller, statscontroller, badgecontroller, categorycontroller)
+	dailystatsservice.OnIdeaCreated(achievementservice.AwardBadges)
+	accountservice = services.NewAccountService(usercontroller, ideacontroller, sessioncontroller, statscontroller, badgecontroller, categorycontroller, searchcontroller, tokencontroller, receiptcontroller, firebase.IdentityProvider{}, cloudinary.ImageStore{})
+	// token verifier
+	switch {
+	case os.Getenv("STAGE") == "test":
+		tokenverifier = middleware.NewHMACVerifier(os.Getenv("JWT_SECRET"))
+	case os.Getenv("AUTH_JWKS_URL") != "":
+		tokenverifier = jwksVerifier(os.Getenv("AUTH_JWKS_URL"))
+	case os.Getenv("AUTH_JWKS_FILE") != "":
+		tokenverifier = jwksVerifier(os.Getenv("AUTH_JWKS_FILE"))
+	default:
+		tokenverifier = middleware.NewFirebaseVerifier(firebase.Client)
+	}
 	// middleware
-	requireauth = middleware.NewRequireAuth(usercontroller)
+	requireauth = middleware.NewRequireAuth(usercontroller, tokencontroller, tokenverifier)
+	requireauth.ProvisionUsers = os.Getenv("AUTH_PROVISION_USERS") == "true"
 	// routes
-	userroute = routes.NewUserRoutes(userservice, requireauth)
+	userroute = routes.NewUserRoutes(userservice, tokenservice, accountservice, achievementservice, requireauth)
 	idearoute = routes.NewIdeaRoutes(ideaservice, requireauth)
+	sessionroute = routes.NewSessionRoutes(sessionservice, requireauth)
+	categoryroute = routes.NewCategoryRoutes(categoryservice, requireauth)
+	searchroute = routes.NewSavedSearchRoutes(searchservice, requireauth)
+	adminroute = routes.NewAdminRoutes(adminservice, requireauth)
 
 	server = gin.Default()
 	// CORS
@@ -68,12 +169,53 @@ func init() {
 	}))
 }
 
+// sessionConfig reads the session timing from SESSION_TIME_LIMIT and
+// SESSION_GRACE_PERIOD (durations like "60s") and SESSION_LATE_IDEAS
+// ("reject" or "flag"). Unset values fall back to the service defaults.
+func sessionConfig() services.SessionConfig {
+	config := services.SessionConfig{
+		GracePeriod: services.DEFAULT_SESSION_GRACE_PERIOD,
+		RejectLate:  os.Getenv("SESSION_LATE_IDEAS") == "reject",
+	}
+	if limit := os.Getenv("SESSION_TIME_LIMIT"); limit != "" {
+		timeLimit, err := time.ParseDuration(limit)
+		if err != nil {
+			log.Println("Invalid SESSION_TIME_LIMIT", err)
+		}
+		config.TimeLimit = timeLimit
+	}
+	if grace := os.Getenv("SESSION_GRACE_PERIOD"); grace != "" {
+		gracePeriod, err := time.ParseDuration(grace)
+		if err != nil {
+			log.Println("Invalid SESSION_GRACE_PERIOD", err)
+		} else {
+			config.GracePeriod = gracePeriod
+		}
+	}
+	return config
+}
+
+// jwksVerifier verifies tokens with the keys at source. AUTH_AUDIENCE is
+// required, as without it the tokens issued for any other client of the
+// identity provider would be accepted.
+func jwksVerifier(source string) middleware.TokenVerifier {
+	audience := os.Getenv("AUTH_AUDIENCE")
+	if audience == "" {
+		log.Fatalln("AUTH_AUDIENCE is required to verify tokens with a JWKS")
+	}
+	return middleware.NewJWKSVerifier(source, os.Getenv("AUTH_ISSUER"), audience)
+}
+
 func main() {
 	defer db.MongoDB.Disconnect(ctx)
 	// setup routes
 	basepath := server.Group("/api")
 	userroute.UserRoutes(basepath)
 	idearoute.IdeaRoutes(basepath)
+	sessionroute.SessionRoutes(basepath)
+	categoryroute.CategoryRoutes(basepath)
+	searchroute.SavedSearchRoutes(basepath)
+	adminroute.AdminRoutes(basepath)
 	routes.UtilsRoutes(basepath)
 
 	log.Fatalln(server.Run(":" + os.Getenv("PORT")))
@@ -0,0 +1,264 @@
+package test
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/guard"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"testing"
+
+	unitTest "github.com/Valiben/gin_unit_test"
+	"github.com/Valiben/gin_unit_test/utils"
+	paginate "github.com/gobeam/mongo-go-pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddAdminAuthHeader() (*models.User, error) {
+	admin, err := AddAuthHeaderFor("test_email1@test.com")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := usercollection.UpdateByID(ctx, admin.ID, bson.M{"$set": bson.M{"role": guard.Admin}}); err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+func getSampleUser(email string) (*models.User, error) {
+	var user models.User
+	if err := usercollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func TestListUsersAsUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int    `json:"status_code"`
+		Success    bool   `json:"success"`
+		Message    string `json:"message"`
+	}
+	var res HTTPResponse
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestListUsersAsUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/admin/users", "json", nil, &res); err != nil {
+		t.Errorf("TestListUsersAsUser: %v\n", err)
+		return
+	}
+
+	if res.Success || res.StatusCode != http.StatusForbidden {
+		t.Errorf("TestListUsersAsUser: expected status %v, got %v\n", http.StatusForbidden, res.StatusCode)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestListUsers(t *testing.T) {
+	type ResponseBody struct {
+		Users        []models.User           `json:"users"`
+		PaginateData *paginate.PaginatedData `json:"paginateData"`
+	}
+	type HTTPResponse struct {
+		StatusCode int          `json:"status_code"`
+		Success    bool         `json:"success"`
+		Message    string       `json:"message"`
+		Data       ResponseBody `json:"data"`
+	}
+	var res HTTPResponse
+
+	if _, err := AddAdminAuthHeader(); err != nil {
+		t.Errorf("TestListUsers: Fails to add auth header %v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/admin/users?email=TEST_EMAIL2@&pageSize=5", "json", nil, &res); err != nil {
+		t.Errorf("TestListUsers: %v\n", err)
+		return
+	}
+
+	if !res.Success {
+		t.Errorf("TestListUsers: %v\n", res.Message)
+		return
+	}
+
+	if len(res.Data.Users) != 1 || res.Data.Users[0].Email != "test_email2@test.com" {
+		t.Errorf("TestListUsers: expected only %v, got %v\n", "test_email2@test.com", res.Data.Users)
+		return
+	}
+
+	if res.Data.PaginateData.Pagination.PerPage != 5 {
+		t.Errorf("TestListUsers: expected per page %v, got %v\n", 5, res.Data.PaginateData.Pagination.PerPage)
+		return
+	}
+
+	for _, query := range []string{"current=0", "current=-1", "pageSize=0", fmt.Sprintf("pageSize=%v", models.MAX_PAGE_LIMIT+1)} {
+		res = HTTPResponse{}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/admin/users?"+query, "json", nil, &res); err != nil {
+			t.Errorf("TestListUsers: %v\n", err)
+			return
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("TestListUsers: expected status %v for %v, got %v\n", http.StatusBadRequest, query, res.StatusCode)
+		}
+	}
+
+	t.Log("passed")
+}
+
+func TestGetUserSummary(t *testing.T) {
+	type ResponseBody struct {
+		User                models.User   `json:"user"`
+		TotalIdeasOfAllTime []primitive.M `json:"totalIdeasOfAllTime"`
+	}
+	type HTTPResponse struct {
+		StatusCode int          `json:"status_code"`
+		Success    bool         `json:"success"`
+		Message    string       `json:"message"`
+		Data       ResponseBody `json:"data"`
+	}
+	var res HTTPResponse
+
+	if _, err := AddAdminAuthHeader(); err != nil {
+		t.Errorf("TestGetUserSummary: Fails to add auth header %v\n", err)
+		return
+	}
+
+	user, err := getSampleUser("test_email100@test.com")
+	if err != nil {
+		t.Errorf("TestGetUserSummary: Failed to get sample user data...%v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, fmt.Sprintf("/api/admin/users/%v", user.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestGetUserSummary: %v\n", err)
+		return
+	}
+
+	if !res.Success {
+		t.Errorf("TestGetUserSummary: %v\n", res.Message)
+		return
+	}
+
+	if res.Data.User.ID != user.ID {
+		t.Errorf("TestGetUserSummary: expected user %v, got %v\n", user.ID, res.Data.User.ID)
+		return
+	}
+
+	if len(res.Data.TotalIdeasOfAllTime) != 1 {
+		t.Errorf("TestGetUserSummary: expected totals, got %v\n", res.Data.TotalIdeasOfAllTime)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	type RoleParams struct {
+		Role guard.Role `json:"role"`
+	}
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.User `json:"data"`
+	}
+	var res HTTPResponse
+
+	if _, err := AddAdminAuthHeader(); err != nil {
+		t.Errorf("TestUpdateUserRole: Fails to add auth header %v\n", err)
+		return
+	}
+
+	user, err := getSampleUser("test_email3@test.com")
+	if err != nil {
+		t.Errorf("TestUpdateUserRole: Failed to get sample user data...%v\n", err)
+		return
+	}
+	defer usercollection.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"role": guard.User}})
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/admin/users/%v/role", user.ID.Hex()), "json", RoleParams{Role: guard.Admin}, &res); err != nil {
+		t.Errorf("TestUpdateUserRole: %v\n", err)
+		return
+	}
+
+	if !res.Success {
+		t.Errorf("TestUpdateUserRole: %v\n", res.Message)
+		return
+	}
+
+	if res.Data.Role != guard.Admin {
+		t.Errorf("TestUpdateUserRole: expected role %v, got %v\n", guard.Admin, res.Data.Role)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestSuspendUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.User `json:"data"`
+	}
+	var res HTTPResponse
+
+	if _, err := AddAdminAuthHeader(); err != nil {
+		t.Errorf("TestSuspendUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	user, err := getSampleUser("test_email4@test.com")
+	if err != nil {
+		t.Errorf("TestSuspendUser: Failed to get sample user data...%v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/admin/users/%v/suspend", user.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestSuspendUser: %v\n", err)
+		return
+	}
+
+	if !res.Success || res.Data.Suspended == nil || !*res.Data.Suspended {
+		t.Errorf("TestSuspendUser: expected suspended user, got %v\n", res)
+		return
+	}
+
+	// suspended users are rejected by AllowIfLogIn
+	if _, err := AddAuthHeaderFor(user.Email); err != nil {
+		t.Errorf("TestSuspendUser: Fails to add auth header %v\n", err)
+		return
+	}
+	res = HTTPResponse{}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/", "json", nil, &res); err != nil {
+		t.Errorf("TestSuspendUser: %v\n", err)
+		return
+	}
+	if res.Success || res.StatusCode != http.StatusForbidden {
+		t.Errorf("TestSuspendUser: expected status %v, got %v\n", http.StatusForbidden, res.StatusCode)
+		return
+	}
+
+	if _, err := AddAdminAuthHeader(); err != nil {
+		t.Errorf("TestSuspendUser: Fails to add auth header %v\n", err)
+		return
+	}
+	res = HTTPResponse{}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/admin/users/%v/unsuspend", user.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestSuspendUser: %v\n", err)
+		return
+	}
+
+	if !res.Success || res.Data.Suspended == nil || *res.Data.Suspended {
+		t.Errorf("TestSuspendUser: expected unsuspended user, got %v\n", res)
+		return
+	}
+
+	t.Log("passed")
+}
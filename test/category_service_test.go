@@ -0,0 +1,173 @@
+package test
+
+import (
+	"fmt"
+	"idea-training-version-go/internals/models"
+	"net/http"
+	"testing"
+	"time"
+
+	unitTest "github.com/Valiben/gin_unit_test"
+	"github.com/Valiben/gin_unit_test/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddCategories adds the names to the category catalogue of the user of the
+// auth header, skipping the ones already in it.
+func AddCategories(names ...string) error {
+	for _, name := range names {
+		var res struct {
+			StatusCode int    `json:"status_code"`
+			Message    string `json:"message"`
+		}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/categories/", "json", map[string]string{"name": name}, &res); err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusConflict {
+			return fmt.Errorf("adding category %q failed with %v: %v", name, res.StatusCode, res.Message)
+		}
+	}
+	return nil
+}
+
+func TestCategories(t *testing.T) {
+	type CategoriesResponse struct {
+		StatusCode int                `json:"status_code"`
+		Data       []*models.Category `json:"data"`
+	}
+	type CategoryResponse struct {
+		StatusCode int             `json:"status_code"`
+		Data       models.Category `json:"data"`
+	}
+	type ChangeResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Category   models.Category `json:"category"`
+			MovedIdeas int64           `json:"movedIdeas"`
+		} `json:"data"`
+	}
+	type IdeaResponse struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Category   string   `json:"category"`
+		Ideas      []string `json:"ideas"`
+	}
+
+	user, err := AddAuthHeader()
+	if err != nil {
+		t.Errorf("TestCategories: Fails to add auth header %v\n", err)
+		return
+	}
+
+	// the catalogue starts with the default categories
+	var categories CategoriesResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/categories/", "json", nil, &categories); err != nil || categories.StatusCode != http.StatusOK {
+		t.Errorf("TestCategories: expected categories, got %v %v\n", categories.StatusCode, err)
+		return
+	}
+	names := map[string]bool{}
+	for _, category := range categories.Data {
+		names[category.Name] = true
+	}
+	for _, name := range models.DEFAULT_CATEGORIES {
+		if !names[name] {
+			t.Errorf("TestCategories: expected default category %v, got %v\n", name, names)
+		}
+	}
+
+	var created CategoryResponse
+	params := map[string]string{"name": " test_catalogue_work ", "color": "#FFAA00", "icon": "briefcase"}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/categories/", "json", params, &created); err != nil || created.StatusCode != http.StatusCreated {
+		t.Errorf("TestCategories: expected category to be created, got %v %v\n", created.StatusCode, err)
+		return
+	}
+	if created.Data.Name != "test_catalogue_work" || created.Data.Color != "#ffaa00" {
+		t.Errorf("TestCategories: expected normalized category, got %+v\n", created.Data)
+	}
+	var duplicate CategoryResponse
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/categories/", "json", map[string]string{"name": "TEST_CATALOGUE_WORK"}, &duplicate)
+	if duplicate.StatusCode != http.StatusConflict {
+		t.Errorf("TestCategories: expected status %v for a duplicate, got %v\n", http.StatusConflict, duplicate.StatusCode)
+	}
+
+	// ideas are filed under the catalogue spelling and unknown categories
+	// are rejected
+	var idea IdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", IdeaParams{TopicTitle: "test_catalogue_topic", Category: "Test_Catalogue_Work", Ideas: []string{"idea_1"}}, &idea); err != nil || idea.StatusCode != http.StatusCreated {
+		t.Errorf("TestCategories: expected idea to be created, got %v %v\n", idea.StatusCode, err)
+		return
+	}
+	if idea.Data.Category != "test_catalogue_work" {
+		t.Errorf("TestCategories: expected category %v, got %v\n", "test_catalogue_work", idea.Data.Category)
+	}
+	var unknown IdeaResponse
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", IdeaParams{TopicTitle: "test_catalogue_topic", Category: "test_catalogue_wrok"}, &unknown)
+	if unknown.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestCategories: expected status %v for an unknown category, got %v\n", http.StatusBadRequest, unknown.StatusCode)
+	}
+
+	// ideas filed before the catalogue may be spelled differently
+	legacy := models.Idea{ID: primitive.NewObjectID(), TopicTitle: "test_catalogue_legacy", Category: "TEST_CATALOGUE_WORK", CreatedBy: user.ID, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if _, err := ideacollection.InsertOne(ctx, legacy); err != nil {
+		t.Errorf("TestCategories: Failed to insert idea...%v\n", err)
+		return
+	}
+
+	// renaming moves the ideas along
+	var renamed ChangeResponse
+	path := "/api/categories/" + created.Data.ID.Hex()
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, path, "json", map[string]string{"name": "test_catalogue_job"}, &renamed); err != nil || renamed.StatusCode != http.StatusOK {
+		t.Errorf("TestCategories: expected category to be renamed, got %v %v\n", renamed.StatusCode, err)
+		return
+	}
+	if renamed.Data.MovedIdeas != 2 || renamed.Data.Category.Color != "#ffaa00" {
+		t.Errorf("TestCategories: expected 2 moved ideas and the colour to be kept, got %+v\n", renamed.Data)
+	}
+	var got IdeaResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/"+idea.Data.ID.Hex(), "json", nil, &got)
+	if got.Data.Category != "test_catalogue_job" {
+		t.Errorf("TestCategories: expected renamed category on the idea, got %v\n", got.Data.Category)
+	}
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/"+legacy.ID.Hex(), "json", nil, &got)
+	if got.Data.Category != "test_catalogue_job" {
+		t.Errorf("TestCategories: expected renamed category on the legacy idea, got %v\n", got.Data.Category)
+	}
+
+	// deleting moves the ideas to the fallback
+	if err := AddCategories("test_catalogue_fallback"); err != nil {
+		t.Errorf("TestCategories: %v\n", err)
+		return
+	}
+	var invalid ChangeResponse
+	unitTest.TestHandlerUnMarshalResp(utils.DELETE, path+"?fallback=test_catalogue_missing", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestCategories: expected status %v for an unknown fallback, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+	var deleted ChangeResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.DELETE, path+"?fallback=test_catalogue_fallback", "json", nil, &deleted); err != nil || deleted.StatusCode != http.StatusOK {
+		t.Errorf("TestCategories: expected category to be deleted, got %v %v\n", deleted.StatusCode, err)
+		return
+	}
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/"+idea.Data.ID.Hex(), "json", nil, &got)
+	if deleted.Data.MovedIdeas != 2 || got.Data.Category != "test_catalogue_fallback" {
+		t.Errorf("TestCategories: expected idea in the fallback category, got %v moved and %v\n", deleted.Data.MovedIdeas, got.Data.Category)
+	}
+
+	// the default category stays
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/categories/", "json", nil, &categories)
+	for _, category := range categories.Data {
+		if category.Name != models.DEFAULT_CATEGORY {
+			continue
+		}
+		var protected ChangeResponse
+		unitTest.TestHandlerUnMarshalResp(utils.DELETE, "/api/categories/"+category.ID.Hex(), "json", nil, &protected)
+		if protected.StatusCode != http.StatusBadRequest {
+			t.Errorf("TestCategories: expected status %v for deleting the default category, got %v\n", http.StatusBadRequest, protected.StatusCode)
+		}
+	}
+
+	t.Log("passed")
+}
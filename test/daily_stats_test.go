@@ -0,0 +1,371 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"idea-training-version-go/internals/controllers"
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/utils"
+	"math"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	unitTest "github.com/Valiben/gin_unit_test"
+	testUtils "github.com/Valiben/gin_unit_test/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalizeStats renders a statistic as JSON with groups sorted by id and
+// floats rounded, as sums of durations may differ in the last bits.
+func normalizeStats(t *testing.T, stats interface{}) string {
+	raw, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("normalizeStats: %v\n", err)
+	}
+	var value interface{}
+	json.Unmarshal(raw, &value)
+
+	var round func(v interface{}) interface{}
+	round = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case float64:
+			return math.Round(v*1e6) / 1e6
+		case map[string]interface{}:
+			for key, field := range v {
+				v[key] = round(field)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = round(item)
+			}
+			sort.SliceStable(v, func(i, j int) bool {
+				return fmt.Sprint(v[i]) < fmt.Sprint(v[j])
+			})
+		}
+		return v
+	}
+	normalized, _ := json.Marshal(round(value))
+	return string(normalized)
+}
+
+// compareDailyStats checks every statistic answered from the rollups against
+// the live aggregation over the idea records.
+func compareDailyStats(t *testing.T, step string, userID primitive.ObjectID, loc *time.Location) {
+	live := ideacontroller.(controllers.IIdeaStatsController)
+	rollups := statscontroller.(controllers.IIdeaStatsController)
+	to := utils.StartOfDay(time.Now(), loc).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -30)
+
+	answers := map[string]func(stats controllers.IIdeaStatsController) (interface{}, error){
+		"today": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetTotalIdeasOfToday(userID, loc)
+		},
+		"all time": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetTotalIdeasOfAllTime(userID)
+		},
+		"streaks": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetStreaks(userID, loc, 1)
+		},
+		"daily counts": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetDailyCounts(userID, from, to, loc)
+		},
+		"category counts": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetCategoryCounts(userID, from, to)
+		},
+		"all time category counts": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetCategoryCounts(userID, time.Time{}, time.Time{})
+		},
+		"weekly ideas": func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			weekly, _, err := stats.GetWeeklyIdeas(userID, loc)
+			return weekly, err
+		},
+	}
+	for interval := range controllers.IdeaPaceIntervals {
+		interval := interval
+		answers["pace by "+interval] = func(stats controllers.IIdeaStatsController) (interface{}, error) {
+			return stats.GetIdeasPerMinute(userID, interval, loc)
+		}
+	}
+
+	for name, answer := range answers {
+		want, err := answer(live)
+		if err != nil {
+			t.Errorf("TestDailyStats: %v: live %v failed: %v\n", step, name, err)
+			continue
+		}
+		got, err := answer(rollups)
+		if err != nil {
+			t.Errorf("TestDailyStats: %v: rollup %v failed: %v\n", step, name, err)
+			continue
+		}
+		if normalizeStats(t, got) != normalizeStats(t, want) {
+			t.Errorf("TestDailyStats: %v: expected %v %v, got %v\n", step, name, normalizeStats(t, want), normalizeStats(t, got))
+		}
+	}
+}
+
+func TestDailyStats(t *testing.T) {
+	type IdeaResponse struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+	type SessionResponse struct {
+		StatusCode int            `json:"status_code"`
+		Data       models.Session `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Category   string   `json:"category"`
+		Ideas      []string `json:"ideas"`
+		IsLiked    bool     `json:"isLiked"`
+	}
+
+	user, err := AddAuthHeaderFor("test_email8@test.com")
+	if err != nil {
+		t.Errorf("TestDailyStats: Fails to add auth header %v\n", err)
+		return
+	}
+	if err := AddCategories("test_daily_category_1", "test_daily_category_2"); err != nil {
+		t.Errorf("TestDailyStats: %v\n", err)
+		return
+	}
+
+	// the rollups follow the time zone of the user
+	var status struct {
+		StatusCode int `json:"status_code"`
+	}
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", map[string]string{"timezone": "Asia/Kolkata"}, &status); err != nil || status.StatusCode != http.StatusOK {
+		t.Errorf("TestDailyStats: expected timezone to be updated, got %v %v\n", status.StatusCode, err)
+		return
+	}
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	compareDailyStats(t, "after timezone change", user.ID, loc)
+
+	created := []IdeaParams{
+		{TopicTitle: "test_daily_topic_1", Category: "test_daily_category_1", Ideas: []string{"idea_1", "idea_2"}},
+		{TopicTitle: "test_daily_topic_2", Category: "test_daily_category_1", Ideas: []string{"idea_1"}, IsLiked: true},
+		{TopicTitle: "test_daily_topic_3", Category: "test_daily_category_2", Ideas: []string{"idea_1", "idea_2", "idea_3"}},
+	}
+	ideas := make([]models.Idea, 0, len(created))
+	for _, params := range created {
+		var res IdeaResponse
+		if err := unitTest.TestHandlerUnMarshalResp(testUtils.POST, "/api/ideas/", "json", params, &res); err != nil || res.StatusCode != http.StatusCreated {
+			t.Errorf("TestDailyStats: expected idea to be created, got %v %v\n", res.StatusCode, err)
+			return
+		}
+		ideas = append(ideas, res.Data)
+	}
+	compareDailyStats(t, "after create", user.ID, loc)
+
+	var session SessionResponse
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.POST, "/api/sessions/start", "json", map[string]string{"topicTitle": "test_daily_timed_topic"}, &session); err != nil || session.StatusCode != http.StatusCreated {
+		t.Errorf("TestDailyStats: expected session to start, got %v %v\n", session.StatusCode, err)
+		return
+	}
+	base := "/api/sessions/" + session.Data.ID.Hex()
+	unitTest.TestHandlerUnMarshalResp(testUtils.POST, base+"/ideas", "json", map[string]string{"text": "test_daily_timed_idea"}, &session)
+	var finished IdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.POST, base+"/finish", "json", map[string]string{"category": "test_daily_category_2"}, &finished); err != nil || finished.StatusCode != http.StatusCreated {
+		t.Errorf("TestDailyStats: expected session to finish, got %v %v\n", finished.StatusCode, err)
+		return
+	}
+	compareDailyStats(t, "after session", user.ID, loc)
+
+	update := IdeaParams{TopicTitle: "test_daily_topic_1", Category: "test_daily_category_2", Ideas: []string{"idea_1", "idea_2", "idea_3", "idea_4"}, IsLiked: true}
+	var res IdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.PUT, "/api/ideas/"+ideas[0].ID.Hex(), "json", update, &res); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("TestDailyStats: expected idea to be updated, got %v %v\n", res.StatusCode, err)
+		return
+	}
+	compareDailyStats(t, "after update", user.ID, loc)
+
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.DELETE, "/api/ideas/"+ideas[1].ID.Hex(), "json", nil, &status); err != nil || status.StatusCode != http.StatusOK {
+		t.Errorf("TestDailyStats: expected idea to be deleted, got %v %v\n", status.StatusCode, err)
+		return
+	}
+	compareDailyStats(t, "after delete", user.ID, loc)
+
+	// renamed and deleted categories move their rollups with the ideas
+	var categories struct {
+		StatusCode int                `json:"status_code"`
+		Data       []*models.Category `json:"data"`
+	}
+	if err := unitTest.TestHandlerUnMarshalResp(testUtils.GET, "/api/categories/", "json", nil, &categories); err != nil || categories.StatusCode != http.StatusOK {
+		t.Errorf("TestDailyStats: expected categories, got %v %v\n", categories.StatusCode, err)
+		return
+	}
+	for _, category := range categories.Data {
+		switch category.Name {
+		case "test_daily_category_1":
+			if err := unitTest.TestHandlerUnMarshalResp(testUtils.DELETE, "/api/categories/"+category.ID.Hex(), "json", nil, &status); err != nil || status.StatusCode != http.StatusOK {
+				t.Errorf("TestDailyStats: expected category to be deleted, got %v %v\n", status.StatusCode, err)
+				return
+			}
+			compareDailyStats(t, "after category delete", user.ID, loc)
+		case "test_daily_category_2":
+			if err := unitTest.TestHandlerUnMarshalResp(testUtils.PUT, "/api/categories/"+category.ID.Hex(), "json", map[string]string{"name": "TEST_DAILY_RENAMED"}, &status); err != nil || status.StatusCode != http.StatusOK {
+				t.Errorf("TestDailyStats: expected category to be renamed, got %v %v\n", status.StatusCode, err)
+				return
+			}
+			compareDailyStats(t, "after category rename", user.ID, loc)
+		}
+	}
+
+	// records written around the service are picked up by a rebuild
+	filter := bson.D{bson.E{Key: "_id", Value: ideas[2].ID}}
+	backdate := bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "createdAt", Value: time.Now().AddDate(0, 0, -3)}}}}
+	if _, err := ideacollection.UpdateOne(ctx, filter, backdate); err != nil {
+		t.Errorf("TestDailyStats: %v\n", err)
+		return
+	}
+	if err := dailystatsservice.Rebuild(user.ID, loc); err != nil {
+		t.Errorf("TestDailyStats: expected rollups to be rebuilt, got %v\n", err)
+		return
+	}
+	compareDailyStats(t, "after rebuild", user.ID, loc)
+
+	t.Log("passed")
+}
+
+func TestDailyStatsAcrossDST(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name string
+		loc  *time.Location
+		now  time.Time
+		// sessions of one idea each
+		sessions []time.Time
+		// wantWeekly is the number of sessions per day since Monday
+		wantWeekly    map[string]int
+		wantToday     int
+		wantStreak    int
+		wantStreakDay string
+	}{
+		{
+			// clocks skip from 2:00 to 3:00, today starts at 05:00 UTC
+			name: "New York spring forward",
+			loc:  newYork,
+			now:  utc(2023, 3, 12, 16, 0),
+			sessions: []time.Time{
+				utc(2023, 3, 6, 5, 10),  // Monday 00:10 EST, first day of the week
+				utc(2023, 3, 6, 4, 50),  // Sunday 23:50 EST, last week
+				utc(2023, 3, 10, 17, 0), // Friday
+				utc(2023, 3, 12, 4, 30), // Saturday 23:30 EST
+				utc(2023, 3, 12, 5, 30), // 00:30 EST
+				utc(2023, 3, 12, 7, 30), // 03:30 EDT
+			},
+			wantWeekly:    map[string]int{"2023-03-06": 1, "2023-03-10": 1, "2023-03-11": 1, "2023-03-12": 2},
+			wantToday:     2,
+			wantStreak:    3,
+			wantStreakDay: "2023-03-10",
+		},
+		{
+			// 1:00 to 2:00 happens twice, today lasts 25 hours from 04:00 UTC
+			name: "New York fall back",
+			loc:  newYork,
+			now:  utc(2023, 11, 6, 4, 30), // Sunday 23:30 EST
+			sessions: []time.Time{
+				utc(2023, 11, 5, 3, 50), // Saturday 23:50 EDT
+				utc(2023, 11, 5, 4, 10), // 00:10 EDT
+				utc(2023, 11, 5, 6, 30), // the second 01:30, EST
+				utc(2023, 11, 6, 4, 10), // 23:10 EST
+			},
+			wantWeekly:    map[string]int{"2023-11-04": 1, "2023-11-05": 3},
+			wantToday:     3,
+			wantStreak:    2,
+			wantStreakDay: "2023-11-04",
+		},
+		{
+			// clocks skip from 2:00 to 3:00, today starts at 23:00 UTC
+			name: "Berlin spring forward",
+			loc:  berlin,
+			now:  utc(2023, 3, 26, 8, 0),
+			sessions: []time.Time{
+				utc(2023, 3, 25, 22, 30), // Saturday 23:30 CET
+				utc(2023, 3, 25, 23, 30), // 00:30 CET
+				utc(2023, 3, 26, 1, 30),  // 03:30 CEST
+			},
+			wantWeekly:    map[string]int{"2023-03-25": 1, "2023-03-26": 2},
+			wantToday:     2,
+			wantStreak:    2,
+			wantStreakDay: "2023-03-25",
+		},
+		{
+			// 2:00 to 3:00 happens twice, the week starts at 22:00 UTC
+			name: "Berlin fall back",
+			loc:  berlin,
+			now:  utc(2023, 10, 29, 22, 0), // Sunday 23:00 CET
+			sessions: []time.Time{
+				utc(2023, 10, 22, 21, 30), // Sunday 23:30 CEST, last week
+				utc(2023, 10, 28, 21, 30), // Saturday 23:30 CEST
+				utc(2023, 10, 28, 22, 30), // 00:30 CEST
+				utc(2023, 10, 29, 1, 30),  // the second 02:30, CET
+			},
+			wantWeekly:    map[string]int{"2023-10-28": 1, "2023-10-29": 2},
+			wantToday:     2,
+			wantStreak:    2,
+			wantStreakDay: "2023-10-28",
+		},
+	}
+
+	for _, c := range cases {
+		userID := primitive.NewObjectID()
+		for _, createdAt := range c.sessions {
+			idea := &models.Idea{CreatedBy: userID, CreatedAt: createdAt, Category: "test_dst_category", Ideas: &[]models.IdeaEntry{{Text: "test_dst_idea"}}}
+			if _, err := ideacollection.InsertOne(ctx, idea); err != nil {
+				t.Fatalf("TestDailyStatsAcrossDST %v: %v\n", c.name, err)
+			}
+		}
+
+		now := func() time.Time { return c.now }
+		live := controllers.NewIdeaController(ideacollection, tombcollection, seqcollection, statscollection, ctx)
+		live.(*controllers.IdeaController).SetClock(now)
+		rollups := controllers.NewDailyStatsController(statscollection, ctx)
+		rollups.(*controllers.DailyStatsController).SetClock(now)
+		if err := live.RebuildDailyStats(userID, c.loc); err != nil {
+			t.Fatalf("TestDailyStatsAcrossDST %v: expected rollups to be built, got %v\n", c.name, err)
+		}
+
+		for _, answers := range []struct {
+			name  string
+			stats controllers.IIdeaStatsController
+		}{{"live", live}, {"rollups", rollups}} {
+			today, err := answers.stats.GetTotalIdeasOfToday(userID, c.loc)
+			if err != nil || len(today) != 1 || fmt.Sprint(today[0]["totalSessions"]) != fmt.Sprint(c.wantToday) {
+				t.Errorf("TestDailyStatsAcrossDST %v: expected %v sessions today from the %v, got %v %v\n", c.name, c.wantToday, answers.name, today, err)
+			}
+
+			weekly, monday, err := answers.stats.GetWeeklyIdeas(userID, c.loc)
+			got := map[string]int{}
+			for _, day := range weekly {
+				var sessions int
+				fmt.Sscan(fmt.Sprint(day["totalSessions"]), &sessions)
+				got[fmt.Sprint(day["_id"])] = sessions
+			}
+			if err != nil || normalizeStats(t, got) != normalizeStats(t, c.wantWeekly) {
+				t.Errorf("TestDailyStatsAcrossDST %v: expected weekly sessions %v from the %v, got %v %v\n", c.name, c.wantWeekly, answers.name, got, err)
+			}
+			if monday.In(c.loc).Weekday() != time.Monday || monday.In(c.loc).Hour() != 0 {
+				t.Errorf("TestDailyStatsAcrossDST %v: expected the week to start on Monday midnight, got %v\n", c.name, monday.In(c.loc))
+			}
+
+			streaks, err := answers.stats.GetStreaks(userID, c.loc, 0)
+			if err != nil || streaks.CurrentStreak != c.wantStreak || streaks.CurrentStreakStart != c.wantStreakDay || !streaks.ActiveToday {
+				t.Errorf("TestDailyStatsAcrossDST %v: expected a streak of %v days from %v from the %v, got %+v %v\n", c.name, c.wantStreak, c.wantStreakDay, answers.name, streaks, err)
+			}
+		}
+
+		ideacollection.DeleteMany(ctx, bson.M{"createdBy": userID})
+		rollups.DeleteStatsOfUser(userID)
+	}
+
+	t.Log("passed")
+}
@@ -2,7 +2,10 @@ package test
 
 import (
 	"fmt"
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/services"
+	"net/http"
 	"testing"
 	"time"
 
@@ -53,6 +56,10 @@ func TestCreateIdea(t *testing.T) {
 		t.Errorf("TestCreateIdea: Fails to add auth header %v\n", err)
 		return
 	}
+	if err := AddCategories("test_category_11"); err != nil {
+		t.Errorf("TestCreateIdea: %v\n", err)
+		return
+	}
 
 	params := IdeaParams{
 		TopicTitle: "test_topic_title_11",
@@ -175,6 +182,10 @@ func TestUpdateIdea(t *testing.T) {
 		t.Errorf("TestCreateIdea: Fails to add auth header %v\n", err)
 		return
 	}
+	if err := AddCategories("updated category"); err != nil {
+		t.Errorf("TestUpdateIdea: %v\n", err)
+		return
+	}
 
 	params = IdeaParams{
 		TopicTitle: "updated title",
@@ -223,6 +234,237 @@ func TestUpdateIdea(t *testing.T) {
 
 }
 
+func TestGetIdeaByIDOfOtherUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.Idea `json:"data"`
+	}
+
+	var res HTTPResponse
+
+	if _, err := AddAuthHeaderFor("test_email0@test.com"); err != nil {
+		t.Errorf("TestGetIdeaByIDOfOtherUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	idea, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestGetIdeaByIDOfOtherUser: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, fmt.Sprintf("/api/ideas/%v", idea.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestGetIdeaByIDOfOtherUser: %v\n", err)
+		return
+	}
+
+	if res.Success || res.StatusCode != http.StatusNotFound {
+		t.Errorf("TestGetIdeaByIDOfOtherUser: expected status %v, got %v\n", http.StatusNotFound, res.StatusCode)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestUpdateIdeaOfOtherUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.Idea `json:"data"`
+	}
+
+	type IdeaParams struct {
+		TopicTitle string `json:"topicTitle"`
+		CreatedBy  string `json:"createdBy"`
+	}
+
+	var res HTTPResponse
+
+	other, err := AddAuthHeaderFor("test_email0@test.com")
+	if err != nil {
+		t.Errorf("TestUpdateIdeaOfOtherUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	idea, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestUpdateIdeaOfOtherUser: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	params := IdeaParams{
+		TopicTitle: "hijacked title",
+		CreatedBy:  other.ID.Hex(),
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/ideas/%v", idea.ID.Hex()), "json", params, &res); err != nil {
+		t.Errorf("TestUpdateIdeaOfOtherUser: %v\n", err)
+		return
+	}
+
+	if res.Success || res.StatusCode != http.StatusNotFound {
+		t.Errorf("TestUpdateIdeaOfOtherUser: expected status %v, got %v\n", http.StatusNotFound, res.StatusCode)
+		return
+	}
+
+	unchanged, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestUpdateIdeaOfOtherUser: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	if unchanged.TopicTitle != idea.TopicTitle || unchanged.CreatedBy != idea.CreatedBy {
+		t.Errorf("TestUpdateIdeaOfOtherUser: expected idea to be unchanged, got %v\n", unchanged)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestDeleteIdeaOfOtherUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int    `json:"status_code"`
+		Success    bool   `json:"success"`
+		Message    string `json:"message"`
+		Data       string `json:"data"`
+	}
+
+	var res HTTPResponse
+
+	if _, err := AddAuthHeaderFor("test_email0@test.com"); err != nil {
+		t.Errorf("TestDeleteIdeaOfOtherUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	idea, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestDeleteIdeaOfOtherUser: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.DELETE, fmt.Sprintf("/api/ideas/%v", idea.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestDeleteIdeaOfOtherUser: %v\n", err)
+		return
+	}
+
+	if res.Success || res.StatusCode != http.StatusNotFound {
+		t.Errorf("TestDeleteIdeaOfOtherUser: expected status %v, got %v\n", http.StatusNotFound, res.StatusCode)
+		return
+	}
+
+	count, err := ideacollection.CountDocuments(ctx, bson.M{"_id": idea.ID})
+	if err != nil || count != 1 {
+		t.Errorf("TestDeleteIdeaOfOtherUser: expected idea to still exist, got count %v (%v)\n", count, err)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestGetIdeaByIDAsAdmin(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.Idea `json:"data"`
+	}
+
+	var res HTTPResponse
+
+	admin, err := AddAuthHeaderFor("test_email1@test.com")
+	if err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdmin: Fails to add auth header %v\n", err)
+		return
+	}
+
+	if _, err := usercollection.UpdateByID(ctx, admin.ID, bson.M{"$set": bson.M{"role": guard.Admin}}); err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdmin: Failed to promote user to admin...%v\n", err)
+		return
+	}
+	defer usercollection.UpdateByID(ctx, admin.ID, bson.M{"$set": bson.M{"role": guard.User}})
+
+	idea, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdmin: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, fmt.Sprintf("/api/ideas/%v", idea.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdmin: %v\n", err)
+		return
+	}
+
+	if !res.Success {
+		t.Errorf("TestGetIdeaByIDAsAdmin: %v\n", res.Message)
+		return
+	}
+
+	if res.Data.ID != idea.ID {
+		t.Errorf("TestGetIdeaByIDAsAdmin: expected idea %v, got %v\n", idea.ID, res.Data.ID)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestGetIdeaByIDAsAdminAccessToken(t *testing.T) {
+	type TokenResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+
+	admin, err := AddAuthHeaderFor("test_email1@test.com")
+	if err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdminAccessToken: Fails to add auth header %v\n", err)
+		return
+	}
+	if _, err := usercollection.UpdateByID(ctx, admin.ID, bson.M{"$set": bson.M{"role": guard.Admin}}); err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdminAccessToken: Failed to promote user to admin...%v\n", err)
+		return
+	}
+	defer usercollection.UpdateByID(ctx, admin.ID, bson.M{"$set": bson.M{"role": guard.User}})
+
+	var token TokenResponse
+	params := map[string]interface{}{"name": "admin script", "scopes": []guard.Scope{guard.IdeasRead, guard.IdeasWrite}}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/users/tokens", "json", params, &token); err != nil || token.Data.Token == "" {
+		t.Errorf("TestGetIdeaByIDAsAdminAccessToken: expected an access token, got %v %v\n", token.StatusCode, err)
+		return
+	}
+
+	idea, err := getSampleIdea()
+	if err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdminAccessToken: Failed to get sample idea data...%v\n", err)
+		return
+	}
+
+	// the token only acts as the admin's own account
+	unitTest.AddHeader("Authorization", fmt.Sprintf("Bearer %s", token.Data.Token))
+	for _, method := range []string{utils.GET, utils.DELETE} {
+		var res HTTPResponse
+		if err := unitTest.TestHandlerUnMarshalResp(method, fmt.Sprintf("/api/ideas/%v", idea.ID.Hex()), "json", nil, &res); err != nil {
+			t.Errorf("TestGetIdeaByIDAsAdminAccessToken: %v\n", err)
+			return
+		}
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("TestGetIdeaByIDAsAdminAccessToken: expected status %v for %v, got %v\n", http.StatusNotFound, method, res.StatusCode)
+		}
+	}
+	if err := ideacollection.FindOne(ctx, bson.M{"_id": idea.ID}).Err(); err != nil {
+		t.Errorf("TestGetIdeaByIDAsAdminAccessToken: expected the idea to be kept, got %v\n", err)
+	}
+
+	t.Log("passed")
+}
+
 func TestDeleteIdea(t *testing.T) {
 	type HTTPResponse struct {
 		StatusCode int    `json:"status"`
@@ -318,10 +560,10 @@ func TestGetTotalIdeasOfAllTime(t *testing.T) {
 
 func TestGetTotalConsecutiveDays(t *testing.T) {
 	type HTTPResponse struct {
-		StatusCode int    `json:"status"`
-		Success    bool   `json:"success"`
-		Message    string `json:"message"`
-		Data       int    `json:"data"`
+		StatusCode int            `json:"status"`
+		Success    bool           `json:"success"`
+		Message    string         `json:"message"`
+		Data       models.Streaks `json:"data"`
 	}
 	var res HTTPResponse
 
@@ -335,8 +577,9 @@ func TestGetTotalConsecutiveDays(t *testing.T) {
 		return
 	}
 
-	if res.Data != 0 {
-		t.Errorf("TestGetTotalConsecutiveDays: expected data %v, got %v\n", 0, res.Data)
+	// ideas were created today by the earlier tests
+	if res.Data.CurrentStreak != 1 || !res.Data.ActiveToday || res.Data.LongestStreak != 1 {
+		t.Errorf("TestGetTotalConsecutiveDays: expected a streak of today only, got %+v\n", res.Data)
 		return
 	}
 
@@ -379,6 +622,208 @@ func TestGetRecentIdeas(t *testing.T) {
 	t.Log("passed")
 }
 
+func TestTimedSessionStats(t *testing.T) {
+	type SessionResponse struct {
+		StatusCode int            `json:"status_code"`
+		Data       models.Session `json:"data"`
+	}
+	type IdeaResponse struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+	type FirstIdeaResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			MedianMs *float64 `json:"medianMs"`
+			Sessions int      `json:"sessions"`
+		} `json:"data"`
+	}
+	type PaceResponse struct {
+		StatusCode int      `json:"status_code"`
+		Data       []bson.M `json:"data"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestTimedSessionStats: Fails to add auth header %v\n", err)
+		return
+	}
+
+	var session SessionResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/sessions/start", "json", map[string]string{"topicTitle": "test_timed_topic"}, &session); err != nil || session.StatusCode != http.StatusCreated {
+		t.Errorf("TestTimedSessionStats: expected session to start, got %v %v\n", session.StatusCode, err)
+		return
+	}
+	base := "/api/sessions/" + session.Data.ID.Hex()
+	for _, text := range []string{"test_timed_idea_1", "test_timed_idea_2"} {
+		var entry SessionResponse
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, base+"/ideas", "json", map[string]string{"text": text}, &entry); err != nil || entry.StatusCode != http.StatusCreated {
+			t.Errorf("TestTimedSessionStats: expected idea to be added, got %v %v\n", entry.StatusCode, err)
+			return
+		}
+	}
+
+	var idea IdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, base+"/finish", "json", map[string]string{}, &idea); err != nil || idea.StatusCode != http.StatusCreated {
+		t.Errorf("TestTimedSessionStats: expected session to finish, got %v %v\n", idea.StatusCode, err)
+		return
+	}
+	if idea.Data.Ideas == nil || len(*idea.Data.Ideas) != 2 || (*idea.Data.Ideas)[0].Offset == nil {
+		t.Errorf("TestTimedSessionStats: expected timed idea entries, got %v\n", idea.Data.Ideas)
+	}
+
+	var firstIdea FirstIdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/first-idea", "json", nil, &firstIdea); err != nil {
+		t.Errorf("TestTimedSessionStats: %v\n", err)
+		return
+	}
+	if firstIdea.Data.Sessions < 1 || firstIdea.Data.MedianMs == nil {
+		t.Errorf("TestTimedSessionStats: expected median time to first idea, got %v\n", firstIdea.Data)
+	}
+
+	var pace PaceResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/pace?interval=day", "json", nil, &pace); err != nil {
+		t.Errorf("TestTimedSessionStats: %v\n", err)
+		return
+	}
+	if len(pace.Data) < 1 || pace.Data[0]["ideasPerMinute"] == nil {
+		t.Errorf("TestTimedSessionStats: expected ideas per minute, got %v\n", pace.Data)
+	}
+
+	var invalid PaceResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/pace?interval=year", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestTimedSessionStats: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
+func TestGetHeatmap(t *testing.T) {
+	type ResponseBody struct {
+		From string              `json:"from"`
+		To   string              `json:"to"`
+		Days []models.DailyCount `json:"days"`
+	}
+	type HTTPResponse struct {
+		StatusCode int          `json:"status_code"`
+		Success    bool         `json:"success"`
+		Message    string       `json:"message"`
+		Data       ResponseBody `json:"data"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestGetHeatmap: Fails to add auth header %v\n", err)
+		return
+	}
+
+	today := time.Now().UTC()
+	var res HTTPResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, fmt.Sprintf("/api/ideas/stats/heatmap?year=%v", today.Year()), "json", nil, &res); err != nil {
+		t.Errorf("TestGetHeatmap: %v\n", err)
+		return
+	}
+	if len(res.Data.Days) < 365 || res.Data.From != fmt.Sprintf("%v-01-01", today.Year()) {
+		t.Errorf("TestGetHeatmap: expected every day of the year, got %v days from %v\n", len(res.Data.Days), res.Data.From)
+		return
+	}
+	for _, day := range res.Data.Days {
+		if day.Date == today.Format("2006-01-02") && day.TotalSessions < 1 {
+			t.Errorf("TestGetHeatmap: expected sessions today, got %+v\n", day)
+		}
+	}
+
+	var month HTTPResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/heatmap?from=2023-02-01&to=2023-02-28", "json", nil, &month); err != nil {
+		t.Errorf("TestGetHeatmap: %v\n", err)
+		return
+	}
+	if len(month.Data.Days) != 28 {
+		t.Errorf("TestGetHeatmap: expected 28 days, got %v\n", len(month.Data.Days))
+	}
+
+	var invalid HTTPResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/heatmap?from=2023-02-01", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestGetHeatmap: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
+func TestGetCategoryAndTopicStats(t *testing.T) {
+	type CategoryResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Categories []struct {
+				Category string `json:"category"`
+				Sessions int    `json:"sessions"`
+			} `json:"categories"`
+		} `json:"data"`
+	}
+	type TopicResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       []struct {
+			TopicTitle  string                `json:"topicTitle"`
+			Attempts    []models.TopicAttempt `json:"attempts"`
+			IdeasChange int                   `json:"ideasChange"`
+		} `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Category   string   `json:"category"`
+		Ideas      []string `json:"ideas"`
+	}
+
+	if _, err := AddAuthHeaderFor("test_email9@test.com"); err != nil {
+		t.Errorf("TestGetCategoryAndTopicStats: Fails to add auth header %v\n", err)
+		return
+	}
+	if err := AddCategories("test_stats_category"); err != nil {
+		t.Errorf("TestGetCategoryAndTopicStats: %v\n", err)
+		return
+	}
+
+	attempts := []IdeaParams{
+		{TopicTitle: "test revisited topic", Category: "test_stats_category", Ideas: []string{"idea_1"}},
+		{TopicTitle: " Test Revisited Topic", Category: "test_stats_category", Ideas: []string{"idea_1", "idea_2", "idea_3"}},
+	}
+	for _, params := range attempts {
+		var res struct {
+			StatusCode int `json:"status_code"`
+		}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &res); err != nil {
+			t.Errorf("TestGetCategoryAndTopicStats: %v\n", err)
+			return
+		}
+	}
+
+	var categories CategoryResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/categories?days=7", "json", nil, &categories); err != nil {
+		t.Errorf("TestGetCategoryAndTopicStats: %v\n", err)
+		return
+	}
+	if len(categories.Data.Categories) != 1 || categories.Data.Categories[0].Sessions != 2 {
+		t.Errorf("TestGetCategoryAndTopicStats: expected 2 sessions in one category, got %+v\n", categories.Data.Categories)
+	}
+
+	var topics TopicResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/topics", "json", nil, &topics); err != nil {
+		t.Errorf("TestGetCategoryAndTopicStats: %v\n", err)
+		return
+	}
+	if len(topics.Data) != 1 || len(topics.Data[0].Attempts) != 2 || topics.Data[0].IdeasChange != 2 {
+		t.Errorf("TestGetCategoryAndTopicStats: expected one revisited topic, got %+v\n", topics.Data)
+	}
+
+	var invalid CategoryResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/stats/categories?days=0", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestGetCategoryAndTopicStats: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
 func TestGetWeeklyIdeas(t *testing.T) {
 	type WeeklyBody struct {
 		TotalIdeas    int    `json:"totalIdeas"`
@@ -485,3 +930,462 @@ func TestSearchIdeas(t *testing.T) {
 
 	t.Log("passed")
 }
+
+func TestIdeaTags(t *testing.T) {
+	type IdeaResponse struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+	type TagsResponse struct {
+		StatusCode int               `json:"status_code"`
+		Data       []models.TagCount `json:"data"`
+	}
+	type SearchResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Ideas []models.Idea `json:"ideas"`
+		} `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Category   string   `json:"category"`
+		Ideas      []string `json:"ideas"`
+		Tags       []string `json:"tags"`
+	}
+	type SearchParams struct {
+		Current int      `json:"current"`
+		Tags    []string `json:"tags,omitempty"`
+		AnyTags []string `json:"anyTags,omitempty"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestIdeaTags: Fails to add auth header %v\n", err)
+		return
+	}
+	if err := AddCategories("test_tagged_category"); err != nil {
+		t.Errorf("TestIdeaTags: %v\n", err)
+		return
+	}
+
+	params := IdeaParams{
+		TopicTitle: "test_tagged_topic",
+		Category:   "test_tagged_category",
+		Ideas:      []string{"idea_1"},
+		Tags:       []string{" TestWork ", "testwork", "TestFocus"},
+	}
+	var idea IdeaResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &idea); err != nil || idea.StatusCode != http.StatusCreated {
+		t.Errorf("TestIdeaTags: expected idea to be created, got %v %v\n", idea.StatusCode, err)
+		return
+	}
+	if idea.Data.Tags == nil || fmt.Sprint(*idea.Data.Tags) != "[testwork testfocus]" {
+		t.Errorf("TestIdeaTags: expected normalized tags, got %v\n", idea.Data.Tags)
+	}
+
+	var tags TagsResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/tags?prefix=TestW", "json", nil, &tags); err != nil {
+		t.Errorf("TestIdeaTags: %v\n", err)
+		return
+	}
+	if len(tags.Data) != 1 || tags.Data[0].Tag != "testwork" || tags.Data[0].Count < 1 {
+		t.Errorf("TestIdeaTags: expected tag testwork, got %+v\n", tags.Data)
+	}
+
+	searches := map[string]SearchParams{
+		"all tags": {Current: 1, Tags: []string{"testwork", "TestFocus"}},
+		"any tags": {Current: 1, AnyTags: []string{"testmissing", "testfocus"}},
+	}
+	for name, search := range searches {
+		var res SearchResponse
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", search, &res); err != nil {
+			t.Errorf("TestIdeaTags: %v: %v\n", name, err)
+			continue
+		}
+		found := false
+		for _, result := range res.Data.Ideas {
+			found = found || result.ID == idea.Data.ID
+		}
+		if !found {
+			t.Errorf("TestIdeaTags: %v: expected tagged idea to be found, got %v ideas\n", name, len(res.Data.Ideas))
+		}
+	}
+
+	var none SearchResponse
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", SearchParams{Current: 1, Tags: []string{"testwork", "testmissing"}}, &none)
+	if len(none.Data.Ideas) != 0 {
+		t.Errorf("TestIdeaTags: expected no idea with a missing tag, got %v\n", len(none.Data.Ideas))
+	}
+
+	var invalid TagsResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/tags?limit=0", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestIdeaTags: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
+func TestSearchIdeasByRelevance(t *testing.T) {
+	type SearchResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Ideas  []models.IdeaSearchResult `json:"ideas"`
+			SortBy string                    `json:"sortBy"`
+		} `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Ideas      []string `json:"ideas"`
+	}
+	type SearchParams struct {
+		SearchInput string `json:"searchInput"`
+		SortBy      string `json:"sortBy"`
+		Current     int    `json:"current"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestSearchIdeasByRelevance: Fails to add auth header %v\n", err)
+		return
+	}
+
+	created := []IdeaParams{
+		{TopicTitle: "test_relevance_other", Ideas: []string{"mention zeppelinrelevance once"}},
+		{TopicTitle: "zeppelinrelevance plans", Ideas: []string{"zeppelinrelevance again"}},
+	}
+	for _, params := range created {
+		var res struct {
+			StatusCode int `json:"status_code"`
+		}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &res); err != nil || res.StatusCode != http.StatusCreated {
+			t.Errorf("TestSearchIdeasByRelevance: expected idea to be created, got %v %v\n", res.StatusCode, err)
+			return
+		}
+	}
+
+	var res SearchResponse
+	params := SearchParams{SearchInput: "zeppelinrelevance", SortBy: "relevance", Current: 1}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", params, &res); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("TestSearchIdeasByRelevance: expected search results, got %v %v\n", res.StatusCode, err)
+		return
+	}
+	if res.Data.SortBy != "relevance" || len(res.Data.Ideas) != 2 {
+		t.Errorf("TestSearchIdeasByRelevance: expected 2 ideas by relevance, got %v and %v ideas\n", res.Data.SortBy, len(res.Data.Ideas))
+		return
+	}
+	best := res.Data.Ideas[0]
+	if best.TopicTitle != "zeppelinrelevance plans" || best.Score <= res.Data.Ideas[1].Score {
+		t.Errorf("TestSearchIdeasByRelevance: expected the title match first, got %v with score %v\n", best.TopicTitle, best.Score)
+	}
+	if len(best.Highlights) != 2 || best.Highlights[0].Snippet != "<mark>zeppelinrelevance</mark> plans" {
+		t.Errorf("TestSearchIdeasByRelevance: expected highlighted title and idea, got %+v\n", best.Highlights)
+	}
+
+	// regular expressions in the input are matched literally
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", SearchParams{SearchInput: "zeppelin.*(", Current: 1}, &res)
+	if res.StatusCode != http.StatusOK || len(res.Data.Ideas) != 0 {
+		t.Errorf("TestSearchIdeasByRelevance: expected no literal match, got %v and %v ideas\n", res.StatusCode, len(res.Data.Ideas))
+	}
+
+	t.Log("passed")
+}
+
+func TestSearchIdeasWithQuery(t *testing.T) {
+	type SearchResponse struct {
+		StatusCode int    `json:"status_code"`
+		Message    string `json:"message"`
+		Data       struct {
+			Ideas []models.IdeaSearchResult `json:"ideas"`
+		} `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Ideas      []string `json:"ideas"`
+		Tags       []string `json:"tags"`
+		IsLiked    bool     `json:"isLiked"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestSearchIdeasWithQuery: Fails to add auth header %v\n", err)
+		return
+	}
+
+	created := []IdeaParams{
+		{TopicTitle: "test_query quarterly plan", Ideas: []string{"hire a designer"}, Tags: []string{"testquery"}, IsLiked: true},
+		{TopicTitle: "test_query quarterly review", Ideas: []string{"hire a designer"}, Tags: []string{"testquery"}, IsLiked: true},
+		{TopicTitle: "test_query quarterly plan draft", Ideas: []string{"hire a designer"}, Tags: []string{"testquery"}},
+	}
+	for _, params := range created {
+		var res struct {
+			StatusCode int `json:"status_code"`
+		}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &res); err != nil || res.StatusCode != http.StatusCreated {
+			t.Errorf("TestSearchIdeasWithQuery: expected idea to be created, got %v %v\n", res.StatusCode, err)
+			return
+		}
+	}
+
+	var res SearchResponse
+	params := map[string]interface{}{"q": `tag:testquery liked:true "a designer" -review after:2000-01-01`, "current": 1}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", params, &res); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("TestSearchIdeasWithQuery: expected search results, got %v %v\n", res.StatusCode, err)
+		return
+	}
+	if len(res.Data.Ideas) != 1 || res.Data.Ideas[0].TopicTitle != "test_query quarterly plan" {
+		t.Errorf("TestSearchIdeasWithQuery: expected the liked plan only, got %v ideas\n", len(res.Data.Ideas))
+	}
+
+	var invalid SearchResponse
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", map[string]interface{}{"q": `before:tomorrow`, "current": 1}, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest || invalid.Message == "" {
+		t.Errorf("TestSearchIdeasWithQuery: expected status %v with a message, got %v %q\n", http.StatusBadRequest, invalid.StatusCode, invalid.Message)
+	}
+
+	t.Log("passed")
+}
+
+func TestIdeaCursorPages(t *testing.T) {
+	type PageResponse struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Ideas []models.Idea     `json:"ideas"`
+			Page  models.CursorPage `json:"page"`
+		} `json:"data"`
+	}
+	type AllResponse struct {
+		StatusCode int           `json:"status_code"`
+		Data       []models.Idea `json:"data"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestIdeaCursorPages: Fails to add auth header %v\n", err)
+		return
+	}
+
+	// without a limit all ideas are listed as before
+	var all AllResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/", "json", nil, &all); err != nil || all.StatusCode != http.StatusOK {
+		t.Errorf("TestIdeaCursorPages: expected all ideas, got %v %v\n", all.StatusCode, err)
+		return
+	}
+
+	// paging forward lists every idea once, oldest first
+	seen := map[primitive.ObjectID]bool{}
+	pages := [][]models.Idea{}
+	var last PageResponse
+	for path := "/api/ideas/?limit=3"; path != ""; {
+		var res PageResponse
+		if err := unitTest.TestHandlerUnMarshalResp(utils.GET, path, "json", nil, &res); err != nil || res.StatusCode != http.StatusOK {
+			t.Errorf("TestIdeaCursorPages: expected a page, got %v %v\n", res.StatusCode, err)
+			return
+		}
+		if len(res.Data.Ideas) > 3 || len(pages) > len(all.Data) {
+			t.Errorf("TestIdeaCursorPages: expected pages of at most 3 ideas, got %v\n", len(res.Data.Ideas))
+			return
+		}
+		for _, idea := range res.Data.Ideas {
+			seen[idea.ID] = true
+		}
+		pages = append(pages, res.Data.Ideas)
+		last = res
+		path = ""
+		if res.Data.Page.Next != "" {
+			path = "/api/ideas/?limit=3&cursor=" + res.Data.Page.Next
+		}
+	}
+	if len(seen) != len(all.Data) {
+		t.Errorf("TestIdeaCursorPages: expected %v ideas across the pages, got %v\n", len(all.Data), len(seen))
+	}
+	for i := 1; i < len(pages); i++ {
+		if pages[i][0].CreatedAt.Before(pages[i-1][len(pages[i-1])-1].CreatedAt) {
+			t.Errorf("TestIdeaCursorPages: expected oldest ideas first\n")
+		}
+	}
+
+	// prev leads back to the page before
+	if len(pages) > 1 {
+		var prev PageResponse
+		unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/?limit=3&cursor="+last.Data.Page.Prev, "json", nil, &prev)
+		before := pages[len(pages)-2]
+		if len(prev.Data.Ideas) != len(before) || prev.Data.Ideas[0].ID != before[0].ID || prev.Data.Page.Next == "" {
+			t.Errorf("TestIdeaCursorPages: expected the previous page, got %v ideas\n", len(prev.Data.Ideas))
+		}
+	}
+
+	// cursors belong to their sort order
+	var mismatch PageResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/?limit=3&sortBy=recent&cursor="+last.Data.Page.Prev, "json", nil, &mismatch)
+	if len(pages) > 1 && mismatch.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestIdeaCursorPages: expected status %v for a foreign cursor, got %v\n", http.StatusBadRequest, mismatch.StatusCode)
+	}
+	var tooMany PageResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, fmt.Sprintf("/api/ideas/?limit=%v", models.MAX_PAGE_LIMIT+1), "json", nil, &tooMany)
+	if tooMany.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestIdeaCursorPages: expected status %v above the limit cap, got %v\n", http.StatusBadRequest, tooMany.StatusCode)
+	}
+
+	// searches page by cursor too, ideas edited in between keep their place
+	params := map[string]interface{}{"searchInput": "test title", "sortBy": "oldest", "limit": 4}
+	found := 0
+	seen = map[primitive.ObjectID]bool{}
+	for {
+		var res PageResponse
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", params, &res); err != nil || res.StatusCode != http.StatusOK {
+			t.Errorf("TestIdeaCursorPages: expected search page, got %v %v\n", res.StatusCode, err)
+			return
+		}
+		for _, idea := range res.Data.Ideas {
+			if seen[idea.ID] {
+				t.Errorf("TestIdeaCursorPages: expected idea %v on one search page only\n", idea.ID.Hex())
+			}
+			seen[idea.ID] = true
+		}
+		if found == 0 && len(res.Data.Ideas) > 0 {
+			edited := bson.M{"$set": bson.M{"updatedAt": time.Now()}}
+			if _, err := ideacollection.UpdateByID(ctx, res.Data.Ideas[0].ID, edited); err != nil {
+				t.Errorf("TestIdeaCursorPages: Failed to edit idea...%v\n", err)
+				return
+			}
+		}
+		found += len(res.Data.Ideas)
+		if res.Data.Page.Next == "" || found > len(all.Data) {
+			break
+		}
+		params["cursor"] = res.Data.Page.Next
+	}
+	if found < 10 {
+		t.Errorf("TestIdeaCursorPages: expected the sample ideas to be found, got %v\n", found)
+	}
+	var relevance PageResponse
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/search", "json", map[string]interface{}{"searchInput": "test", "sortBy": "relevance", "limit": 4}, &relevance)
+	if relevance.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestIdeaCursorPages: expected status %v for relevance cursor pages, got %v\n", http.StatusBadRequest, relevance.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
+func TestIdeaSync(t *testing.T) {
+	type ChangesResponse struct {
+		StatusCode int                  `json:"status_code"`
+		Data       services.SyncChanges `json:"data"`
+	}
+	type SyncResponse struct {
+		StatusCode int                   `json:"status_code"`
+		Data       []services.SyncResult `json:"data"`
+	}
+	sync := func(changes ...map[string]interface{}) (SyncResponse, error) {
+		var res SyncResponse
+		err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/sync", "json", map[string]interface{}{"changes": changes}, &res)
+		return res, err
+	}
+	// pulls changes since token until nothing is left
+	pull := func(token string) (*services.SyncChanges, error) {
+		all := &services.SyncChanges{}
+		for {
+			var res ChangesResponse
+			if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/changes?since="+token, "json", nil, &res); err != nil {
+				return nil, err
+			}
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("status %v", res.StatusCode)
+			}
+			all.Ideas = append(all.Ideas, res.Data.Ideas...)
+			all.Tombstones = append(all.Tombstones, res.Data.Tombstones...)
+			all.Token, token = res.Data.Token, res.Data.Token
+			if !res.Data.HasMore {
+				return all, nil
+			}
+		}
+	}
+
+	if _, err := AddAuthHeaderFor("test_email7@test.com"); err != nil {
+		t.Errorf("TestIdeaSync: Fails to add auth header %v\n", err)
+		return
+	}
+
+	initial, err := pull("")
+	if err != nil {
+		t.Errorf("TestIdeaSync: expected the initial changes, got %v\n", err)
+		return
+	}
+
+	// creating offline is applied once, even when uploaded twice
+	ideaID := primitive.NewObjectID()
+	create := map[string]interface{}{"op": services.SYNC_OP_CREATE, "ideaId": ideaID, "idea": map[string]interface{}{"topicTitle": "test_sync_topic"}}
+	for i := 0; i < 2; i++ {
+		res, err := sync(create)
+		if err != nil || res.StatusCode != http.StatusOK || len(res.Data) != 1 || res.Data[0].Status != services.SYNC_APPLIED || res.Data[0].IdeaID != ideaID {
+			t.Errorf("TestIdeaSync: expected the create to apply, got %v %+v\n", err, res)
+			return
+		}
+	}
+
+	created, err := pull(initial.Token)
+	if err != nil || len(created.Ideas) != 1 || created.Ideas[0].ID != ideaID || len(created.Tombstones) != 0 {
+		t.Errorf("TestIdeaSync: expected only the created idea to change, got %v %+v\n", err, created)
+		return
+	}
+	idea := created.Ideas[0]
+
+	// a stale base gets the server version back
+	res, err := sync(
+		map[string]interface{}{"op": services.SYNC_OP_UPDATE, "ideaId": ideaID, "baseUpdatedAt": idea.UpdatedAt.Add(-time.Second), "idea": map[string]interface{}{"topicTitle": "test_sync_stale"}},
+		map[string]interface{}{"op": services.SYNC_OP_DELETE, "ideaId": ideaID, "baseUpdatedAt": idea.UpdatedAt},
+	)
+	if err != nil || len(res.Data) != 2 || res.Data[0].Status != services.SYNC_CONFLICT || res.Data[0].Idea == nil || res.Data[0].Idea.TopicTitle != "test_sync_topic" {
+		t.Errorf("TestIdeaSync: expected a conflict, got %v %+v\n", err, res)
+		return
+	}
+	if res.Data[1].Status != services.SYNC_APPLIED || !res.Data[1].Deleted {
+		t.Errorf("TestIdeaSync: expected the delete to apply, got %+v\n", res.Data[1])
+	}
+
+	// the deletion reaches other devices as a tombstone
+	deleted, err := pull(created.Token)
+	if err != nil || len(deleted.Ideas) != 0 || len(deleted.Tombstones) != 1 || deleted.Tombstones[0].IdeaID != ideaID {
+		t.Errorf("TestIdeaSync: expected a tombstone for the idea, got %v %+v\n", err, deleted)
+	}
+
+	// renaming a category reaches other devices through its ideas
+	var category struct {
+		StatusCode int             `json:"status_code"`
+		Data       models.Category `json:"data"`
+	}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/categories/", "json", map[string]string{"name": "test_sync_category"}, &category); err != nil || category.StatusCode != http.StatusCreated {
+		t.Errorf("TestIdeaSync: expected category to be created, got %v %v\n", category.StatusCode, err)
+		return
+	}
+	var filed struct {
+		StatusCode int         `json:"status_code"`
+		Data       models.Idea `json:"data"`
+	}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", map[string]interface{}{"topicTitle": "test_sync_filed", "category": "test_sync_category"}, &filed); err != nil || filed.StatusCode != http.StatusCreated {
+		t.Errorf("TestIdeaSync: expected idea to be created, got %v %v\n", filed.StatusCode, err)
+		return
+	}
+	before, err := pull(deleted.Token)
+	if err != nil {
+		t.Errorf("TestIdeaSync: expected the created idea, got %v\n", err)
+		return
+	}
+	var renamed struct {
+		StatusCode int `json:"status_code"`
+	}
+	unitTest.TestHandlerUnMarshalResp(utils.PUT, "/api/categories/"+category.Data.ID.Hex(), "json", map[string]string{"name": "test_sync_renamed"}, &renamed)
+	if renamed.StatusCode != http.StatusOK {
+		t.Errorf("TestIdeaSync: expected category to be renamed, got %v\n", renamed.StatusCode)
+		return
+	}
+	moved, err := pull(before.Token)
+	if err != nil || len(moved.Ideas) != 1 || moved.Ideas[0].ID != filed.Data.ID || moved.Ideas[0].Category != "test_sync_renamed" {
+		t.Errorf("TestIdeaSync: expected the renamed idea to change, got %v %+v\n", err, moved)
+	}
+
+	var invalid ChangesResponse
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/changes?since=nope", "json", nil, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestIdeaSync: expected status %v for an invalid token, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	t.Log("passed")
+}
@@ -7,6 +7,7 @@ import (
 	"idea-training-version-go/internals/middleware"
 	"idea-training-version-go/internals/routes"
 	"idea-training-version-go/internals/services"
+	"idea-training-version-go/internals/utils/cloudinary"
 	"idea-training-version-go/internals/utils/firebase"
 	"log"
 	"os"
@@ -19,17 +20,45 @@ import (
 )
 
 var (
-	server         *gin.Engine
-	usercollection *mongo.Collection
-	ideacollection *mongo.Collection
-	usercontroller controllers.IUserController
-	ideacontroller controllers.IIdeaController
-	userservice    services.IUserService
-	ideaservice    services.IIdeaService
-	requireauth    middleware.RequireAuth
-	userroute      routes.UserRoutes
-	idearoute      routes.IdeaRoutes
-	ctx            context.Context
+	server             *gin.Engine
+	usercollection     *mongo.Collection
+	ideacollection     *mongo.Collection
+	sessioncollection  *mongo.Collection
+	statscollection    *mongo.Collection
+	badgecollection    *mongo.Collection
+	categorycollection *mongo.Collection
+	searchcollection   *mongo.Collection
+	tombcollection     *mongo.Collection
+	seqcollection      *mongo.Collection
+	tokencollection    *mongo.Collection
+	receiptcollection  *mongo.Collection
+	usercontroller     controllers.IUserController
+	ideacontroller     controllers.IIdeaController
+	sessioncontroller  controllers.ISessionController
+	statscontroller    controllers.IDailyStatsController
+	badgecontroller    controllers.IBadgeController
+	categorycontroller controllers.ICategoryController
+	searchcontroller   controllers.ISavedSearchController
+	tokencontroller    controllers.IAccessTokenController
+	receiptcontroller  controllers.IDeletionReceiptController
+	userservice        services.IUserService
+	ideaservice        services.IIdeaService
+	dailystatsservice  services.IDailyStatsService
+	sessionservice     services.ISessionService
+	adminservice       services.IAdminService
+	tokenservice       services.IAccessTokenService
+	accountservice     services.IAccountService
+	achievementservice services.IAchievementService
+	categoryservice    services.ICategoryService
+	searchservice      services.ISavedSearchService
+	requireauth        middleware.RequireAuth
+	userroute          routes.UserRoutes
+	idearoute          routes.IdeaRoutes
+	sessionroute       routes.SessionRoutes
+	categoryroute      routes.CategoryRoutes
+	searchroute        routes.SavedSearchRoutes
+	adminroute         routes.AdminRoutes
+	ctx                context.Context
 )
 
 func init() {
@@ -44,17 +73,73 @@ func init() {
 	// collections
 	usercollection = db.MongoDB.Database("60s-idea-training").Collection("users")
 	ideacollection = db.MongoDB.Database("60s-idea-training").Collection("idearecords")
+	sessioncollection = db.MongoDB.Database("60s-idea-training").Collection("sessions")
+	statscollection = db.MongoDB.Database("60s-idea-training").Collection("daily_stats")
+	badgecollection = db.MongoDB.Database("60s-idea-training").Collection("badges")
+	categorycollection = db.MongoDB.Database("60s-idea-training").Collection("categories")
+	searchcollection = db.MongoDB.Database("60s-idea-training").Collection("savedsearches")
+	tombcollection = db.MongoDB.Database("60s-idea-training").Collection("tombstones")
+	seqcollection = db.MongoDB.Database("60s-idea-training").Collection("syncsequences")
+	tokencollection = db.MongoDB.Database("60s-idea-training").Collection("accesstokens")
+	receiptcollection = db.MongoDB.Database("60s-idea-training").Collection("deletionreceipts")
 	// controllers
 	usercontroller = controllers.NewUserController(usercollection, ctx)
-	ideacontroller = controllers.NewIdeaController(ideacollection, ctx)
+	ideacontroller = controllers.NewIdeaController(ideacollection, tombcollection, seqcollection, statscollection, ctx)
+	sessioncontroller = controllers.NewSessionController(sessioncollection, ctx)
+	statscontroller = controllers.NewDailyStatsController(statscollection, ctx)
+	badgecontroller = controllers.NewBadgeController(badgecollection, ctx)
+	categorycontroller = controllers.NewCategoryController(categorycollection, ideacollection, seqcollection, statscollection, ctx)
+	searchcontroller = controllers.NewSavedSearchController(searchcollection, ctx)
+	tokencontroller = controllers.NewAccessTokenController(tokencollection, ctx)
+	receiptcontroller = controllers.NewDeletionReceiptController(receiptcollection, ctx)
+	if err = usercontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = ideacontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = sessioncontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = statscontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = badgecontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = categorycontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = searchcontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = tokencontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
+	if err = receiptcontroller.CreateIndexes(); err != nil {
+		log.Println(err)
+	}
 	// services
-	userservice = services.NewUserService(usercontroller)
-	ideaservice = services.NewIdeaService(ideacontroller)
+	dailystatsservice = services.NewDailyStatsService(usercontroller, ideacontroller)
+	userservice = services.NewUserService(usercontroller, dailystatsservice, firebase.IdentityProvider{})
+	categoryservice = services.NewCategoryService(categorycontroller, ideacontroller)
+	ideaservice = services.NewIdeaService(ideacontroller, statscontroller, dailystatsservice, categoryservice)
+	searchservice = services.NewSavedSearchService(searchcontroller, ideaservice)
+	sessionservice = services.NewSessionService(sessioncontroller, ideacontroller, dailystatsservice, categoryservice, services.SessionConfig{GracePeriod: services.DEFAULT_SESSION_GRACE_PERIOD})
+	adminservice = services.NewAdminService(usercontroller, ideacontroller)
+	tokenservice = services.NewAccessTokenService(tokencontroller)
+	achievementservice = services.NewAchievementService(usercontroller, statscontroller, badgecontroller, categorycontroller)
+	dailystatsservice.OnIdeaCreated(achievementservice.AwardBadges)
+	accountservice = services.NewAccountService(usercontroller, ideacontroller, sessioncontroller, statscontroller, badgecontroller, categorycontroller, searchcontroller, tokencontroller, receiptcontroller, firebase.IdentityProvider{}, cloudinary.ImageStore{})
 	// middleware
-	requireauth = middleware.NewRequireAuth(usercontroller)
+	requireauth = middleware.NewRequireAuth(usercontroller, tokencontroller, middleware.NewHMACVerifier(os.Getenv("JWT_SECRET")))
 	// routes
-	userroute = routes.NewUserRoutes(userservice, requireauth)
+	userroute = routes.NewUserRoutes(userservice, tokenservice, accountservice, achievementservice, requireauth)
 	idearoute = routes.NewIdeaRoutes(ideaservice, requireauth)
+	sessionroute = routes.NewSessionRoutes(sessionservice, requireauth)
+	categoryroute = routes.NewCategoryRoutes(categoryservice, requireauth)
+	searchroute = routes.NewSavedSearchRoutes(searchservice, requireauth)
+	adminroute = routes.NewAdminRoutes(adminservice, requireauth)
 	// server
 	server = gin.Default()
 }
@@ -65,14 +150,30 @@ func TestMain(m *testing.M) {
 	basepath := server.Group("/api")
 	userroute.UserRoutes(basepath)
 	idearoute.IdeaRoutes(basepath)
+	sessionroute.SessionRoutes(basepath)
+	categoryroute.CategoryRoutes(basepath)
+	searchroute.SavedSearchRoutes(basepath)
+	adminroute.AdminRoutes(basepath)
 	unitTest.SetRouter(server)
 
 	log.Println("\n==========================\nPopulating sample data first! Wait for a momment...\n==========================")
 	firebase.DeleteAllUsersInFirebase()
 	DeleteSampleData(usercollection, ctx)
 	DeleteSampleData(ideacollection, ctx)
+	DeleteSampleData(sessioncollection, ctx)
+	DeleteSampleData(statscollection, ctx)
+	DeleteSampleData(badgecollection, ctx)
+	DeleteSampleData(categorycollection, ctx)
+	DeleteSampleData(searchcollection, ctx)
+	DeleteSampleData(tombcollection, ctx)
+	DeleteSampleData(seqcollection, ctx)
+	DeleteSampleData(tokencollection, ctx)
+	DeleteSampleData(receiptcollection, ctx)
 	PopulateUserSampleData(usercollection, ctx)
 	PopulateIdeaSampleData(usercollection, ideacollection, ctx)
+	if _, err := dailystatsservice.Backfill(); err != nil {
+		log.Fatalf("Some error occured. Err: %s", err)
+	}
 
 	newLog := log.New(os.Stdout, "", log.Llongfile|log.Ldate|log.Ltime)
 	unitTest.SetLog(newLog)
@@ -82,5 +183,14 @@ func TestMain(m *testing.M) {
 	firebase.DeleteAllUsersInFirebase()
 	DeleteSampleData(usercollection, ctx)
 	DeleteSampleData(ideacollection, ctx)
+	DeleteSampleData(sessioncollection, ctx)
+	DeleteSampleData(statscollection, ctx)
+	DeleteSampleData(badgecollection, ctx)
+	DeleteSampleData(categorycollection, ctx)
+	DeleteSampleData(searchcollection, ctx)
+	DeleteSampleData(tombcollection, ctx)
+	DeleteSampleData(seqcollection, ctx)
+	DeleteSampleData(tokencollection, ctx)
+	DeleteSampleData(receiptcollection, ctx)
 	os.Exit(exitVal)
 }
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"idea-training-version-go/internals/models"
+	"idea-training-version-go/internals/services"
+	"net/http"
+	"testing"
+
+	unitTest "github.com/Valiben/gin_unit_test"
+	"github.com/Valiben/gin_unit_test/utils"
+)
+
+func TestSavedSearches(t *testing.T) {
+	type SavedSearchResponse struct {
+		StatusCode int                `json:"status_code"`
+		Message    string             `json:"message"`
+		Data       models.SavedSearch `json:"data"`
+	}
+	type ResultsResponse struct {
+		StatusCode int                    `json:"status_code"`
+		Data       services.SearchResults `json:"data"`
+	}
+	type CollectionsResponse struct {
+		StatusCode int                        `json:"status_code"`
+		Data       []services.SmartCollection `json:"data"`
+	}
+	type IdeaParams struct {
+		TopicTitle string   `json:"topicTitle"`
+		Ideas      []string `json:"ideas"`
+		Tags       []string `json:"tags"`
+		IsLiked    bool     `json:"isLiked"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestSavedSearches: Fails to add auth header %v\n", err)
+		return
+	}
+
+	for _, params := range []IdeaParams{
+		{TopicTitle: "test_saved liked", Ideas: []string{"idea_1"}, Tags: []string{"testsaved"}, IsLiked: true},
+		{TopicTitle: "test_saved other", Ideas: []string{"idea_1"}, Tags: []string{"testsaved"}},
+	} {
+		var res struct {
+			StatusCode int `json:"status_code"`
+		}
+		if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &res); err != nil || res.StatusCode != http.StatusCreated {
+			t.Errorf("TestSavedSearches: expected idea to be created, got %v %v\n", res.StatusCode, err)
+			return
+		}
+	}
+
+	var invalid SavedSearchResponse
+	params := map[string]interface{}{"name": "test_saved_invalid", "request": map[string]interface{}{"q": "catgory:x"}}
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/searches/", "json", params, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestSavedSearches: expected status %v for an invalid query, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	var saved SavedSearchResponse
+	params = map[string]interface{}{"name": "test_saved_liked", "request": map[string]interface{}{"q": "tag:testsaved liked:true", "sortBy": "recent"}, "pinned": true}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/searches/", "json", params, &saved); err != nil || saved.StatusCode != http.StatusCreated {
+		t.Errorf("TestSavedSearches: expected search to be saved, got %v %v %v\n", saved.StatusCode, saved.Message, err)
+		return
+	}
+
+	var duplicate SavedSearchResponse
+	params["name"] = "TEST_SAVED_LIKED"
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/searches/", "json", params, &duplicate)
+	if duplicate.StatusCode != http.StatusConflict {
+		t.Errorf("TestSavedSearches: expected status %v for a duplicate name, got %v\n", http.StatusConflict, duplicate.StatusCode)
+	}
+
+	var results ResultsResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/searches/"+saved.Data.ID.Hex()+"/results", "json", nil, &results); err != nil || results.StatusCode != http.StatusOK {
+		t.Errorf("TestSavedSearches: expected results, got %v %v\n", results.StatusCode, err)
+		return
+	}
+	if len(results.Data.Ideas) != 1 || results.Data.Ideas[0].TopicTitle != "test_saved liked" {
+		t.Errorf("TestSavedSearches: expected the liked idea only, got %v ideas\n", len(results.Data.Ideas))
+	}
+
+	var collections CollectionsResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/searches/collections", "json", nil, &collections); err != nil || collections.StatusCode != http.StatusOK {
+		t.Errorf("TestSavedSearches: expected collections, got %v %v\n", collections.StatusCode, err)
+		return
+	}
+	if len(collections.Data) != 1 || collections.Data[0].Count != 1 {
+		t.Errorf("TestSavedSearches: expected one collection of one idea, got %+v\n", collections.Data)
+	}
+
+	// unpinned searches leave the dashboard
+	var updated SavedSearchResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, "/api/searches/"+saved.Data.ID.Hex(), "json", map[string]interface{}{"pinned": false}, &updated); err != nil || updated.StatusCode != http.StatusOK || updated.Data.Pinned {
+		t.Errorf("TestSavedSearches: expected search to be unpinned, got %v %v\n", updated.StatusCode, err)
+	}
+	collections = CollectionsResponse{}
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/searches/collections", "json", nil, &collections)
+	if len(collections.Data) != 0 {
+		t.Errorf("TestSavedSearches: expected no collections, got %v\n", len(collections.Data))
+	}
+
+	var deleted struct {
+		StatusCode int `json:"status_code"`
+	}
+	unitTest.TestHandlerUnMarshalResp(utils.DELETE, "/api/searches/"+saved.Data.ID.Hex(), "json", nil, &deleted)
+	if deleted.StatusCode != http.StatusOK {
+		t.Errorf("TestSavedSearches: expected search to be deleted, got %v\n", deleted.StatusCode)
+	}
+	results = ResultsResponse{}
+	unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/searches/"+saved.Data.ID.Hex()+"/results", "json", nil, &results)
+	if results.StatusCode != http.StatusNotFound {
+		t.Errorf("TestSavedSearches: expected status %v after deletion, got %v\n", http.StatusNotFound, results.StatusCode)
+	}
+
+	t.Log("passed")
+}
@@ -98,7 +98,7 @@ func PopulateIdeaSampleData(usercollection *mongo.Collection, ideacollection *mo
 	for i := 0; i < 10; i++ {
 		task := models.Idea{
 			TopicTitle: fmt.Sprintf("test title %d", i),
-			Ideas:      &[]string{fmt.Sprintf("idea_%d", i)},
+			Ideas:      &[]models.IdeaEntry{{Text: fmt.Sprintf("idea_%d", i)}},
 			CreatedBy:  oid,
 		}
 
@@ -121,10 +121,21 @@ func DeleteSampleData(mongo *mongo.Collection, ctx context.Context) error {
 }
 
 func GenerateJWTToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": email,
-		"exp":   time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	return GenerateJWTTokenFor("", email)
+}
+
+// GenerateJWTTokenFor signs a token of the identity uid, if given, with the
+// verified email.
+func GenerateJWTTokenFor(uid string, email string) (string, error) {
+	claims := jwt.MapClaims{
+		"email":          email,
+		"email_verified": true,
+		"exp":            time.Now().Add(time.Hour * 24 * 30).Unix(),
+	}
+	if uid != "" {
+		claims["sub"] = uid
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
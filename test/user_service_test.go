@@ -2,8 +2,10 @@ package test
 
 import (
 	"fmt"
+	"idea-training-version-go/internals/guard"
 	"idea-training-version-go/internals/models"
 	"log"
+	"net/http"
 	"testing"
 
 	unitTest "github.com/Valiben/gin_unit_test"
@@ -12,12 +14,16 @@ import (
 )
 
 func AddAuthHeader() (*models.User, error) {
+	return AddAuthHeaderFor("test_email100@test.com")
+}
+
+func AddAuthHeaderFor(email string) (*models.User, error) {
 	// get one test user id
 	var user models.User
 	filter := bson.D{
 		bson.E{
 			Key:   "email",
-			Value: "test_email100@test.com",
+			Value: email,
 		},
 	}
 	if err := usercollection.FindOne(ctx, filter).Decode(&user); err != nil {
@@ -56,6 +62,23 @@ func TestSignup(t *testing.T) {
 		LastName:  "test_last_name_11",
 	}
 
+	// an identity can only sign up its own, verified email
+	tokenString, err := GenerateJWTTokenFor("test_uid_other", "test_other@test.com")
+	if err != nil {
+		t.Errorf("TestSignup: %v\n", err)
+		return
+	}
+	unitTest.AddHeader("Authorization", fmt.Sprintf("Bearer %s", tokenString))
+	var hijacked struct {
+		StatusCode int `json:"status_code"`
+	}
+	unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/users/signup", "json", params, &hijacked)
+	if hijacked.StatusCode != http.StatusForbidden {
+		t.Errorf("TestSignup: expected status %v for the email of another identity, got %v\n", http.StatusForbidden, hijacked.StatusCode)
+	}
+
+	// signing up needs no token
+	unitTest.AddHeader("Authorization", "")
 	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/users/signup", "json", params, &res); err != nil {
 		t.Errorf("TestSignup: %v\n", err)
 		return
@@ -101,6 +124,20 @@ func TestUpdateUser(t *testing.T) {
 		return
 	}
 
+	// the new email has to be verified first
+	var unverified HTTPResponse
+	unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", params, &unverified)
+	if unverified.Success || unverified.StatusCode != http.StatusForbidden {
+		t.Errorf("TestUpdateUser: expected status %v for an unverified email, got %v\n", http.StatusForbidden, unverified.StatusCode)
+		return
+	}
+
+	tokenString, err := GenerateJWTTokenFor(user.FirebaseUID, params.Email)
+	if err != nil {
+		t.Errorf("TestUpdateUser: %v/n", err)
+		return
+	}
+	unitTest.AddHeader("Authorization", fmt.Sprintf("Bearer %s", tokenString))
 	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", params, &res); err != nil {
 		t.Errorf("TestUpdateUser: %v/n", err)
 		return
@@ -118,3 +155,277 @@ func TestUpdateUser(t *testing.T) {
 
 	t.Log("passed")
 }
+
+func TestUpdateUserTimezone(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int         `json:"status_code"`
+		Success    bool        `json:"success"`
+		Message    string      `json:"message"`
+		Data       models.User `json:"data"`
+	}
+
+	user, err := AddAuthHeaderFor("test_email8@test.com")
+	if err != nil {
+		t.Errorf("TestUpdateUserTimezone: %v\n", err)
+		return
+	}
+
+	var res HTTPResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", map[string]string{"timezone": "Asia/Tokyo"}, &res); err != nil {
+		t.Errorf("TestUpdateUserTimezone: %v\n", err)
+		return
+	}
+	if res.Data.Timezone != "Asia/Tokyo" {
+		t.Errorf("TestUpdateUserTimezone: expected timezone %v, got %v\n", "Asia/Tokyo", res.Data.Timezone)
+	}
+
+	var invalid HTTPResponse
+	unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", map[string]string{"timezone": "Mars/Olympus_Mons"}, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestUpdateUserTimezone: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	// other users can not change the time zone, and rebuild the stats
+	if _, err := AddAuthHeaderFor("test_email9@test.com"); err != nil {
+		t.Errorf("TestUpdateUserTimezone: Fails to add auth header %v\n", err)
+		return
+	}
+	var forbidden HTTPResponse
+	unitTest.TestHandlerUnMarshalResp(utils.PUT, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", map[string]string{"timezone": "Europe/Berlin"}, &forbidden)
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Errorf("TestUpdateUserTimezone: expected status %v for another user, got %v\n", http.StatusForbidden, forbidden.StatusCode)
+	}
+
+	t.Log("passed")
+}
+
+func TestAccessTokens(t *testing.T) {
+	type TokenParams struct {
+		Name   string        `json:"name"`
+		Scopes []guard.Scope `json:"scopes"`
+	}
+	type ResponseBody struct {
+		Token       string             `json:"token"`
+		AccessToken models.AccessToken `json:"accessToken"`
+	}
+	type HTTPResponse struct {
+		StatusCode int          `json:"status_code"`
+		Success    bool         `json:"success"`
+		Message    string       `json:"message"`
+		Data       ResponseBody `json:"data"`
+	}
+	type IdeasResponse struct {
+		StatusCode int           `json:"status_code"`
+		Success    bool          `json:"success"`
+		Message    string        `json:"message"`
+		Data       []models.Idea `json:"data"`
+	}
+
+	var res HTTPResponse
+
+	if _, err := AddAuthHeaderFor("test_email6@test.com"); err != nil {
+		t.Errorf("TestAccessTokens: Fails to add auth header %v\n", err)
+		return
+	}
+
+	params := TokenParams{Name: "export script", Scopes: []guard.Scope{guard.IdeasRead}}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/users/tokens", "json", params, &res); err != nil {
+		t.Errorf("TestAccessTokens: %v\n", err)
+		return
+	}
+
+	if !res.Success || res.Data.Token == "" {
+		t.Errorf("TestAccessTokens: %v\n", res.Message)
+		return
+	}
+
+	token, tokenID := res.Data.Token, res.Data.AccessToken.ID
+
+	// read with the access token
+	unitTest.AddHeader("Authorization", fmt.Sprintf("Bearer %s", token))
+	var ideasRes IdeasResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/", "json", nil, &ideasRes); err != nil {
+		t.Errorf("TestAccessTokens: %v\n", err)
+		return
+	}
+	if !ideasRes.Success {
+		t.Errorf("TestAccessTokens: expected read access, got %v\n", ideasRes.Message)
+		return
+	}
+
+	// writes need the ideas:write scope
+	ideasRes = IdeasResponse{}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", models.Idea{TopicTitle: "from script"}, &ideasRes); err != nil {
+		t.Errorf("TestAccessTokens: %v\n", err)
+		return
+	}
+	if ideasRes.Success || ideasRes.StatusCode != http.StatusForbidden {
+		t.Errorf("TestAccessTokens: expected status %v, got %v\n", http.StatusForbidden, ideasRes.StatusCode)
+		return
+	}
+
+	// revoke
+	if _, err := AddAuthHeaderFor("test_email6@test.com"); err != nil {
+		t.Errorf("TestAccessTokens: Fails to add auth header %v\n", err)
+		return
+	}
+	var revokeRes struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.DELETE, fmt.Sprintf("/api/users/tokens/%v", tokenID.Hex()), "json", nil, &revokeRes); err != nil {
+		t.Errorf("TestAccessTokens: %v\n", err)
+		return
+	}
+	if !revokeRes.Success {
+		t.Errorf("TestAccessTokens: %v\n", revokeRes.Message)
+		return
+	}
+
+	// revoked tokens are rejected
+	unitTest.AddHeader("Authorization", fmt.Sprintf("Bearer %s", token))
+	ideasRes = IdeasResponse{}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/ideas/", "json", nil, &ideasRes); err != nil {
+		t.Errorf("TestAccessTokens: %v\n", err)
+		return
+	}
+	if ideasRes.Success || ideasRes.StatusCode != http.StatusUnauthorized {
+		t.Errorf("TestAccessTokens: expected status %v, got %v\n", http.StatusUnauthorized, ideasRes.StatusCode)
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestDeleteUser(t *testing.T) {
+	type HTTPResponse struct {
+		StatusCode int                    `json:"status_code"`
+		Success    bool                   `json:"success"`
+		Message    string                 `json:"message"`
+		Data       models.DeletionReceipt `json:"data"`
+	}
+
+	var res HTTPResponse
+
+	if _, err := AddAuthHeaderFor("test_email7@test.com"); err != nil {
+		t.Errorf("TestDeleteUser: Fails to add auth header %v\n", err)
+		return
+	}
+
+	user, err := getSampleUser("test_email5@test.com")
+	if err != nil {
+		t.Errorf("TestDeleteUser: Failed to get sample user data...%v\n", err)
+		return
+	}
+
+	// other users can not delete the account
+	if err := unitTest.TestHandlerUnMarshalResp(utils.DELETE, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestDeleteUser: %v\n", err)
+		return
+	}
+	if res.Success || res.StatusCode != http.StatusForbidden {
+		t.Errorf("TestDeleteUser: expected status %v, got %v\n", http.StatusForbidden, res.StatusCode)
+		return
+	}
+
+	if _, err := AddAuthHeaderFor(user.Email); err != nil {
+		t.Errorf("TestDeleteUser: Fails to add auth header %v\n", err)
+		return
+	}
+	if _, err := ideacollection.InsertOne(ctx, models.Idea{TopicTitle: "to be deleted", CreatedBy: user.ID}); err != nil {
+		t.Errorf("TestDeleteUser: Failed to insert idea...%v\n", err)
+		return
+	}
+
+	res = HTTPResponse{}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.DELETE, fmt.Sprintf("/api/users/%v", user.ID.Hex()), "json", nil, &res); err != nil {
+		t.Errorf("TestDeleteUser: %v\n", err)
+		return
+	}
+
+	if !res.Success || res.Data.Status != models.DELETION_COMPLETED {
+		t.Errorf("TestDeleteUser: expected completed deletion, got %v\n", res)
+		return
+	}
+
+	if res.Data.Deleted["ideas"] != 1 || res.Data.Deleted["user"] != 1 {
+		t.Errorf("TestDeleteUser: unexpected deleted counts %v\n", res.Data.Deleted)
+		return
+	}
+
+	if count, _ := usercollection.CountDocuments(ctx, bson.M{"_id": user.ID}); count != 0 {
+		t.Errorf("TestDeleteUser: expected user to be deleted\n")
+		return
+	}
+
+	if count, _ := ideacollection.CountDocuments(ctx, bson.M{"createdBy": user.ID}); count != 0 {
+		t.Errorf("TestDeleteUser: expected ideas to be deleted\n")
+		return
+	}
+
+	t.Log("passed")
+}
+
+func TestGoalsAndBadges(t *testing.T) {
+	type GoalsResponse struct {
+		StatusCode int                   `json:"status_code"`
+		Data       []models.GoalProgress `json:"data"`
+	}
+	type BadgesResponse struct {
+		StatusCode int            `json:"status_code"`
+		Data       []models.Badge `json:"data"`
+	}
+	type GoalsParams struct {
+		Goals []models.Goal `json:"goals"`
+	}
+
+	if _, err := AddAuthHeader(); err != nil {
+		t.Errorf("TestGoalsAndBadges: %v\n", err)
+		return
+	}
+
+	goals := GoalsParams{Goals: []models.Goal{
+		{Metric: models.GOAL_SESSIONS, Period: models.GOAL_WEEK, Target: 1},
+		{Metric: models.GOAL_IDEAS, Period: models.GOAL_DAY, Target: 1000},
+	}}
+	var res GoalsResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.PUT, "/api/users/me/goals", "json", goals, &res); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("TestGoalsAndBadges: expected goals to be set, got %v %v\n", res.StatusCode, err)
+		return
+	}
+
+	var invalid GoalsResponse
+	unitTest.TestHandlerUnMarshalResp(utils.PUT, "/api/users/me/goals", "json", GoalsParams{Goals: []models.Goal{{Metric: "minutes", Period: models.GOAL_DAY, Target: 1}}}, &invalid)
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestGoalsAndBadges: expected status %v, got %v\n", http.StatusBadRequest, invalid.StatusCode)
+	}
+
+	var idea struct {
+		StatusCode int `json:"status_code"`
+	}
+	params := map[string]interface{}{"topicTitle": "test_goal_topic", "ideas": []string{"idea_1"}}
+	if err := unitTest.TestHandlerUnMarshalResp(utils.POST, "/api/ideas/", "json", params, &idea); err != nil || idea.StatusCode != http.StatusCreated {
+		t.Errorf("TestGoalsAndBadges: expected idea to be created, got %v %v\n", idea.StatusCode, err)
+		return
+	}
+
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/users/me/goals", "json", nil, &res); err != nil {
+		t.Errorf("TestGoalsAndBadges: %v\n", err)
+		return
+	}
+	if len(res.Data) != 2 || !res.Data[0].Completed || res.Data[0].Progress < 1 || res.Data[1].Completed {
+		t.Errorf("TestGoalsAndBadges: expected the weekly session goal only to be completed, got %+v\n", res.Data)
+	}
+
+	var badges BadgesResponse
+	if err := unitTest.TestHandlerUnMarshalResp(utils.GET, "/api/users/me/badges", "json", nil, &badges); err != nil {
+		t.Errorf("TestGoalsAndBadges: %v\n", err)
+		return
+	}
+	if len(badges.Data) < 1 || badges.Data[0].Kind != models.BADGE_FIRST_SESSION {
+		t.Errorf("TestGoalsAndBadges: expected the first session badge, got %+v\n", badges.Data)
+	}
+
+	t.Log("passed")
+}